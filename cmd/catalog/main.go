@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/Phantomvv1/Library_management/internal/books"
+	"github.com/jackc/pgx/v5"
+)
+
+const usage = `Usage:
+  catalog import [-atomic] <file.csv>   upsert the books in the CSV file by ISBN
+  catalog export [file.csv]             write the catalog as CSV (to stdout when no file is given)
+  catalog migrate-isbns                 store the ISBNs as ISBN-13 and make them unique, reporting the ones that can't be
+  catalog migrate-history [-drop]       move the old history of titles to the loans, dropping it once nothing is left`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	if err = books.CreateCatalogTables(conn); err != nil {
+		log.Fatal(err)
+	}
+
+	switch os.Args[1] {
+	case "import":
+		importCommand(conn, os.Args[2:])
+	case "export":
+		exportCommand(conn, os.Args[2:])
+	case "migrate-isbns":
+		migrateISBNsCommand(conn)
+	case "migrate-history":
+		migrateHistoryCommand(conn, os.Args[2:])
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func importCommand(conn *pgx.Conn, args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	atomic := flags.Bool("atomic", false, "import nothing if any line is invalid")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+
+	results, err := books.ImportCSV(conn, file, *atomic)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	invalid := 0
+	for _, result := range results {
+		if result.Status == "invalid" {
+			invalid++
+		}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(results)
+
+	if invalid > 0 {
+		if *atomic {
+			log.Fatalf("%d invalid lines, nothing was imported", invalid)
+		}
+
+		log.Printf("%d invalid lines were skipped", invalid)
+	}
+}
+
+func exportCommand(conn *pgx.Conn, args []string) {
+	var out io.Writer = os.Stdout
+	if len(args) > 0 {
+		file, err := os.Create(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	if err := books.ExportCSV(conn, out); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func migrateISBNsCommand(conn *pgx.Conn) {
+	migration, err := books.MigrateISBNs(conn)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(migration)
+
+	if !migration.Indexed {
+		log.Fatalf("%d ISBNs are shared by more than one book, fix them and run it again", len(migration.Duplicates))
+	}
+}
+
+func migrateHistoryCommand(conn *pgx.Conn, args []string) {
+	flags := flag.NewFlagSet("migrate-history", flag.ExitOnError)
+	drop := flags.Bool("drop", false, "drop the old history even when some titles couldn't be moved")
+	flags.Parse(args)
+
+	if err := books.CreateCirculationTables(conn); err != nil {
+		log.Fatal(err)
+	}
+
+	leftovers, err := books.MigrateHistory(conn, *drop)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(leftovers)
+
+	if len(leftovers) > 0 && !*drop {
+		log.Printf("%d titles match no book or more than one book and were kept in the old history, add or rename the books and run it again, or use -drop", len(leftovers))
+	}
+}
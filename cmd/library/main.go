@@ -1,14 +1,28 @@
 package main
 
 import (
+	"context"
+	"log"
 	"net/http"
 	"time"
 
+	. "github.com/Phantomvv1/Library_management/internal/accounts"
+	. "github.com/Phantomvv1/Library_management/internal/acquisitions"
 	. "github.com/Phantomvv1/Library_management/internal/authentication"
+	. "github.com/Phantomvv1/Library_management/internal/blocks"
 	. "github.com/Phantomvv1/Library_management/internal/books"
+	. "github.com/Phantomvv1/Library_management/internal/desk"
+	. "github.com/Phantomvv1/Library_management/internal/digital"
 	. "github.com/Phantomvv1/Library_management/internal/librarians"
+	. "github.com/Phantomvv1/Library_management/internal/loans"
+	. "github.com/Phantomvv1/Library_management/internal/notifications"
+	. "github.com/Phantomvv1/Library_management/internal/policies"
+	. "github.com/Phantomvv1/Library_management/internal/reports"
 	. "github.com/Phantomvv1/Library_management/internal/reviews"
+	. "github.com/Phantomvv1/Library_management/internal/stocktake"
+	"github.com/Phantomvv1/Library_management/internal/storage"
 	. "github.com/Phantomvv1/Library_management/internal/users"
+	. "github.com/Phantomvv1/Library_management/internal/works"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
@@ -18,13 +32,27 @@ func main() {
 
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Content-Type"},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 
+	store, err := storage.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	SetStorage(store)
+
+	if local, ok := store.(*storage.Local); ok {
+		r.Static(local.BaseURL, local.Dir)
+	}
+
+	StartExpiryWorker(context.Background(), time.Minute)
+	StartFineWorker(context.Background(), time.Hour)
+	StartHoldWorker(context.Background(), time.Hour)
+
 	r.Any("/", func(c *gin.Context) { c.JSON(http.StatusOK, nil) })
 	r.GET("/users", GetUsers)
 	r.GET("/books", GetBooks)
@@ -34,6 +62,18 @@ func main() {
 	r.GET("/book", GetBookByID)
 	r.GET("/authors", GetAuthors)
 	r.GET("/book/availability", IsAvailable)
+	r.GET("/book/export/marc", ExportMARC)
+	r.GET("/book/lookup", LookupBook)
+	r.GET("/book/nearby", GetNearbyBooks)
+	r.GET("/policies", GetPolicies)
+	r.GET("/blocks/rules", GetBlockRules)
+	r.GET("/classification", GetClassifications)
+	r.GET("/classification/books", BrowseClassification)
+	r.GET("/work", GetWork)
+	r.GET("/series", GetSeries)
+	r.GET("/digital", GetDigitalItems)
+	r.GET("/digital/download", DownloadDigital)
+	r.GET("/suggestions", GetSuggestions)
 	r.POST("/review", LeaveReview)
 	r.DELETE("/review", DeleteReview)
 	r.PUT("/review", EditReview)
@@ -48,8 +88,10 @@ func main() {
 	r.POST("/book/rating/details", RatingDetails)
 	r.POST("/book/rating/details/sql", RatingDetailsSQL)
 	r.POST("/book/cancel/reservation", CancelBookReservation)
+	r.POST("/reservations", GetReservations)
 	r.POST("/user", GetUserByID)
 	r.POST("/user/history", GetUserHistory)
+	r.POST("/user/age", SetPatronAge)
 	r.POST("/history", GetHistory)
 	r.POST("/profile", GetCurrentProfile)
 	r.POST("/event/invited", GetInvited)
@@ -62,12 +104,63 @@ func main() {
 	r.POST("/book/borrow", BorrowBook)
 	r.POST("/book/return", ReturnBook)
 	r.POST("/book/reserve", ReserveBook)
+	r.POST("/desk/checkout", DeskCheckout)
+	r.POST("/desk/checkin", DeskCheckin)
+	r.POST("/book/age/override", GrantAgeOverride)
+	r.POST("/policy", SavePolicy)
+	r.POST("/policy/delete", DeletePolicy)
+	r.POST("/loans", GetLoans)
+	r.POST("/loans/:id/renew", RenewLoan)
+	r.POST("/loans/:id/renewals", GetRenewals)
+	r.POST("/loans/:id/lost", MarkLoanLost)
+	r.POST("/loans/:id/claimed", MarkLoanClaimed)
+	r.POST("/loans/:id/found", MarkLoanFound)
+	r.POST("/loans/:id/recall", RecallLoan)
+	r.POST("/notifications", GetNotifications)
+	r.POST("/account", GetAccount)
+	r.POST("/account/payment", RecordPayment)
+	r.POST("/account/waive", WaiveFee)
+	r.POST("/blocks/rules", SaveBlockRules)
+	r.POST("/user/suspend", SuspendUser)
+	r.POST("/user/suspend/lift", LiftSuspension)
+	r.POST("/user/standing", GetUserStanding)
+	r.POST("/book/copy", AddCopy)
+	r.POST("/book/copy/condition", SetCopyCondition)
+	r.POST("/book/copy/location", SetCopyLocation)
+	r.POST("/book/damage", ReportDamage)
+	r.POST("/book/damage/resolve", ResolveDamage)
+	r.POST("/book/damage/list", GetDamageReports)
 	r.POST("/event", CreateEvent)
 	r.POST("/event/invite", InviteToEvent)
 	r.POST("/book/quantity", UpdateBookQuantity)
-	r.POST("/book/update/id", UpdateBookID)
 	r.POST("/book/remove", RemoveBook)
 	r.POST("/book/overdue", GetBooksOverdue)
+	r.POST("/book/import/marc", ImportMARC)
+	r.POST("/book/import/csv", ImportBooksCSV)
+	r.POST("/book/export/csv", ExportBooksCSV)
+	r.POST("/book/cover", UploadCover)
+	r.POST("/work", CreateWork)
+	r.POST("/work/edition", SetEdition)
+	r.POST("/work/series", SetWorkSeries)
+	r.POST("/series", CreateSeries)
+	r.PATCH("/books/:id", UpdateBook)
+	r.POST("/books/:id/history", GetBookChanges)
+	r.POST("/stocktake", StartStocktake)
+	r.POST("/stocktake/scan", ScanCopies)
+	r.POST("/stocktake/report", GetStocktakeReport)
+	r.POST("/stocktake/adjust", AdjustStocktake)
+	r.POST("/stocktake/close", CloseStocktake)
+	r.POST("/report/unborrowed", GetUnborrowedReport)
+	r.POST("/report/demand", GetDemandReport)
+	r.POST("/report/loans", GetLoanDurationReport)
+	r.POST("/report/condition", GetConditionReport)
+	r.POST("/digital", AddDigitalItem)
+	r.POST("/digital/borrow", BorrowDigital)
+	r.POST("/digital/return", ReturnDigital)
+	r.POST("/digital/loans", GetDigitalLoans)
+	r.POST("/suggestion", SuggestPurchase)
+	r.POST("/suggestion/vote", VoteForSuggestion)
+	r.POST("/suggestion/status", UpdateSuggestionStatus)
 
 	r.Run(":42069")
 }
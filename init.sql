@@ -1,7 +1,30 @@
-create table if not exists authentication (id serial primary key, name text, email text, password text, type text, history text[]);
+create table if not exists authentication (id serial primary key, name text, email text, password text, type text, birth_date date, category text not null default 'adult', card_number text unique);
 create table if not exists events (id serial primary key not null, name text, description text, invited text, start timestamp);
-create table if not exists borrowed_books (id serial primary key not null, book_id int, user_id int, return_date date);
-create table if not exists book_reservations (id serial primary key, book_id int, user_id int);
-create table if not exists books (id serial primary key, isbn text, title text, author text, year int, quantity int);
+create table if not exists borrowed_books (id serial primary key not null, book_id int, user_id int, return_date date, borrowed_at timestamp default current_timestamp, returned_at timestamp, renewals int not null default 0, lent_by int, override_reason text not null default '', migrated boolean not null default false, missing text not null default '', missing_since timestamp, recalled_at timestamp, recalled_by int);
+create table if not exists book_reservations (id serial primary key, book_id int, user_id int, status text not null default 'waiting', created_at timestamp not null default current_timestamp, ready_at timestamp, pickup_by date, copy_id int);
+create table if not exists series (id serial primary key, name text not null, description text not null default '');
+create table if not exists works (id serial primary key, title text not null, author text not null default '', series_id int references series(id) on delete set null, series_number numeric);
+create table if not exists books (id serial primary key, isbn text unique, title text, author text, year int, quantity int, subjects text[] not null default '{}', publisher text not null default '', pages int not null default 0, cover_url text not null default '', thumbnails jsonb not null default '{}', work_id int references works(id) on delete set null, version int not null default 1, call_number text not null default '', call_number_scheme text not null default '', call_number_key text not null default '', dewey_class text not null default '', age_rating int not null default 0, item_category text not null default 'standard');
+create index if not exists books_call_number_key_c on books (call_number_scheme, (call_number_key collate "C"), id);
 create table if not exists reviews (id serial primary key, user_id int references authentication(id) on delete cascade, book_id int references books(id), stars numeric, comment text);
 create table if not exists votes (id serial primary key, vote text, review_id int references reviews(id) on delete cascade, user_id int references authentication(id));
+create table if not exists book_changes (id serial primary key, book_id int references books(id) on delete cascade, user_id int, field text, old_value text, new_value text, changed_at timestamp not null default current_timestamp);
+create table if not exists copies (id serial primary key, book_id int not null references books(id) on delete cascade, barcode text not null unique, status text not null default 'available', added_at timestamp not null default current_timestamp, shelf text not null default '', room text not null default '', condition text not null default 'good');
+alter table borrowed_books add column if not exists copy_id int references copies(id) on delete set null;
+create table if not exists stocktakes (id serial primary key, name text not null default '', shelves text[] not null default '{}', started_by int references authentication(id) on delete set null, started_at timestamp not null default current_timestamp, closed_at timestamp);
+create table if not exists stocktake_scans (id serial primary key, stocktake_id int not null references stocktakes(id) on delete cascade, barcode text not null, shelf text not null default '', scanned_at timestamp not null default current_timestamp, unique (stocktake_id, barcode));
+create table if not exists digital_items (id serial primary key, book_id int not null references books(id) on delete cascade, format text not null, file_key text not null, file_name text not null, content_type text not null, license text not null, copies int not null default 1, max_loans int not null default 0, license_expires_at timestamp, loan_days int not null default 14, loans_used int not null default 0, created_at timestamp not null default current_timestamp);
+create table if not exists digital_loans (id serial primary key, item_id int not null references digital_items(id) on delete cascade, user_id int not null references authentication(id) on delete cascade, borrowed_at timestamp not null default current_timestamp, expires_at timestamp not null, returned_at timestamp);
+create table if not exists purchase_suggestions (id serial primary key, user_id int references authentication(id) on delete set null, isbn text not null default '', title text not null, author text not null default '', year int not null default 0, publisher text not null default '', pages int not null default 0, note text not null default '', status text not null default 'suggested', book_id int references books(id) on delete set null, created_at timestamp not null default current_timestamp, updated_at timestamp not null default current_timestamp);
+create unique index if not exists purchase_suggestions_open_isbn on purchase_suggestions (isbn) where isbn <> '' and status in ('suggested', 'approved', 'ordered');
+create table if not exists suggestion_votes (suggestion_id int references purchase_suggestions(id) on delete cascade, user_id int references authentication(id) on delete cascade, primary key (suggestion_id, user_id));
+create table if not exists ledger (id serial primary key, user_id int not null, kind text not null, amount numeric(10, 2) not null, note text not null default '', created_by int not null default 0, created_at timestamp not null default current_timestamp, loan_id int);
+create index if not exists ledger_user_id on ledger (user_id, created_at);
+create table if not exists damage_reports (id serial primary key, copy_id int not null references copies(id) on delete cascade, loan_id int references borrowed_books(id) on delete set null, borrower_id int, condition text not null, notes text not null default '', photos text[] not null default '{}', charge_id int references ledger(id) on delete set null, reported_by int not null, resolution text not null default '', resolved_at timestamp, created_at timestamp not null default current_timestamp);
+create table if not exists age_overrides (user_id int not null, book_id int not null references books(id) on delete cascade, granted_by int not null, created_at timestamp not null default current_timestamp, primary key (user_id, book_id));
+create table if not exists loan_policies (id serial primary key, patron_type text not null, item_category text not null, loan_days int not null, max_loans int not null, max_renewals int not null, renewal_days int not null, updated_at timestamp not null default current_timestamp, fine_per_day numeric(10, 2) not null default 0.25, max_fine numeric(10, 2) not null default 10, grace_days int not null default 1, replacement_cost numeric(10, 2) not null default 25, guaranteed_days int not null default 14, recall_queue int not null default 0, unique (patron_type, item_category));
+create table if not exists loan_renewals (id serial primary key, loan_id int not null references borrowed_books(id) on delete cascade, old_due_date date not null, new_due_date date not null, renewed_by int not null, renewed_at timestamp not null default current_timestamp);
+create table if not exists block_rules (id int primary key default 1 check (id = 1), max_overdue int not null, max_balance numeric(10, 2) not null, updated_at timestamp not null default current_timestamp);
+create table if not exists suspensions (id serial primary key, user_id int not null references authentication(id) on delete cascade, reason text not null, until date, created_by int not null, created_at timestamp not null default current_timestamp, lifted_at timestamp);
+create table if not exists notifications (id serial primary key, user_id int not null references authentication(id) on delete cascade, subject text not null, message text not null, created_at timestamp not null default current_timestamp, read_at timestamp);
+create index if not exists notifications_user_id on notifications (user_id, created_at);
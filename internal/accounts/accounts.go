@@ -0,0 +1,177 @@
+package accounts
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	. "github.com/Phantomvv1/Library_management/internal/authentication"
+	"github.com/Phantomvv1/Library_management/internal/ledger"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// GetAccount returns the balance and the ledger of the caller, librarians can ask for any patron with "userID".
+func GetAccount(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && userID (optional)
+
+	token, _ := information["token"].(string)
+	userID, accountType, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return
+	}
+
+	if patronID, ok := information["userID"].(float64); ok && int(patronID) != userID {
+		if accountType != "librarian" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Error you can only see your own account"})
+			return
+		}
+		userID = int(patronID)
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error couldn't connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = ledger.CreateLedgerTable(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	balance, err := ledger.Balance(conn, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	entries, err := ledger.Entries(conn, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"userID": userID, "balance": balance, "entries": entries})
+}
+
+// RecordPayment records a cash payment a patron made at the desk.
+func RecordPayment(c *gin.Context) {
+	credit(c, ledger.KindPayment)
+}
+
+// WaiveFee forgives a patron part or all of what they owe, the reason is kept as the note of the waiver.
+func WaiveFee(c *gin.Context) {
+	credit(c, ledger.KindWaiver)
+}
+
+func credit(c *gin.Context, kind string) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && userID && amount && note (optional for payments) && loanID (optional)
+
+	token, _ := information["token"].(string)
+	librarianID, accountType, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return
+	}
+
+	if accountType != "librarian" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error only librarians can record payments and waive fees"})
+		return
+	}
+
+	userID, ok := information["userID"].(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided id of the user"})
+		return
+	}
+
+	amount, ok := information["amount"].(float64)
+	if !ok || !ledger.ValidAmount(amount) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ledger.ErrInvalidAmount.Error()})
+		return
+	}
+
+	note, _ := information["note"].(string)
+	if kind == ledger.KindWaiver && strings.TrimSpace(note) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error a reason for waiving the fee has to be given in the note"})
+		return
+	}
+
+	loanID, _ := information["loanID"].(float64)
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error couldn't connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = CreateAuthTable(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err = ledger.CreateLedgerTable(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating the account"})
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	// Locking the user keeps two payments at the same time from taking the balance below zero.
+	var check int
+	err = tx.QueryRow(context.Background(), "select id from authentication where id = $1 for update", int(userID)).Scan(&check)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Error there is no such user"})
+			return
+		}
+
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the user"})
+		return
+	}
+
+	entry, err := ledger.Credit(tx, int(userID), int(loanID), kind, amount, note, librarianID)
+	if err != nil {
+		if err == ledger.ErrOverpayment {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	balance, err := ledger.Balance(tx, int(userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating the account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entry": entry, "balance": balance})
+}
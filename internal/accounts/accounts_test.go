@@ -0,0 +1,98 @@
+package accounts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Phantomvv1/Library_management/internal/authentication"
+	"github.com/gin-gonic/gin"
+)
+
+var Token = ""
+
+func TestGetAccount(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/account", GetAccount)
+	router.POST("/login", authentication.LogIn)
+
+	rrLogin := httptest.NewRecorder()
+
+	jsonBody := []byte(`{"email": "kris@kris.com", "password": "passowrd"}`)
+	reqL, err := http.NewRequest(http.MethodPost, "http://localhost:42069/login", bytes.NewReader(jsonBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rrLogin.Result().Body.Close()
+
+	router.ServeHTTP(rrLogin, reqL)
+
+	if rrLogin.Code != http.StatusOK {
+		t.Fatal(rrLogin.Body)
+	}
+
+	var token map[string]string
+	json.NewDecoder(rrLogin.Body).Decode(&token)
+	Token = token["token"]
+
+	rr := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"token": "%s"}`, Token))
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/account", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+}
+
+func TestWaiveFeeWithoutReason(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/account/waive", WaiveFee)
+
+	rr := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"token": "%s", "userID": 1, "amount": 1.5}`, Token))
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/account/waive", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest && rr.Code != http.StatusForbidden {
+		t.Fatal(rr.Body)
+	}
+}
+
+func TestRecordPayment(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/account/payment", RecordPayment)
+
+	rr := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"token": "%s", "userID": 1, "amount": 0.5, "note": "cash"}`, Token))
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/account/payment", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK && rr.Code != http.StatusConflict && rr.Code != http.StatusForbidden {
+		t.Fatal(rr.Body)
+	}
+}
@@ -0,0 +1,507 @@
+package acquisitions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	. "github.com/Phantomvv1/Library_management/internal/authentication"
+	. "github.com/Phantomvv1/Library_management/internal/books"
+	"github.com/Phantomvv1/Library_management/internal/isbn"
+	"github.com/Phantomvv1/Library_management/internal/metadata"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+type Suggestion struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"userID"`
+	ISBN      string    `json:"isbn"`
+	Title     string    `json:"title"`
+	Author    string    `json:"author"`
+	Year      int       `json:"year"`
+	Publisher string    `json:"publisher"`
+	Pages     int       `json:"pages"`
+	Note      string    `json:"note"`
+	Status    string    `json:"status"`
+	BookID    int       `json:"bookID"`
+	Votes     int       `json:"votes"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// transitions lists the statuses a suggestion can move to from every status.
+var transitions = map[string][]string{
+	"suggested": {"approved", "rejected"},
+	"approved":  {"ordered", "rejected"},
+	"ordered":   {"received"},
+}
+
+// CanMove reports whether a suggestion in the status from can be moved to the status to.
+func CanMove(from, to string) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+const suggestionColumns = "s.id, coalesce(s.user_id, 0), s.isbn, s.title, s.author, s.year, s.publisher, s.pages, s.note, s.status, coalesce(s.book_id, 0), " +
+	"(select count(*) from suggestion_votes v where v.suggestion_id = s.id), s.created_at, s.updated_at"
+
+func (s *Suggestion) fields() []interface{} {
+	return []interface{}{&s.ID, &s.UserID, &s.ISBN, &s.Title, &s.Author, &s.Year, &s.Publisher, &s.Pages, &s.Note, &s.Status, &s.BookID, &s.Votes,
+		&s.CreatedAt, &s.UpdatedAt}
+}
+
+func createTables(conn *pgx.Conn) error {
+	if err := CreateCirculationTables(conn); err != nil {
+		return err
+	}
+
+	_, err := conn.Exec(context.Background(), "create table if not exists purchase_suggestions (id serial primary key, user_id int references authentication(id) on delete set null, "+
+		"isbn text not null default '', title text not null, author text not null default '', year int not null default 0, publisher text not null default '', "+
+		"pages int not null default 0, note text not null default '', status text not null default 'suggested', book_id int references books(id) on delete set null, "+
+		"created_at timestamp not null default current_timestamp, updated_at timestamp not null default current_timestamp);")
+	if err != nil {
+		log.Println(err)
+		return errors.New("Couldn't create a table for the purchase suggestions")
+	}
+
+	_, err = conn.Exec(context.Background(), "create unique index if not exists purchase_suggestions_open_isbn on purchase_suggestions (isbn) "+
+		"where isbn <> '' and status in ('suggested', 'approved', 'ordered');")
+	if err != nil {
+		log.Println(err)
+		return errors.New("Couldn't create a unique index for the ISBN of the purchase suggestions")
+	}
+
+	_, err = conn.Exec(context.Background(), "create table if not exists suggestion_votes (suggestion_id int references purchase_suggestions(id) on delete cascade, "+
+		"user_id int references authentication(id) on delete cascade, primary key (suggestion_id, user_id));")
+	if err != nil {
+		log.Println(err)
+		return errors.New("Couldn't create a table for the votes for purchase suggestions")
+	}
+
+	return nil
+}
+
+func getSuggestion(db Querier, id int) (Suggestion, error) {
+	var suggestion Suggestion
+	err := db.QueryRow(context.Background(), "select "+suggestionColumns+" from purchase_suggestions s where s.id = $1", id).Scan(suggestion.fields()...)
+	return suggestion, err
+}
+
+// SuggestPurchase lets a user ask the library to buy a book. With an ISBN the details are looked up, a book that is
+// already in the catalog can't be suggested and suggesting a book somebody else already suggested counts as a vote for it.
+func SuggestPurchase(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && (isbn | title && author) && note (optional)
+
+	token, _ := information["token"].(string)
+	userID, _, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return
+	}
+
+	suggestion := Suggestion{UserID: userID}
+	suggestion.Title, _ = information["title"].(string)
+	suggestion.Author, _ = information["author"].(string)
+	suggestion.Note, _ = information["note"].(string)
+
+	if isbnString, ok := information["isbn"].(string); ok && strings.TrimSpace(isbnString) != "" {
+		suggestion.ISBN, err = isbn.Canonical(isbnString)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		details, err := LookupMetadata(c.Request.Context(), suggestion.ISBN)
+		if err != nil && err != metadata.ErrNotFound {
+			log.Println(err)
+		}
+
+		if err == nil {
+			if suggestion.Title == "" {
+				suggestion.Title = details.Title
+			}
+
+			if suggestion.Author == "" {
+				suggestion.Author = strings.Join(details.Authors, ", ")
+			}
+			suggestion.Year = details.Year
+			suggestion.Publisher = details.Publisher
+			suggestion.Pages = details.Pages
+		}
+	}
+
+	if strings.TrimSpace(suggestion.Title) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error the title of the book is needed when it can't be found by its ISBN"})
+		return
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = createTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if suggestion.ISBN != "" {
+		existingID := 0
+		err = conn.QueryRow(context.Background(), "select id from books where isbn = $1", suggestion.ISBN).Scan(&existingID)
+		if err == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Error this book is already in the library", "bookID": existingID})
+			return
+		}
+
+		if err != pgx.ErrNoRows {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking the catalog"})
+			return
+		}
+
+		err = conn.QueryRow(context.Background(), "select "+suggestionColumns+" from purchase_suggestions s where s.isbn = $1 and s.status in ('suggested', 'approved', 'ordered')",
+			suggestion.ISBN).Scan(suggestion.fields()...)
+		if err == nil {
+			_, err = conn.Exec(context.Background(), "insert into suggestion_votes (suggestion_id, user_id) values ($1, $2) on conflict do nothing", suggestion.ID, userID)
+			if err != nil {
+				log.Println(err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error voting for the suggestion"})
+				return
+			}
+
+			suggestion, err = getSuggestion(conn, suggestion.ID)
+			if err != nil {
+				log.Println(err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the suggestion"})
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{"suggestion": suggestion, "message": "This book was already suggested, your vote was added to it"})
+			return
+		}
+
+		if err != pgx.ErrNoRows {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking the suggestions"})
+			return
+		}
+	}
+
+	err = conn.QueryRow(context.Background(), "insert into purchase_suggestions (user_id, isbn, title, author, year, publisher, pages, note) "+
+		"values ($1, $2, $3, $4, $5, $6, $7, $8) returning id", userID, suggestion.ISBN, suggestion.Title, suggestion.Author, suggestion.Year, suggestion.Publisher,
+		suggestion.Pages, suggestion.Note).Scan(&suggestion.ID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving the suggestion"})
+		return
+	}
+
+	_, err = conn.Exec(context.Background(), "insert into suggestion_votes (suggestion_id, user_id) values ($1, $2)", suggestion.ID, userID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error voting for the suggestion"})
+		return
+	}
+
+	suggestion, err = getSuggestion(conn, suggestion.ID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the suggestion"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"suggestion": suggestion})
+}
+
+// VoteForSuggestion adds the vote of the user to a suggestion, voting twice has no effect.
+func VoteForSuggestion(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && suggestionID
+
+	token, _ := information["token"].(string)
+	userID, _, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return
+	}
+
+	suggestionID, ok := information["suggestionID"].(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided id of the suggestion"})
+		return
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = createTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	suggestion, err := getSuggestion(conn, int(suggestionID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Error there is no such suggestion"})
+			return
+		}
+
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the suggestion"})
+		return
+	}
+
+	if suggestion.Status != "suggested" && suggestion.Status != "approved" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Error this suggestion can't be voted for anymore"})
+		return
+	}
+
+	_, err = conn.Exec(context.Background(), "insert into suggestion_votes (suggestion_id, user_id) values ($1, $2) on conflict do nothing", suggestion.ID, userID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error voting for the suggestion"})
+		return
+	}
+
+	suggestion, err = getSuggestion(conn, suggestion.ID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the suggestion"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"suggestion": suggestion})
+}
+
+// GetSuggestions lists the suggestions with the most voted first, optionally only the ones with ?status=.
+func GetSuggestions(c *gin.Context) {
+	status := c.Query("status")
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = createTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := conn.Query(context.Background(), "select "+suggestionColumns+" from purchase_suggestions s where $1 = '' or s.status = $1 "+
+		"order by 12 desc, s.created_at", status)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the suggestions"})
+		return
+	}
+	defer rows.Close()
+
+	suggestions := []Suggestion{}
+	for rows.Next() {
+		var suggestion Suggestion
+		if err = rows.Scan(suggestion.fields()...); err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error working with the suggestions"})
+			return
+		}
+
+		suggestions = append(suggestions, suggestion)
+	}
+
+	if rows.Err() != nil {
+		log.Println(rows.Err())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error working with the suggestions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"suggestions": suggestions})
+}
+
+// receive adds the received copies to the catalog, creating the book when there is no book with its ISBN yet,
+// and puts a copy on hold for the user who suggested it, the rest go to the patrons waiting for the book.
+func receive(tx pgx.Tx, suggestion *Suggestion, quantity int) error {
+	book := Book{ISBN: suggestion.ISBN, Title: suggestion.Title, Author: suggestion.Author, Year: int16(suggestion.Year), Publisher: suggestion.Publisher,
+		Pages: suggestion.Pages}
+
+	err := tx.QueryRow(context.Background(), "select id from books where isbn = $1", book.ISBN).Scan(&book.ID)
+	switch err {
+	case nil:
+		_, err = tx.Exec(context.Background(), "update books set quantity = quantity + $1 where id = $2", quantity, book.ID)
+	case pgx.ErrNoRows:
+		book.Quantity = quantity
+		book.ID, err = InsertBook(tx, book)
+	}
+	if err != nil {
+		log.Println(err)
+		return errors.New("Error adding the received book to the catalog")
+	}
+	suggestion.BookID = book.ID
+
+	// The user who suggested the book gets the first received copy instead of joining the back of the queue.
+	if suggestion.UserID != 0 {
+		if _, err = HoldFor(tx, book, suggestion.UserID); err != nil {
+			return err
+		}
+	}
+
+	return FulfilReservations(tx, book)
+}
+
+// UpdateSuggestionStatus moves a suggestion through approved, ordered and received (or rejected). Receiving it needs
+// the number of copies that arrived, they are added to the catalog and one is put on hold for the user who suggested the book.
+func UpdateSuggestionStatus(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && suggestionID && status && quantity && isbn (when received)
+
+	token, _ := information["token"].(string)
+	_, accountType, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return
+	}
+
+	if accountType != "librarian" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error only librarians can manage purchase suggestions"})
+		return
+	}
+
+	suggestionID, ok := information["suggestionID"].(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided id of the suggestion"})
+		return
+	}
+
+	status, _ := information["status"].(string)
+	quantity := 1
+	if value, ok := information["quantity"].(float64); ok {
+		quantity = int(value)
+	}
+
+	if status == "received" && quantity < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error at least one copy has to be received"})
+		return
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = createTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating the suggestion"})
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	currentStatus := ""
+	err = tx.QueryRow(context.Background(), "select status from purchase_suggestions where id = $1 for update", int(suggestionID)).Scan(&currentStatus)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Error there is no such suggestion"})
+			return
+		}
+
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the suggestion"})
+		return
+	}
+
+	if !CanMove(currentStatus, status) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Error a suggestion that is " + currentStatus + " can't become " + status})
+		return
+	}
+
+	suggestion, err := getSuggestion(tx, int(suggestionID))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the suggestion"})
+		return
+	}
+
+	if status == "received" {
+		if isbnString, ok := information["isbn"].(string); ok && isbnString != "" {
+			suggestion.ISBN, err = isbn.Canonical(isbnString)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		if suggestion.ISBN == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Error the ISBN of the received book is needed"})
+			return
+		}
+
+		if err = receive(tx, &suggestion, quantity); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	_, err = tx.Exec(context.Background(), "update purchase_suggestions set status = $1, isbn = $2, book_id = $3, updated_at = current_timestamp where id = $4",
+		status, suggestion.ISBN, nullableID(suggestion.BookID), suggestion.ID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating the suggestion"})
+		return
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating the suggestion"})
+		return
+	}
+
+	suggestion, err = getSuggestion(conn, suggestion.ID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the suggestion"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"suggestion": suggestion})
+}
+
+func nullableID(id int) *int {
+	if id == 0 {
+		return nil
+	}
+
+	return &id
+}
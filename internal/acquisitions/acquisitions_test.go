@@ -0,0 +1,155 @@
+package acquisitions
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Phantomvv1/Library_management/internal/authentication"
+	. "github.com/Phantomvv1/Library_management/internal/books"
+	"github.com/Phantomvv1/Library_management/internal/metadata"
+	"github.com/gin-gonic/gin"
+)
+
+var Token = ""
+var SuggestionID = 0
+
+func TestCanMove(t *testing.T) {
+	allowed := [][2]string{{"suggested", "approved"}, {"suggested", "rejected"}, {"approved", "ordered"}, {"approved", "rejected"}, {"ordered", "received"}}
+	for _, move := range allowed {
+		if !CanMove(move[0], move[1]) {
+			t.Fatalf("expected %s to become %s", move[0], move[1])
+		}
+	}
+
+	refused := [][2]string{{"suggested", "received"}, {"ordered", "rejected"}, {"received", "suggested"}, {"rejected", "approved"}, {"approved", "unknown"}}
+	for _, move := range refused {
+		if CanMove(move[0], move[1]) {
+			t.Fatalf("expected %s not to become %s", move[0], move[1])
+		}
+	}
+}
+
+func TestSuggestPurchase(t *testing.T) {
+	provider, _ := metadata.NewLocal("")
+	provider.Add(metadata.Metadata{ISBN: "9780306406157", Title: "Suggested title", Authors: []string{"Suggested author"}, Year: 2001})
+	SetMetadataProvider(provider)
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/suggestion", SuggestPurchase)
+	router.POST("/login", authentication.LogIn)
+
+	rr := httptest.NewRecorder()
+
+	jsonBody := []byte(`{"email": "kris@kris.com", "password": "passowrd"}`)
+	reader := bytes.NewReader(jsonBody)
+
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/login", reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+
+	var token map[string]string
+	json.NewDecoder(rr.Body).Decode(&token)
+	Token = token["token"]
+
+	suggestionRR := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"isbn": "0-306-40615-2", "note": "For the book club", "token": "%s"}`, Token))
+	reader = bytes.NewReader(body)
+
+	req, err = http.NewRequest(http.MethodPost, "http://localhost:42069/suggestion", reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer suggestionRR.Result().Body.Close()
+
+	router.ServeHTTP(suggestionRR, req)
+
+	if suggestionRR.Code != http.StatusOK && suggestionRR.Code != http.StatusConflict {
+		t.Fatal(suggestionRR.Body)
+	}
+
+	var response map[string]Suggestion
+	json.NewDecoder(suggestionRR.Body).Decode(&response)
+	SuggestionID = response["suggestion"].ID
+}
+
+func TestVoteForSuggestion(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/suggestion/vote", VoteForSuggestion)
+
+	rr := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"suggestionID": %d, "token": "%s"}`, SuggestionID, Token))
+	reader := bytes.NewReader(body)
+
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/suggestion/vote", reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK && rr.Code != http.StatusNotFound {
+		t.Fatal(rr.Body)
+	}
+}
+
+func TestGetSuggestions(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.GET("/suggestions", GetSuggestions)
+
+	rr := httptest.NewRecorder()
+
+	req, err := http.NewRequest(http.MethodGet, "http://localhost:42069/suggestions?status=suggested", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+}
+
+func TestUpdateSuggestionStatus(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/suggestion/status", UpdateSuggestionStatus)
+
+	for _, status := range []string{"approved", "ordered", "received"} {
+		rr := httptest.NewRecorder()
+
+		body := []byte(fmt.Sprintf(`{"suggestionID": %d, "status": "%s", "quantity": 2, "token": "%s"}`, SuggestionID, status, Token))
+		reader := bytes.NewReader(body)
+
+		req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/suggestion/status", reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rr.Result().Body.Close()
+
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatal(rr.Body)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package agerating
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	CategoryChild = "child"
+	CategoryTeen  = "teen"
+	CategoryAdult = "adult"
+)
+
+// MaxRating is the highest age rating a book can have, Unrestricted is the age of a reader who can read every book.
+const (
+	MaxRating    = 21
+	Unrestricted = 1 << 10
+)
+
+var Categories = []string{CategoryChild, CategoryTeen, CategoryAdult}
+
+var (
+	ErrInvalidRating    = errors.New("Error the age rating has to be a whole number between 0 and 21")
+	ErrInvalidCategory  = errors.New("Error the category has to be child, teen or adult")
+	ErrInvalidBirthDate = errors.New("Error the date of birth has to be a date in the past in the format YYYY-MM-DD")
+)
+
+// categoryAges are the ages assumed for the patrons without a date of birth.
+var categoryAges = map[string]int{
+	CategoryChild: 12,
+	CategoryTeen:  17,
+	CategoryAdult: Unrestricted,
+}
+
+func ValidRating(rating float64) bool {
+	return rating >= 0 && rating <= MaxRating && rating == float64(int(rating))
+}
+
+func ValidCategory(category string) bool {
+	_, ok := categoryAges[category]
+	return ok
+}
+
+// ParseBirthDate parses a date of birth, which can't be in the future.
+func ParseBirthDate(value string, now time.Time) (time.Time, error) {
+	birthDate, err := time.Parse(time.DateOnly, value)
+	if err != nil || birthDate.After(now) {
+		return time.Time{}, ErrInvalidBirthDate
+	}
+
+	return birthDate, nil
+}
+
+// Age returns how many full years old somebody born on birthDate is on now.
+func Age(birthDate, now time.Time) int {
+	age := now.Year() - birthDate.Year()
+	if now.Month() < birthDate.Month() || (now.Month() == birthDate.Month() && now.Day() < birthDate.Day()) {
+		age--
+	}
+
+	return age
+}
+
+// ReaderAge returns the age the ratings of the books are checked against, the date of birth wins over the category
+// and only adults without a date of birth are Unrestricted.
+func ReaderAge(birthDate *time.Time, category string, now time.Time) int {
+	if birthDate != nil {
+		return Age(*birthDate, now)
+	}
+
+	if age, ok := categoryAges[category]; ok {
+		return age
+	}
+
+	return Unrestricted
+}
+
+// Allowed reports whether a reader of age can read a book with the rating.
+func Allowed(rating, age int) bool {
+	return rating <= age
+}
@@ -0,0 +1,69 @@
+package agerating
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAge(t *testing.T) {
+	now := time.Date(2025, time.June, 15, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		birthDate time.Time
+		want      int
+	}{
+		{time.Date(2015, time.June, 15, 0, 0, 0, 0, time.UTC), 10},
+		{time.Date(2015, time.June, 16, 0, 0, 0, 0, time.UTC), 9},
+		{time.Date(2010, time.January, 1, 0, 0, 0, 0, time.UTC), 15},
+	}
+
+	for _, test := range tests {
+		if got := Age(test.birthDate, now); got != test.want {
+			t.Fatalf("Age(%v) = %d, want %d", test.birthDate, got, test.want)
+		}
+	}
+}
+
+func TestReaderAge(t *testing.T) {
+	now := time.Date(2025, time.June, 15, 0, 0, 0, 0, time.UTC)
+	child := time.Date(2017, time.March, 1, 0, 0, 0, 0, time.UTC)
+	adult := time.Date(1990, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	if age := ReaderAge(&child, CategoryAdult, now); age != 8 {
+		t.Fatalf("expected the date of birth to win over the category, got %d", age)
+	}
+
+	if age := ReaderAge(&adult, CategoryChild, now); age != 35 {
+		t.Fatalf("expected an adult with a date of birth to be their age, got %d", age)
+	}
+
+	young := time.Date(2006, time.January, 1, 0, 0, 0, 0, time.UTC)
+	if age := ReaderAge(&young, CategoryAdult, now); Allowed(MaxRating, age) {
+		t.Fatalf("expected a 19 year old not to read books rated %d, got the age %d", MaxRating, age)
+	}
+
+	if age := ReaderAge(nil, CategoryAdult, now); age != Unrestricted {
+		t.Fatalf("expected an adult without a date of birth to be unrestricted, got %d", age)
+	}
+
+	if age := ReaderAge(nil, CategoryTeen, now); age != 17 {
+		t.Fatalf("expected a teen to be 17, got %d", age)
+	}
+
+	if age := ReaderAge(nil, "", now); age != Unrestricted {
+		t.Fatalf("expected a patron without a category to be unrestricted, got %d", age)
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	if !Allowed(0, 5) || !Allowed(16, 16) || Allowed(18, 17) || !Allowed(MaxRating, Unrestricted) {
+		t.Fatal("unexpected result of Allowed")
+	}
+
+	if _, err := ParseBirthDate("2999-01-01", time.Now()); err != ErrInvalidBirthDate {
+		t.Fatal("expected a date of birth in the future to be refused")
+	}
+
+	if ValidRating(12.5) || ValidRating(-1) || !ValidRating(16) {
+		t.Fatal("unexpected result of ValidRating")
+	}
+}
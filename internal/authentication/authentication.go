@@ -12,17 +12,23 @@ import (
 	"regexp"
 	"time"
 
+	"github.com/Phantomvv1/Library_management/internal/agerating"
+	"github.com/Phantomvv1/Library_management/internal/ledger"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/jackc/pgx/v5"
 )
 
 type Profile struct {
-	ID      int      `json:"id"`
-	Name    string   `json:"name"`
-	Email   string   `json:"email"`
-	Type    string   `json:"type"`
-	History []string `json:"history"`
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Email      string     `json:"email"`
+	Type       string     `json:"type"`
+	History    []string   `json:"history"`
+	BirthDate  *time.Time `json:"birthDate"`
+	Category   string     `json:"category"`
+	Balance    float64    `json:"balance"`
+	CardNumber string     `json:"cardNumber"`
 }
 
 func GenerateJWT(id int, accountType string, email string) (string, error) {
@@ -83,12 +89,32 @@ func SHA512(text string) string {
 }
 
 func CreateAuthTable(conn *pgx.Conn) error {
-	_, err := conn.Exec(context.Background(), "create table if not exists authentication (id serial primary key, name text, email text, password text, type text, history text[]);")
+	_, err := conn.Exec(context.Background(), "create table if not exists authentication (id serial primary key, name text, email text, password text, type text);")
 	if err != nil {
 		log.Println(err)
 		return errors.New("Error creating a table for authentication")
 	}
 
+	_, err = conn.Exec(context.Background(), "alter table authentication add column if not exists birth_date date, "+
+		"add column if not exists category text not null default 'adult';")
+	if err != nil {
+		log.Println(err)
+		return errors.New("Error adding the age of the patrons to the table for authentication")
+	}
+
+	_, err = conn.Exec(context.Background(), "alter table authentication add column if not exists card_number text unique;")
+	if err != nil {
+		log.Println(err)
+		return errors.New("Error adding the library cards to the table for authentication")
+	}
+
+	// Every account gets a library card, the number is made from the id so it is known right after signing up.
+	_, err = conn.Exec(context.Background(), "update authentication set card_number = 'P' || lpad(id::text, 8, '0') where card_number is null;")
+	if err != nil {
+		log.Println(err)
+		return errors.New("Error giving library cards to the users")
+	}
+
 	return nil
 }
 
@@ -101,7 +127,7 @@ func SignUp(c *gin.Context) {
 	}
 
 	var information map[string]string
-	json.NewDecoder(c.Request.Body).Decode(&information) //name, email, password, type
+	json.NewDecoder(c.Request.Body).Decode(&information) //name, email, password, type, birthDate (optional), category (optional)
 
 	err = CreateAuthTable(conn)
 	if err != nil {
@@ -141,15 +167,43 @@ func SignUp(c *gin.Context) {
 		return
 	}
 
+	var birthDate *time.Time
+	if information["birthDate"] != "" {
+		date, err := agerating.ParseBirthDate(information["birthDate"], time.Now())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		birthDate = &date
+	}
+
+	category := information["category"]
+	if category == "" {
+		category = agerating.CategoryAdult
+	}
+
+	if !agerating.ValidCategory(category) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": agerating.ErrInvalidCategory.Error()})
+		return
+	}
+
 	hashedPassword := SHA512(information["password"])
-	_, err = conn.Exec(context.Background(), "insert into authentication (name, email, password, type, history) values ($1, $2, $3, $4, array[]::text[]);",
-		information["name"], information["email"], hashedPassword, information["type"])
+	var id int
+	err = conn.QueryRow(context.Background(), "insert into authentication (name, email, password, type, birth_date, category) values ($1, $2, $3, $4, $5, $6) returning id;",
+		information["name"], information["email"], hashedPassword, information["type"], birthDate, category).Scan(&id)
 	if err != nil {
 		log.Println(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error inserting the information into the database."})
 		return
 	}
 
+	_, err = conn.Exec(context.Background(), "update authentication set card_number = 'P' || lpad(id::text, 8, '0') where id = $1;", id)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error giving a library card to the user"})
+		return
+	}
+
 	c.JSON(http.StatusOK, nil)
 }
 
@@ -171,10 +225,9 @@ func LogIn(c *gin.Context) {
 	json.NewDecoder(c.Request.Body).Decode(&information) //email, password
 
 	var passwordCheck, name, email, typeOfAccount string
-	var history []string
 	var id int
-	err = conn.QueryRow(context.Background(), "select password, name, type, email, history, id from authentication a where a.email = $1;", information["email"]).Scan(
-		&passwordCheck, &name, &typeOfAccount, &email, &history, &id)
+	err = conn.QueryRow(context.Background(), "select password, name, type, email, id from authentication a where a.email = $1;", information["email"]).Scan(
+		&passwordCheck, &name, &typeOfAccount, &email, &id)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			log.Println(err)
@@ -203,6 +256,47 @@ func LogIn(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"token": jwtToken})
 }
 
+// LoanTitles returns the titles of the books the user has borrowed in the order they were first borrowed. The loans are kept
+// by the books package, which creates their table on the first loan.
+func LoanTitles(conn *pgx.Conn, userID int) ([]string, error) {
+	exists := false
+	err := conn.QueryRow(context.Background(), "select to_regclass('borrowed_books') is not null").Scan(&exists)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("Error getting the history of the user")
+	}
+
+	titles := []string{}
+	if !exists {
+		return titles, nil
+	}
+
+	rows, err := conn.Query(context.Background(), "select b.title from borrowed_books l join books b on b.id = l.book_id where l.user_id = $1 "+
+		"group by b.title order by min(coalesce(l.borrowed_at, l.returned_at)), b.title", userID)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("Error getting the history of the user")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		title := ""
+		if err = rows.Scan(&title); err != nil {
+			log.Println(err)
+			return nil, errors.New("Error working with the history of the user")
+		}
+
+		titles = append(titles, title)
+	}
+
+	if rows.Err() != nil {
+		log.Println(rows.Err())
+		return nil, errors.New("Error working with the history of the user")
+	}
+
+	return titles, nil
+}
+
 func GetCurrentProfile(c *gin.Context) {
 	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
 	if err != nil {
@@ -224,21 +318,48 @@ func GetCurrentProfile(c *gin.Context) {
 		return
 	}
 
-	var name, email string
-	var history []string
-	err = conn.QueryRow(context.Background(), "select name, email, history from authentication where id = $1", id).Scan(&name, &email, &history)
+	if err = CreateAuthTable(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var name, email, category, cardNumber string
+	var birthDate *time.Time
+	err = conn.QueryRow(context.Background(), "select name, email, birth_date, category, card_number from authentication where id = $1", id).Scan(
+		&name, &email, &birthDate, &category, &cardNumber)
 	if err != nil {
 		log.Println(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting information from the database"})
 		return
 	}
 
+	history, err := LoanTitles(conn, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err = ledger.CreateLedgerTable(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	balance, err := ledger.Balance(conn, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	UserProfile := Profile{
-		ID:      id,
-		Name:    name,
-		Email:   email,
-		Type:    accountType,
-		History: history,
+		ID:         id,
+		Name:       name,
+		Email:      email,
+		Type:       accountType,
+		History:    history,
+		BirthDate:  birthDate,
+		Category:   category,
+		Balance:    balance,
+		CardNumber: cardNumber,
 	}
 
 	c.JSON(http.StatusOK, gin.H{"profile information": UserProfile})
@@ -0,0 +1,80 @@
+package blocks
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrInvalidRules = errors.New("Error the maximum number of overdue books and the maximum balance can't be negative")
+	ErrNoReason     = errors.New("Error a reason for the suspension has to be given")
+	ErrInvalidUntil = errors.New("Error the end of the suspension has to be a date in the future formatted as YYYY-MM-DD")
+	ErrNoSuspension = errors.New("Error there is no such suspension")
+)
+
+// Rules decide when a patron can't borrow, reserve or renew any more.
+type Rules struct {
+	MaxOverdue int       `json:"maxOverdue"`
+	MaxBalance float64   `json:"maxBalance"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// DefaultRules are used until a librarian saves rules of their own.
+var DefaultRules = Rules{MaxOverdue: 0, MaxBalance: 5}
+
+// Suspension blocks a patron by hand, until the end date or, without one, until it is lifted.
+type Suspension struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"userID"`
+	Reason    string     `json:"reason"`
+	Until     *time.Time `json:"until"`
+	CreatedBy int        `json:"createdBy"`
+	CreatedAt time.Time  `json:"createdAt"`
+	LiftedAt  *time.Time `json:"liftedAt"`
+}
+
+// Standing is what the rules are checked against.
+type Standing struct {
+	Overdue     int          `json:"overdue"`
+	Balance     float64      `json:"balance"`
+	Suspensions []Suspension `json:"suspensions"`
+}
+
+func (r Rules) Validate() error {
+	if r.MaxOverdue < 0 || r.MaxBalance < 0 {
+		return ErrInvalidRules
+	}
+
+	return nil
+}
+
+// Active reports whether the suspension still blocks the patron on now.
+func (s Suspension) Active(now time.Time) bool {
+	return s.LiftedAt == nil && (s.Until == nil || s.Until.After(now))
+}
+
+// Reason explains why the rules block the patron on now, it is empty when they don't.
+func (r Rules) Reason(standing Standing, now time.Time) string {
+	for _, suspension := range standing.Suspensions {
+		if !suspension.Active(now) {
+			continue
+		}
+
+		if suspension.Until == nil {
+			return "your account is suspended: " + suspension.Reason
+		}
+
+		return "your account is suspended until " + suspension.Until.Format(time.DateOnly) + ": " + suspension.Reason
+	}
+
+	if standing.Overdue > r.MaxOverdue {
+		return fmt.Sprintf("you have %d overdue books and at most %d are allowed, please return them first", standing.Overdue, r.MaxOverdue)
+	}
+
+	if standing.Balance > r.MaxBalance {
+		return fmt.Sprintf("you owe %.2f and at most %.2f is allowed, please pay your fees first", standing.Balance, r.MaxBalance)
+	}
+
+	return ""
+}
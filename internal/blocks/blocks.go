@@ -0,0 +1,374 @@
+package blocks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	. "github.com/Phantomvv1/Library_management/internal/authentication"
+	"github.com/Phantomvv1/Library_management/internal/ledger"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const suspensionColumns = "id, user_id, reason, until, created_by, created_at, lifted_at"
+
+func (s *Suspension) fields() []interface{} {
+	return []interface{}{&s.ID, &s.UserID, &s.Reason, &s.Until, &s.CreatedBy, &s.CreatedAt, &s.LiftedAt}
+}
+
+func CreateBlocksTables(db ledger.DB) error {
+	_, err := db.Exec(context.Background(), "create table if not exists block_rules (id int primary key default 1 check (id = 1), max_overdue int not null, "+
+		"max_balance numeric(10, 2) not null, updated_at timestamp not null default current_timestamp);")
+	if err != nil {
+		log.Println(err)
+		return errors.New("Couldn't create a table for the blocking rules")
+	}
+
+	_, err = db.Exec(context.Background(), "create table if not exists suspensions (id serial primary key, user_id int not null references authentication(id) on delete cascade, "+
+		"reason text not null, until date, created_by int not null, created_at timestamp not null default current_timestamp, lifted_at timestamp);")
+	if err != nil {
+		log.Println(err)
+		return errors.New("Couldn't create a table for the suspensions")
+	}
+
+	return nil
+}
+
+// LoadRules returns the blocking rules, DefaultRules when none have been saved.
+func LoadRules(db ledger.DB) (Rules, error) {
+	rules := DefaultRules
+	err := db.QueryRow(context.Background(), "select max_overdue, max_balance::float8, updated_at from block_rules where id = 1").Scan(
+		&rules.MaxOverdue, &rules.MaxBalance, &rules.UpdatedAt)
+	if err != nil && err != pgx.ErrNoRows {
+		log.Println(err)
+		return Rules{}, errors.New("Error getting the blocking rules")
+	}
+
+	return rules, nil
+}
+
+// GetStanding counts the overdue loans, the balance and the suspensions of the user.
+func GetStanding(db ledger.DB, userID int) (Standing, error) {
+	standing := Standing{}
+	err := db.QueryRow(context.Background(), "select count(*) from borrowed_books where user_id = $1 and returned_at is null and missing = '' and return_date < current_date", userID).Scan(&standing.Overdue)
+	if err != nil {
+		log.Println(err)
+		return Standing{}, errors.New("Error counting the overdue books of the user")
+	}
+
+	if standing.Balance, err = ledger.Balance(db, userID); err != nil {
+		return Standing{}, err
+	}
+
+	rows, err := db.Query(context.Background(), "select "+suspensionColumns+" from suspensions where user_id = $1 order by created_at desc", userID)
+	if err != nil {
+		log.Println(err)
+		return Standing{}, errors.New("Error getting the suspensions of the user")
+	}
+	defer rows.Close()
+
+	standing.Suspensions = []Suspension{}
+	for rows.Next() {
+		var suspension Suspension
+		if err = rows.Scan(suspension.fields()...); err != nil {
+			log.Println(err)
+			return Standing{}, errors.New("Error working with the suspensions of the user")
+		}
+
+		standing.Suspensions = append(standing.Suspensions, suspension)
+	}
+
+	if rows.Err() != nil {
+		log.Println(rows.Err())
+		return Standing{}, errors.New("Error working with the suspensions of the user")
+	}
+
+	return standing, nil
+}
+
+// Check returns why the user can't borrow, reserve or renew books, or an empty string when they can.
+func Check(db ledger.DB, userID int) (string, error) {
+	rules, err := LoadRules(db)
+	if err != nil {
+		return "", err
+	}
+
+	standing, err := GetStanding(db, userID)
+	if err != nil {
+		return "", err
+	}
+
+	return rules.Reason(standing, time.Now()), nil
+}
+
+func GetBlockRules(c *gin.Context) {
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = CreateBlocksTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rules, err := LoadRules(conn)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rules": rules})
+}
+
+func SaveBlockRules(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && maxOverdue && maxBalance
+
+	token, _ := information["token"].(string)
+	_, accountType, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return
+	}
+
+	if accountType != "librarian" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error only librarians can change the blocking rules"})
+		return
+	}
+
+	maxOverdue, ok := information["maxOverdue"].(float64)
+	if !ok || maxOverdue != float64(int(maxOverdue)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error maxOverdue has to be a whole number"})
+		return
+	}
+
+	maxBalance, ok := information["maxBalance"].(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error maxBalance has to be a number"})
+		return
+	}
+
+	rules := Rules{MaxOverdue: int(maxOverdue), MaxBalance: maxBalance}
+	if err = rules.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = CreateBlocksTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = conn.QueryRow(context.Background(), "insert into block_rules (id, max_overdue, max_balance) values (1, $1, $2) on conflict (id) do update set "+
+		"max_overdue = excluded.max_overdue, max_balance = excluded.max_balance, updated_at = current_timestamp returning updated_at",
+		rules.MaxOverdue, rules.MaxBalance).Scan(&rules.UpdatedAt)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving the blocking rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rules": rules})
+}
+
+// SuspendUser blocks a patron by hand with a reason, until the given date or until the suspension is lifted.
+func SuspendUser(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && userID && reason && until (optional)
+
+	token, _ := information["token"].(string)
+	librarianID, accountType, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return
+	}
+
+	if accountType != "librarian" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error only librarians can suspend users"})
+		return
+	}
+
+	userID, ok := information["userID"].(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided id of the user"})
+		return
+	}
+
+	reason, _ := information["reason"].(string)
+	suspension := Suspension{UserID: int(userID), Reason: strings.TrimSpace(reason), CreatedBy: librarianID}
+	if suspension.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrNoReason.Error()})
+		return
+	}
+
+	if until, ok := information["until"].(string); ok && until != "" {
+		date, err := time.Parse(time.DateOnly, until)
+		if err != nil || !date.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidUntil.Error()})
+			return
+		}
+		suspension.Until = &date
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = CreateAuthTable(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err = CreateBlocksTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = conn.QueryRow(context.Background(), "insert into suspensions (user_id, reason, until, created_by) values ($1, $2, $3, $4) returning id, created_at",
+		suspension.UserID, suspension.Reason, suspension.Until, suspension.CreatedBy).Scan(&suspension.ID, &suspension.CreatedAt)
+	if err != nil {
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "23503" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Error there is no such user"})
+			return
+		}
+
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error suspending the user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"suspension": suspension})
+}
+
+func LiftSuspension(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && id
+
+	token, _ := information["token"].(string)
+	_, accountType, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return
+	}
+
+	if accountType != "librarian" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error only librarians can lift suspensions"})
+		return
+	}
+
+	id, ok := information["id"].(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided id of the suspension"})
+		return
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = CreateBlocksTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var suspension Suspension
+	err = conn.QueryRow(context.Background(), "update suspensions set lifted_at = coalesce(lifted_at, current_timestamp) where id = $1 returning "+suspensionColumns,
+		int(id)).Scan(suspension.fields()...)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": ErrNoSuspension.Error()})
+			return
+		}
+
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error lifting the suspension"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"suspension": suspension})
+}
+
+// GetUserStanding tells the caller whether they can borrow and why not, librarians can ask for any patron with "userID".
+func GetUserStanding(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && userID (optional)
+
+	token, _ := information["token"].(string)
+	userID, accountType, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return
+	}
+
+	if patronID, ok := information["userID"].(float64); ok && int(patronID) != userID {
+		if accountType != "librarian" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Error you can only see your own standing"})
+			return
+		}
+		userID = int(patronID)
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = ledger.CreateLedgerTable(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err = CreateBlocksTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rules, err := LoadRules(conn)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	standing, err := GetStanding(conn, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	reason := rules.Reason(standing, time.Now())
+	c.JSON(http.StatusOK, gin.H{"standing": standing, "rules": rules, "blocked": reason != "", "reason": reason})
+}
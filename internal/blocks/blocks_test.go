@@ -0,0 +1,115 @@
+package blocks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Phantomvv1/Library_management/internal/authentication"
+	"github.com/gin-gonic/gin"
+)
+
+func TestReason(t *testing.T) {
+	now := time.Date(2025, time.May, 10, 12, 0, 0, 0, time.UTC)
+	past := time.Date(2025, time.May, 1, 0, 0, 0, 0, time.UTC)
+	future := time.Date(2025, time.June, 1, 0, 0, 0, 0, time.UTC)
+	rules := Rules{MaxOverdue: 1, MaxBalance: 5}
+
+	tests := []struct {
+		name     string
+		standing Standing
+		blocked  bool
+	}{
+		{"good standing", Standing{Overdue: 1, Balance: 5}, false},
+		{"too many overdue", Standing{Overdue: 2}, true},
+		{"owes too much", Standing{Balance: 5.01}, true},
+		{"suspended", Standing{Suspensions: []Suspension{{Reason: "damaged books", Until: &future}}}, true},
+		{"suspended without an end", Standing{Suspensions: []Suspension{{Reason: "damaged books"}}}, true},
+		{"suspension over", Standing{Suspensions: []Suspension{{Reason: "damaged books", Until: &past}}}, false},
+		{"suspension lifted", Standing{Suspensions: []Suspension{{Reason: "damaged books", LiftedAt: &past}}}, false},
+	}
+
+	for _, test := range tests {
+		if reason := rules.Reason(test.standing, now); (reason != "") != test.blocked {
+			t.Fatalf("%s: unexpected reason %q", test.name, reason)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := (Rules{MaxOverdue: -1}).Validate(); err != ErrInvalidRules {
+		t.Fatalf("expected ErrInvalidRules, got %v", err)
+	}
+
+	if err := DefaultRules.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+var Token = ""
+
+func TestGetUserStanding(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/user/standing", GetUserStanding)
+	router.POST("/login", authentication.LogIn)
+
+	rrLogin := httptest.NewRecorder()
+
+	jsonBody := []byte(`{"email": "kris@kris.com", "password": "passowrd"}`)
+	reqL, err := http.NewRequest(http.MethodPost, "http://localhost:42069/login", bytes.NewReader(jsonBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rrLogin.Result().Body.Close()
+
+	router.ServeHTTP(rrLogin, reqL)
+
+	if rrLogin.Code != http.StatusOK {
+		t.Fatal(rrLogin.Body)
+	}
+
+	var token map[string]string
+	json.NewDecoder(rrLogin.Body).Decode(&token)
+	Token = token["token"]
+
+	rr := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"token": "%s"}`, Token))
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/user/standing", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+}
+
+func TestSuspendUserWithoutReason(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/user/suspend", SuspendUser)
+
+	rr := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"token": "%s", "userID": 1}`, Token))
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/user/suspend", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest && rr.Code != http.StatusForbidden {
+		t.Fatal(rr.Body)
+	}
+}
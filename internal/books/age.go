@@ -0,0 +1,196 @@
+package books
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Phantomvv1/Library_management/internal/agerating"
+	. "github.com/Phantomvv1/Library_management/internal/authentication"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// ageFilter keeps the books a reader of age $1 can see, the rated ones a librarian allowed the reader $2 to borrow included.
+const ageFilter = "(books.age_rating <= $1 or exists (select 1 from age_overrides o where o.book_id = books.id and o.user_id = $2))"
+
+func createAgeOverridesTable(conn *pgx.Conn) error {
+	_, err := conn.Exec(context.Background(), "create table if not exists age_overrides (user_id int not null, book_id int not null references books(id) on delete cascade, "+
+		"granted_by int not null, created_at timestamp not null default current_timestamp, primary key (user_id, book_id));")
+	if err != nil {
+		log.Println(err)
+		return errors.New("Couldn't create a table for the exceptions to the age ratings")
+	}
+
+	return nil
+}
+
+// readerAge returns the age the age ratings are checked against for the user, librarians can see every book.
+func readerAge(db Querier, userID int, accountType string) (int, error) {
+	if accountType == "librarian" {
+		return agerating.Unrestricted, nil
+	}
+
+	var birthDate *time.Time
+	category := ""
+	err := db.QueryRow(context.Background(), "select birth_date, category from authentication where id = $1", userID).Scan(&birthDate, &category)
+	if err != nil {
+		log.Println(err)
+		return 0, errors.New("Error getting the age of the user")
+	}
+
+	return agerating.ReaderAge(birthDate, category, time.Now()), nil
+}
+
+// OptionalReader returns the age and the id of the reader the token belongs to, anybody without a token sees the whole catalog.
+func OptionalReader(conn *pgx.Conn, token string) (int, int, error) {
+	if token == "" {
+		return agerating.Unrestricted, 0, nil
+	}
+
+	userID, accountType, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		return 0, 0, errors.New("Error invalid token")
+	}
+
+	if err = CreateAuthTable(conn); err != nil {
+		return 0, 0, err
+	}
+
+	age, err := readerAge(conn, userID, accountType)
+	return age, userID, err
+}
+
+// CheckAgeRating makes sure the user can borrow or reserve the book, an e-book included, it returns the status to answer with when not.
+func CheckAgeRating(db Querier, userID int, accountType string, book Book) (int, error) {
+	age, err := readerAge(db, userID, accountType)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if agerating.Allowed(book.AgeRating, age) {
+		return http.StatusOK, nil
+	}
+
+	allowed := false
+	err = db.QueryRow(context.Background(), "select exists (select 1 from age_overrides where user_id = $1 and book_id = $2)", userID, book.ID).Scan(&allowed)
+	if err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, errors.New("Error checking the age rating of the book")
+	}
+
+	if !allowed {
+		return http.StatusForbidden, errors.New("Error this book is rated " + strconv.Itoa(book.AgeRating) + "+, ask a librarian if you want to borrow it")
+	}
+
+	return http.StatusOK, nil
+}
+
+// applyAgeRating validates the "ageRating" in information and applies it to book, it returns the changed field like applyBookChanges.
+func applyAgeRating(book *Book, information map[string]interface{}) ([][3]string, error) {
+	value, ok := information["ageRating"]
+	if !ok {
+		return nil, nil
+	}
+
+	rating, ok := value.(float64)
+	if !ok || !agerating.ValidRating(rating) {
+		return nil, agerating.ErrInvalidRating
+	}
+
+	if int(rating) == book.AgeRating {
+		return nil, nil
+	}
+
+	changes := [][3]string{{"ageRating", strconv.Itoa(book.AgeRating), strconv.Itoa(int(rating))}}
+	book.AgeRating = int(rating)
+
+	return changes, nil
+}
+
+// GrantAgeOverride lets a librarian allow a patron to see, borrow and reserve a book above the age of the patron,
+// or take the permission back with "revoke".
+func GrantAgeOverride(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && userID && (id | isbn | barcode | title) && revoke (optional)
+
+	token, _ := information["token"].(string)
+	librarianID, accountType, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return
+	}
+
+	if accountType != "librarian" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error only librarians can make exceptions to the age ratings"})
+		return
+	}
+
+	userID, ok := information["userID"].(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided id of the user"})
+		return
+	}
+	revoke, _ := information["revoke"].(bool)
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error couldn't connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = CreateCirculationTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	book, _, err := ResolveBook(conn, information)
+	if err != nil {
+		respondResolveError(c, err)
+		return
+	}
+
+	if revoke {
+		_, err = conn.Exec(context.Background(), "delete from age_overrides where user_id = $1 and book_id = $2", int(userID), book.ID)
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error removing the exception to the age rating"})
+			return
+		}
+
+		c.JSON(http.StatusOK, nil)
+		return
+	}
+
+	check := 0
+	err = conn.QueryRow(context.Background(), "select id from authentication where id = $1", int(userID)).Scan(&check)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Error there is no user with this id"})
+			return
+		}
+
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the user"})
+		return
+	}
+
+	_, err = conn.Exec(context.Background(), "insert into age_overrides (user_id, book_id, granted_by) values ($1, $2, $3) on conflict do nothing",
+		int(userID), book.ID, librarianID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving the exception to the age rating"})
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
@@ -10,26 +10,53 @@ import (
 	"os"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	. "github.com/Phantomvv1/Library_management/internal/authentication"
+	"github.com/Phantomvv1/Library_management/internal/blocks"
+	"github.com/Phantomvv1/Library_management/internal/holds"
+	"github.com/Phantomvv1/Library_management/internal/isbn"
+	"github.com/Phantomvv1/Library_management/internal/policies"
 	. "github.com/Phantomvv1/Library_management/internal/users"
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 type Book struct {
-	ID       int    `json:"id"`
-	ISBN     string `json:"isbn"`
-	Title    string `json:"title"`
-	Author   string `json:"author"`
-	Year     int16  `json:"year"`
-	Quantity int    `json:"quantity"`
+	ID         int               `json:"id"`
+	ISBN       string            `json:"isbn"`
+	Title      string            `json:"title"`
+	Author     string            `json:"author"`
+	Year       int16             `json:"year"`
+	Quantity   int               `json:"quantity"`
+	Subjects   []string          `json:"subjects"`
+	Publisher  string            `json:"publisher"`
+	Pages      int               `json:"pages"`
+	CoverURL   string            `json:"coverURL"`
+	Thumbnails map[string]string `json:"thumbnails"`
+	WorkID     int               `json:"workID"`
+	Version    int               `json:"version"`
+	CallNumber string            `json:"callNumber"`
+	Scheme     string            `json:"callNumberScheme"`
+	AgeRating  int               `json:"ageRating"`
+	Category   string            `json:"itemCategory"`
 }
 
-func cancelBookReservation(conn *pgx.Conn, userID, bookID int) error {
-	check := 0
-	err := conn.QueryRow(context.Background(), "delete from book_reservations where user_id = $1 and book_id = $2 returning id", userID, bookID).Scan(&check)
+const bookColumns = "id, isbn, title, author, year, quantity, subjects, publisher, pages, cover_url, thumbnails, coalesce(work_id, 0), version, call_number, call_number_scheme, age_rating, item_category"
+
+// fields returns the destinations for scanning the columns listed in bookColumns.
+func (b *Book) fields() []interface{} {
+	return []interface{}{&b.ID, &b.ISBN, &b.Title, &b.Author, &b.Year, &b.Quantity, &b.Subjects, &b.Publisher, &b.Pages, &b.CoverURL, &b.Thumbnails, &b.WorkID, &b.Version,
+		&b.CallNumber, &b.Scheme, &b.AgeRating, &b.Category}
+}
+
+func cancelBookReservation(conn Querier, userID, bookID int) error {
+	var status string
+	var copyID int
+	err := conn.QueryRow(context.Background(), "delete from book_reservations where user_id = $1 and book_id = $2 and status in ('waiting', 'ready') returning status, coalesce(copy_id, 0)",
+		userID, bookID).Scan(&status, &copyID)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return errors.New("Error there was no reservation for a book with this id")
@@ -38,19 +65,69 @@ func cancelBookReservation(conn *pgx.Conn, userID, bookID int) error {
 		return errors.New("Error unable to delete the book correctly")
 	}
 
+	if status == holds.StatusReady {
+		return releaseHold(conn, bookID, copyID)
+	}
+
 	return nil
 }
 
-func borrowBook(conn *pgx.Conn, userID int, book Book, returnDate time.Time) error {
-	_, err := conn.Exec(context.Background(), "insert into borrowed_books (book_id, user_id, return_date) values ($1, $2, $3)", book.ID, userID, returnDate)
+// lockBook locks the book until the end of the transaction and returns its quantity. Every loan, return and reservation
+// locks the book first, so the ones for the same book happen one after another and the last copy can't be lent twice.
+func lockBook(tx Querier, bookID int) (int, error) {
+	quantity := 0
+	err := tx.QueryRow(context.Background(), "select quantity from books where id = $1 for update", bookID).Scan(&quantity)
+	if err != nil {
+		log.Println(err)
+		return 0, errors.New("Error getting the quantity of the book")
+	}
+
+	return quantity, nil
+}
+
+// lockUser locks the user until the end of the transaction, so the loans they take at the same time are counted one after another.
+func lockUser(tx Querier, userID int) error {
+	var check int
+	err := tx.QueryRow(context.Background(), "select id from authentication where id = $1 for update", userID).Scan(&check)
 	if err != nil {
 		log.Println(err)
-		return errors.New("Unable to put the information about the borrowed book in the table")
+		return errors.New("Error getting the user")
 	}
 
 	return nil
 }
 
+// borrowBook records the loan and returns its id, copyID is 0 when the borrower didn't scan the barcode of a specific copy.
+// lentBy is the librarian who lent the book at the desk, 0 when the borrower took it themselves.
+func borrowBook(conn Querier, userID int, book Book, copyID int, returnDate time.Time, lentBy int, override string) (int, error) {
+	var copy, librarian *int
+	if copyID != 0 {
+		copy = &copyID
+	}
+
+	if lentBy != 0 {
+		librarian = &lentBy
+	}
+
+	var loanID int
+	err := conn.QueryRow(context.Background(), "insert into borrowed_books (book_id, user_id, return_date, copy_id, lent_by, override_reason) values ($1, $2, $3, $4, $5, $6) returning id",
+		book.ID, userID, returnDate, copy, librarian, override).Scan(&loanID)
+	if err != nil {
+		log.Println(err)
+		return 0, errors.New("Unable to put the information about the borrowed book in the table")
+	}
+
+	if copyID != 0 {
+		_, err = conn.Exec(context.Background(), "update copies set status = 'borrowed' where id = $1", copyID)
+		if err != nil {
+			log.Println(err)
+			return 0, errors.New("Unable to mark the copy as borrowed")
+		}
+	}
+
+	return loanID, nil
+}
+
 func createBorrowedBooksTable(conn *pgx.Conn) error {
 	_, err := conn.Exec(context.Background(), "create table if not exists borrowed_books (id serial primary key not null, book_id int, user_id int, return_date date);")
 	if err != nil {
@@ -58,89 +135,191 @@ func createBorrowedBooksTable(conn *pgx.Conn) error {
 		return errors.New("Unable to create a table for keeping the borrowed books in.")
 	}
 
+	_, err = conn.Exec(context.Background(), "alter table borrowed_books add column if not exists borrowed_at timestamp, alter column borrowed_at set default current_timestamp, "+
+		"add column if not exists returned_at timestamp, add column if not exists renewals int not null default 0, "+
+		"add column if not exists lent_by int, add column if not exists override_reason text not null default '', "+
+		"add column if not exists migrated boolean not null default false, alter column borrowed_at drop not null, "+
+		"add column if not exists missing text not null default '', add column if not exists missing_since timestamp, "+
+		"add column if not exists recalled_at timestamp, add column if not exists recalled_by int;")
+	if err != nil {
+		log.Println(err)
+		return errors.New("Unable to add the dates of borrowing and returning to the borrowed books")
+	}
+
 	return nil
 }
 
-func updateHistory(conn *pgx.Conn, book Book, userID int) error {
-	var history []string
-	err := conn.QueryRow(context.Background(), "select history from authentication a where a.id = $1 limit 1;", userID).Scan(&history)
+// FulfilReservations puts the copies of the book on the shelf aside for the users who reserved it, first come first served.
+// It locks the book, so it should run in the transaction that put the copies back on the shelf.
+func FulfilReservations(conn Querier, book Book) error {
+	var err error
+	if book.Quantity, err = lockBook(conn, book.ID); err != nil {
+		return err
+	}
+
+	var rowsCount int
+	err = conn.QueryRow(context.Background(), "select count(*) from book_reservations where book_id = $1 and status = 'waiting'", book.ID).Scan(&rowsCount)
 	if err != nil {
 		log.Println(err)
-		return errors.New("Couldn't get the history of the user")
+		return errors.New("Error counting the reservations for this book.")
 	}
 
-	for _, title := range history {
-		if title == book.Title {
-			return nil
+	for range min(book.Quantity, rowsCount) {
+		if _, err = holdNextReservation(conn, book, 0); err != nil {
+			return err
 		}
 	}
 
-	_, err = conn.Exec(context.Background(), "update authentication set history = array_append(history, $1) where id = $2;", book.Title, userID)
+	return nil
+}
+
+func CreateBookReservationsTable(conn *pgx.Conn) error {
+	_, err := conn.Exec(context.Background(), "create table if not exists book_reservations (id serial primary key, book_id int, user_id int);")
+	if err != nil {
+		log.Println(err)
+		return errors.New("Couldn't create a table for story the books reserved from customers.")
+	}
+
+	_, err = conn.Exec(context.Background(), "alter table book_reservations add column if not exists status text not null default 'waiting', "+
+		"add column if not exists created_at timestamp not null default current_timestamp, add column if not exists ready_at timestamp, "+
+		"add column if not exists pickup_by date, add column if not exists copy_id int;")
 	if err != nil {
 		log.Println(err)
-		return errors.New("Error updating the history of this person")
+		return errors.New("Couldn't add the pickup of the reserved books to their table")
 	}
 
 	return nil
 }
 
-func borrowReservedBooks(conn *pgx.Conn, book Book) error {
-	var userID int
-	err := conn.QueryRow(context.Background(), "select book_id, user_id from book_reservations b where b.book_id = $1 order by b.id asc limit 1;", book.ID).Scan(&book.ID, &userID)
+// createWorksTables creates the series and the works that group the different editions (rows in books) of the same book.
+func createWorksTables(conn *pgx.Conn) error {
+	_, err := conn.Exec(context.Background(), "create table if not exists series (id serial primary key, name text not null, description text not null default '');")
 	if err != nil {
-		if err == pgx.ErrNoRows { //no reservations for this book
-			return nil
-		}
+		log.Println(err)
+		return errors.New("Couldn't create a table for series")
+	}
 
+	_, err = conn.Exec(context.Background(), "create table if not exists works (id serial primary key, title text not null, author text not null default '', "+
+		"series_id int references series(id) on delete set null, series_number numeric);")
+	if err != nil {
 		log.Println(err)
-		return errors.New("Error checking if the book is reserved")
+		return errors.New("Couldn't create a table for works")
+	}
+
+	return nil
+}
+
+func CreateBookTable(conn *pgx.Conn) error {
+	if err := createWorksTables(conn); err != nil {
+		return err
 	}
 
-	_, err = conn.Exec(context.Background(), "update books set quantity = quantity - 1 where id = $1;", book.ID)
+	_, err := conn.Exec(context.Background(), "create table if not exists books (id serial primary key, isbn text unique, title text, author text, year int, "+
+		"quantity int);")
 	if err != nil {
 		log.Println(err)
-		return errors.New("Error updating the database")
+		return errors.New("Couldn't create a table for books")
 	}
 
-	err = updateHistory(conn, book, userID)
+	// Tables made before the ISBNs were unique get the index from "catalog migrate-isbns", their ISBNs may have to be fixed first.
+	_, err = conn.Exec(context.Background(), "alter table books add column if not exists subjects text[] not null default '{}', "+
+		"add column if not exists publisher text not null default '', add column if not exists pages int not null default 0, "+
+		"add column if not exists cover_url text not null default '', add column if not exists thumbnails jsonb not null default '{}', "+
+		"add column if not exists work_id int references works(id) on delete set null, add column if not exists version int not null default 1;")
 	if err != nil {
 		log.Println(err)
-		return err
+		return errors.New("Couldn't add the details of the books to the table")
 	}
 
-	_, err = conn.Exec(context.Background(), "delete from book_reservations where book_id = $1 and user_id = $2", book.ID, userID)
+	_, err = conn.Exec(context.Background(), "alter table books add column if not exists call_number text not null default '', "+
+		"add column if not exists call_number_scheme text not null default '', add column if not exists call_number_key text not null default '', "+
+		"add column if not exists dewey_class text not null default '';")
 	if err != nil {
 		log.Println(err)
-		return errors.New("Error removing the borrowing the reserved book")
+		return errors.New("Couldn't add the call numbers to the books")
 	}
 
-	return nil
+	// The keys are compared byte by byte, the collation of the database would sort the punctuation in them its own way.
+	_, err = conn.Exec(context.Background(), "drop index if exists books_call_number_key;")
+	if err != nil {
+		log.Println(err)
+		return errors.New("Couldn't create an index for the call numbers of the books")
+	}
 
-}
+	_, err = conn.Exec(context.Background(), "create index if not exists books_call_number_key_c on books (call_number_scheme, (call_number_key collate \"C\"), id);")
+	if err != nil {
+		log.Println(err)
+		return errors.New("Couldn't create an index for the call numbers of the books")
+	}
 
-func CreateBookReservationsTable(conn *pgx.Conn) error {
-	_, err := conn.Exec(context.Background(), "create table if not exists book_reservations (id serial primary key, book_id int, user_id int);")
+	_, err = conn.Exec(context.Background(), "alter table books add column if not exists age_rating int not null default 0, "+
+		"add column if not exists item_category text not null default 'standard';")
 	if err != nil {
 		log.Println(err)
-		return errors.New("Couldn't create a table for story the books reserved from customers.")
+		return errors.New("Couldn't add the age ratings and the categories to the books")
 	}
 
-	return nil
+	return createAgeOverridesTable(conn)
 }
 
-func CreateBookTable(conn *pgx.Conn) error {
-	_, err := conn.Exec(context.Background(), "create table if not exists books (id serial primary key, isbn text, title text, author text, year int, "+
-		"quantity int);")
+// InsertBook adds a book to the catalog and returns its id.
+func InsertBook(conn Querier, book Book) (int, error) {
+	if book.Subjects == nil {
+		book.Subjects = []string{}
+	}
+
+	if book.Category == "" {
+		book.Category = policies.ItemDefault
+	}
+
+	id := 0
+	err := conn.QueryRow(context.Background(), "insert into books (isbn, title, author, year, quantity, subjects, publisher, pages, cover_url, "+
+		"call_number, call_number_scheme, call_number_key, dewey_class, age_rating, item_category) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15) returning id;",
+		book.ISBN, book.Title, book.Author, book.Year, book.Quantity, book.Subjects, book.Publisher, book.Pages, book.CoverURL,
+		book.CallNumber, book.Scheme, callNumberKey(book), deweyClass(book), book.AgeRating, book.Category).Scan(&id)
+	return id, err
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// bookIDFromQuery reads the book from the "id" or the "isbn" query parameter.
+func bookIDFromQuery(conn *pgx.Conn, c *gin.Context) (int, error) {
+	params := c.Request.URL.Query()
+	if isbnString := params.Get("isbn"); isbnString != "" {
+		return findBookIDByISBN(conn, isbnString)
+	}
+
+	idString := params.Get("id")
+	if idString == "" {
+		return 0, errors.New("Error no id or isbn provided")
+	}
+
+	id, err := strconv.Atoi(idString)
 	if err != nil {
-		log.Println(err)
-		return errors.New("Couldn't create a table for books")
+		return 0, errors.New("Error unable to parse the id of the book")
 	}
 
-	return nil
+	return id, nil
+}
+
+func findBookIDByISBN(db Querier, isbnString string) (int, error) {
+	canonical, err := isbn.Canonical(isbnString)
+	if err != nil {
+		return 0, err
+	}
+
+	id := 0
+	err = db.QueryRow(context.Background(), "select id from books b where b.isbn = $1", canonical).Scan(&id)
+	return id, err
 }
-func getBooks(conn *pgx.Conn) ([]Book, error) {
+
+// getBooks returns the books a reader of age (and with the id userID) is allowed to see.
+func getBooks(conn *pgx.Conn, age, userID int) ([]Book, error) {
 	var bookList []Book
-	rows, err := conn.Query(context.Background(), "select id, isbn, title, author, year, quantity from books order by id;")
+	rows, err := conn.Query(context.Background(), "select "+bookColumns+" from books where "+ageFilter+" order by id;", age, userID)
 	if err != nil {
 		log.Println(err)
 		return nil, errors.New("Failed to fetch books")
@@ -148,7 +327,7 @@ func getBooks(conn *pgx.Conn) ([]Book, error) {
 
 	for rows.Next() {
 		var book Book
-		err = rows.Scan(&book.ID, &book.ISBN, &book.Title, &book.Author, &book.Year, &book.Quantity)
+		err = rows.Scan(book.fields()...)
 		if err != nil {
 			log.Println(err)
 			return nil, errors.New("Failed to process books")
@@ -165,6 +344,34 @@ func getBooks(conn *pgx.Conn) ([]Book, error) {
 	return bookList, nil
 }
 
+// GetEditions returns the editions of the work the reader userID of the age can see, like ageFilter.
+func GetEditions(conn *pgx.Conn, workID, age, userID int) ([]Book, error) {
+	rows, err := conn.Query(context.Background(), "select "+bookColumns+" from books where "+ageFilter+" and work_id = $3 order by year, id;", age, userID, workID)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("Failed to fetch the editions")
+	}
+	defer rows.Close()
+
+	editions := []Book{}
+	for rows.Next() {
+		var book Book
+		if err = rows.Scan(book.fields()...); err != nil {
+			log.Println(err)
+			return nil, errors.New("Failed to process the editions")
+		}
+
+		editions = append(editions, book)
+	}
+
+	if rows.Err() != nil {
+		log.Println(rows.Err())
+		return nil, errors.New("Failed to fetch the editions")
+	}
+
+	return editions, nil
+}
+
 func GetBooks(c *gin.Context) {
 	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
 	if err != nil {
@@ -186,7 +393,13 @@ func GetBooks(c *gin.Context) {
 		return
 	}
 
-	bookList, err := getBooks(conn)
+	age, userID, err := OptionalReader(conn, c.Query("token"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	bookList, err := getBooks(conn, age, userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -203,7 +416,7 @@ func GetBooks(c *gin.Context) {
 func AddBook(c *gin.Context) {
 	var information map[string]interface{}
 	var book Book
-	json.NewDecoder(c.Request.Body).Decode(&information) //isbn, title, author, year, quantity, token
+	json.NewDecoder(c.Request.Body).Decode(&information) //isbn, title, author, year, quantity, token, subjects && publisher && pages && coverURL && callNumber && callNumberScheme && ageRating && itemCategory (optional)
 
 	tokenString, ok := information["token"].(string)
 	if !ok {
@@ -230,6 +443,13 @@ func AddBook(c *gin.Context) {
 		return
 	}
 
+	book.ISBN, err = isbn.Canonical(book.ISBN)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	book.Title, ok = information["title"].(string)
 	if !ok {
 		log.Println("Title is not a string")
@@ -260,6 +480,35 @@ func AddBook(c *gin.Context) {
 	}
 	book.Year = int16(year)
 
+	if subjects, ok := information["subjects"].([]interface{}); ok {
+		for _, subject := range subjects {
+			if subject, ok := subject.(string); ok {
+				book.Subjects = append(book.Subjects, subject)
+			}
+		}
+	}
+
+	book.Publisher, _ = information["publisher"].(string)
+	book.CoverURL, _ = information["coverURL"].(string)
+	if pages, ok := information["pages"].(float64); ok {
+		book.Pages = int(pages)
+	}
+
+	if _, err = applyCallNumber(&book, information); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err = applyAgeRating(&book, information); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err = applyItemCategory(&book, information); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
 	if err != nil {
 		log.Println(err)
@@ -280,9 +529,13 @@ func AddBook(c *gin.Context) {
 		return
 	}
 
-	_, err = conn.Exec(context.Background(), "insert into books (isbn, title, author, year, quantity) values ($1, $2, $3, $4, $5);",
-		book.ISBN, book.Title, book.Author, book.Year, book.Quantity)
+	_, err = InsertBook(conn, book)
 	if err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Error there is already a book with this ISBN"})
+			return
+		}
+
 		log.Println(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Couldn't insert into the table"})
 		return
@@ -312,9 +565,15 @@ func SearchForBook(c *gin.Context) {
 	}
 
 	var information map[string]string
-	json.NewDecoder(c.Request.Body).Decode(&information) //name
+	json.NewDecoder(c.Request.Body).Decode(&information) //name && token (optional)
 
-	bookList, err := getBooks(conn)
+	age, userID, err := OptionalReader(conn, information["token"])
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	bookList, err := getBooks(conn, age, userID)
 	if err != nil {
 		log.Println(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -353,74 +612,63 @@ func BorrowBook(c *gin.Context) {
 	}
 	defer conn.Close(context.Background())
 
-	err = CreateAuthTable(conn)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	err = CreateBookTable(conn)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	if err = createBorrowedBooksTable(conn); err != nil {
+	if err = CreateCirculationTables(conn); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	var information map[string]string
-	json.NewDecoder(c.Request.Body).Decode(&information) //title && returnDate (author | isbn | year | id)
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) //(id | isbn | barcode | title) && returnDate (optional, the policy decides the longest loan)
 
-	id, _, err := ValidateJWT(information["token"])
+	token, _ := information["token"].(string)
+	id, accountType, err := ValidateJWT(token)
 	if err != nil {
 		log.Println(err)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	var book Book
-	book.Title = information["title"]
-
-	_, err = conn.Exec(context.Background(), "update books set quantity = quantity - 1 where title = $1 and quantity > 0;", book.Title)
-	if err != nil {
-		log.Println(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the book"})
-		return
-	}
-
-	err = conn.QueryRow(context.Background(), "select id, quantity from books b where b.title = $1;", book.Title).Scan(&book.ID, &book.Quantity)
+	book, copyID, err := ResolveBook(conn, information)
 	if err != nil {
-		log.Println(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error viewing the quantity of the book"})
+		respondResolveError(c, err)
 		return
 	}
 
-	if book.Quantity == 0 {
-		log.Println("All of the copies of this book have already been borrowed. Please chose another one.")
-		c.JSON(http.StatusForbidden, gin.H{"error": "All of the copies of this book have already been borrowed. Please chose another one."})
-		return
+	returnDateString, _ := information["returnDate"].(string)
+	var requested time.Time
+	if returnDateString != "" {
+		if requested, err = time.Parse(time.DateOnly, returnDateString); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Error parsing the return date."})
+			return
+		}
 	}
 
-	returnDate, err := time.Parse(time.DateOnly, information["returnDate"])
+	tx, err := conn.Begin(context.Background())
 	if err != nil {
 		log.Println(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error parsing the return date."})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error borrowing the book"})
 		return
 	}
+	defer tx.Rollback(context.Background())
 
-	if err = borrowBook(conn, id, book, returnDate); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	slip, status, err := Lend(tx, LoanRequest{PatronID: id, AccountType: accountType, Book: book, CopyID: copyID, ReturnDate: requested})
+	if err != nil {
+		if blocked, ok := err.(*BlockedError); ok {
+			c.JSON(status, gin.H{"error": blocked.Error(), "reason": blocked.Reason})
+			return
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err = updateHistory(conn, book, id); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating the history of the person"})
+	if err = tx.Commit(context.Background()); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error borrowing the book"})
 		return
 	}
 
-	c.JSON(http.StatusOK, nil)
+	c.JSON(http.StatusOK, gin.H{"returnDate": slip.DueDate.Format(time.DateOnly)})
 }
 
 func ReturnBook(c *gin.Context) {
@@ -432,51 +680,64 @@ func ReturnBook(c *gin.Context) {
 	}
 	defer conn.Close(context.Background())
 
-	err = CreateAuthTable(conn)
-	if err != nil {
+	if err = CreateCirculationTables(conn); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	err = CreateBookTable(conn)
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) //id | isbn | barcode | title && condition (optional) && notes (optional)
+
+	token, _ := information["token"].(string)
+	id, _, err := ValidateJWT(token)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err = CreateBookReservationsTable(conn); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+	condition, _ := information["condition"].(string)
+	notes, _ := information["notes"].(string)
+	if condition != "" {
+		if !validCondition(condition) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Error the condition must be one of " + strings.Join(Conditions, ", ")})
+			return
+		}
+
+		if err = CreateDamageReportsTable(conn); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 	}
 
-	if err = createBorrowedBooksTable(conn); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	book, copyID, err := ResolveBook(conn, information)
+	if err != nil {
+		respondResolveError(c, err)
 		return
 	}
 
-	var information map[string]string
-	var book Book
-	json.NewDecoder(c.Request.Body).Decode(&information) //title
-
-	id, _, err := ValidateJWT(information["token"])
+	tx, err := conn.Begin(context.Background())
 	if err != nil {
 		log.Println(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error returning the book"})
 		return
 	}
+	defer tx.Rollback(context.Background())
 
-	book.Title = information["title"]
-
-	err = conn.QueryRow(context.Background(), "select id, isbn, title, author, year, quantity from books b where b.title = $1;", book.Title).Scan(
-		&book.ID, &book.ISBN, &book.Title, &book.Author, &book.Year, &book.Quantity)
-	if err != nil {
-		log.Println(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the book details"})
+	if _, err = lockBook(tx, book.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	var check int
-	err = conn.QueryRow(context.Background(), "delete from borrowed_books where book_id = $1 and user_id = $2 returning id;", book.ID, id).Scan(&check)
+	var loanID int
+	query := "select id from borrowed_books where book_id = $1 and user_id = $2 and returned_at is null order by return_date asc, id asc limit 1 for update;"
+	args := []interface{}{book.ID, id}
+	if copyID != 0 {
+		query = "select id from borrowed_books where book_id = $1 and user_id = $2 and copy_id = $3 and returned_at is null for update;"
+		args = append(args, copyID)
+	}
+
+	err = tx.QueryRow(context.Background(), query, args...).Scan(&loanID)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			c.JSON(http.StatusForbidden, gin.H{"message": "You can't return a book that you haven't borrowed or you have already returned"})
@@ -487,111 +748,134 @@ func ReturnBook(c *gin.Context) {
 		return
 	}
 
-	_, err = conn.Exec(context.Background(), "update books set quantity = quantity + 1 where id = $1;", book.ID)
+	slip, err := CheckIn(tx, loanID, id, condition, strings.TrimSpace(notes))
 	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
 		log.Println(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adding the book to our inventory"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error returning the book"})
 		return
 	}
 
-	if err = borrowReservedBooks(conn, book); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if slip.DamageReport != 0 {
+		c.JSON(http.StatusOK, gin.H{"message": "The copy was returned damaged and was sent for repair", "damageReport": slip.DamageReport, "fine": slip.Fine})
+		return
+	}
+
+	if slip.Fine > 0 {
+		c.JSON(http.StatusOK, gin.H{"message": "The book was returned late", "fine": slip.Fine})
 		return
 	}
 
 	c.JSON(http.StatusOK, nil)
 }
 
-func GetHistory(c *gin.Context) {
+func ReserveBook(c *gin.Context) {
 	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
 	if err != nil {
 		log.Println(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error connecting to the database"})
 		return
 	}
 	defer conn.Close(context.Background())
 
-	var information map[string]string
-	json.NewDecoder(c.Request.Body).Decode(&information)
+	if err = CreateCirculationTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
-	id, _, err := ValidateJWT(information["token"])
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) //id | isbn | barcode | title
+
+	token, _ := information["token"].(string)
+	id, accountType, err := ValidateJWT(token)
 	if err != nil {
 		log.Println(err)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	var history []string
-	err = conn.QueryRow(context.Background(), "select history from authentication a where a.id = $1;", id).Scan(&history)
-	if err != nil {
-		log.Println(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the history from the database"})
+	if reason, err := blocks.Check(conn, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	} else if reason != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error you can't reserve books, " + reason, "reason": reason})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"history": history})
-}
-
-func ReserveBook(c *gin.Context) {
-	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	book, _, err := ResolveBook(conn, information)
 	if err != nil {
-		log.Println(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error connecting to the database"})
+		respondResolveError(c, err)
 		return
 	}
-	defer conn.Close(context.Background())
 
-	err = CreateAuthTable(conn)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if status, err := CheckAgeRating(conn, id, accountType, book); err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
-	err = CreateBookTable(conn)
+	tx, err := conn.Begin(context.Background())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reserving the book"})
 		return
 	}
+	defer tx.Rollback(context.Background())
 
-	if err = CreateBookReservationsTable(conn); err != nil {
+	if book.Quantity, err = lockBook(tx, book.ID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	var information map[string]string
-	var book Book
-	json.NewDecoder(c.Request.Body).Decode(&information) //title & (author | isbn | year | id)
+	if book.Quantity > 0 {
+		c.JSON(http.StatusOK, gin.H{"message": "There are copies from this book available. There is no need to reserve it."})
+		return
+	}
 
-	id, _, err := ValidateJWT(information["token"])
+	reserved := false
+	err = tx.QueryRow(context.Background(), "select exists (select 1 from book_reservations where book_id = $1 and user_id = $2 and status in ('waiting', 'ready'))",
+		book.ID, id).Scan(&reserved)
 	if err != nil {
 		log.Println(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking your reservations"})
 		return
 	}
 
-	book.Title = information["title"]
+	if reserved {
+		c.JSON(http.StatusConflict, gin.H{"error": "Error you have already reserved this book"})
+		return
+	}
 
-	err = conn.QueryRow(context.Background(), "select id, isbn, title, author, year, quantity from books b where b.title = $1;", book.Title).Scan(
-		&book.ID, &book.ISBN, &book.Title, &book.Author, &book.Year, &book.Quantity)
+	reservation := Reservation{BookID: book.ID, Title: book.Title, UserID: id, Status: holds.StatusWaiting}
+	err = tx.QueryRow(context.Background(), "insert into book_reservations (book_id, user_id) values ($1, $2) returning id, created_at;", book.ID, id).Scan(
+		&reservation.ID, &reservation.CreatedAt)
 	if err != nil {
 		log.Println(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the book details"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reserving the book"})
 		return
 	}
 
-	if book.Quantity > 0 {
-		c.JSON(http.StatusOK, gin.H{"message": "There are copies from this book available. There is no need to reserve it."})
+	// A long enough queue recalls a loan of the book before the estimate, so it counts the earlier due date.
+	if _, err = recallForQueue(tx, book.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	_, err = conn.Exec(context.Background(), "insert into book_reservations (book_id, user_id) values ($1, $2);", book.ID, id)
-	if err != nil {
+	if err = estimateReservation(tx, &reservation); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
 		log.Println(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reserving the book"})
 		return
 	}
 
-	c.JSON(http.StatusOK, nil)
+	c.JSON(http.StatusOK, gin.H{"reservation": reservation})
 }
 
 func UpdateBookQuantity(c *gin.Context) {
@@ -603,14 +887,7 @@ func UpdateBookQuantity(c *gin.Context) {
 	}
 	defer conn.Close(context.Background())
 
-	err = CreateAuthTable(conn)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	err = CreateBookTable(conn)
-	if err != nil {
+	if err = CreateCirculationTables(conn); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -653,36 +930,30 @@ func UpdateBookQuantity(c *gin.Context) {
 	}
 	book.Quantity = int(quantity)
 
-	_, err = conn.Exec(context.Background(), "update books set quantity = $1 where id = $2;", book.Quantity, book.ID)
+	tx, err := conn.Begin(context.Background())
 	if err != nil {
 		log.Println(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating the quantity of books"})
 		return
 	}
+	defer tx.Rollback(context.Background())
 
-	var rowsCount int
-	err = conn.QueryRow(context.Background(), "select count(*) from book_reservations where book_id = $1", book.ID).Scan(&rowsCount)
+	_, err = tx.Exec(context.Background(), "update books set quantity = $1 where id = $2;", book.Quantity, book.ID)
 	if err != nil {
 		log.Println(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error counting the reservations for this book."})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating the quantity of books"})
 		return
 	}
 
-	if book.Quantity > rowsCount {
-		for range rowsCount {
-			if err = borrowReservedBooks(conn, book); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
+	if err = FulfilReservations(tx, book); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
-		}
-	} else {
-		for range book.Quantity {
-			if err = borrowReservedBooks(conn, book); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
-		}
+	if err = tx.Commit(context.Background()); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating the quantity of books"})
+		return
 	}
 
 	c.JSON(http.StatusOK, nil)
@@ -792,7 +1063,7 @@ func GetBooksOverdue(c *gin.Context) {
 	}
 
 	count := 0
-	err = conn.QueryRow(context.Background(), "select count(*) from borrowed_books bb where current_timestamp > bb.return_date;").Scan(&count)
+	err = conn.QueryRow(context.Background(), "select count(*) from borrowed_books bb where current_timestamp > bb.return_date and bb.returned_at is null and bb.missing = '';").Scan(&count)
 	if err != nil {
 		log.Println(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while checking if there are books that are overdue"})
@@ -804,7 +1075,7 @@ func GetBooksOverdue(c *gin.Context) {
 		return
 	}
 
-	rows, err := conn.Query(context.Background(), "select book_id, user_id from borrowed_books bb where current_timestamp > bb.return_date")
+	rows, err := conn.Query(context.Background(), "select book_id, user_id from borrowed_books bb where current_timestamp > bb.return_date and bb.returned_at is null and bb.missing = ''")
 	if err != nil {
 		log.Println(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the users from the database"})
@@ -936,23 +1207,31 @@ func GetBookByID(c *gin.Context) {
 	}
 	defer conn.Close(context.Background())
 
-	params := c.Request.URL.Query()
-	idString := params.Get("id")
-	if idString == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Error no id provided"})
+	if err = CreateBookTable(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	id, err := strconv.Atoi(idString)
+	id, err := bookIDFromQuery(conn, c)
 	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Error there is no such book in this library"})
+			return
+		}
+
 		log.Println(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to parse the id of the book"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	age, userID, err := OptionalReader(conn, c.Query("token"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
 	var book Book
-	book.ID = id
-	err = conn.QueryRow(context.Background(), "select title, isbn, author, year from books b where b.id = $1", id).Scan(&book.Title, &book.ISBN, &book.Author, &book.Year)
+	err = conn.QueryRow(context.Background(), "select "+bookColumns+" from books where "+ageFilter+" and books.id = $3", age, userID, id).Scan(book.fields()...)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Error there is no such book in this library"})
@@ -964,7 +1243,19 @@ func GetBookByID(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"book": book})
+	if err = CreateCopiesTable(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	copies, err := getCopies(conn, book.ID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the copies of the book"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"book": book, "copies": copies})
 }
 
 func GetAuthors(c *gin.Context) {
@@ -1014,17 +1305,15 @@ func IsAvailable(c *gin.Context) {
 	}
 	defer conn.Close(context.Background())
 
-	params := c.Request.URL.Query()
-	idString := params.Get("id")
-	if idString == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Error no id provided"})
-		return
-	}
-
-	id, err := strconv.Atoi(idString)
+	id, err := bookIDFromQuery(conn, c)
 	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Error there is no book with this ISBN in this library"})
+			return
+		}
+
 		log.Println(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error parsing the id of the book"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -1058,20 +1347,14 @@ func CancelBookReservation(c *gin.Context) {
 	}
 	defer conn.Close(context.Background())
 
-	if err = CreateBookTable(conn); err != nil {
-		log.Println(err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	if err = CreateBookReservationsTable(conn); err != nil {
+	if err = CreateCirculationTables(conn); err != nil {
 		log.Println(err.Error())
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	var information map[string]interface{}
-	json.NewDecoder(c.Request.Body).Decode(&information) // id || isbn || title
+	json.NewDecoder(c.Request.Body).Decode(&information) // id || isbn || barcode || title
 
 	token, ok := information["token"].(string)
 	if !ok {
@@ -1087,114 +1370,36 @@ func CancelBookReservation(c *gin.Context) {
 		return
 	}
 
-	useID, useISBN, useTitle := false, false, false
-	title := ""
-	isbn := ""
-	bookId, ok := information["id"].(float64)
-	bookID := 0
-	if ok {
-		useID = true
-		bookID = int(bookId)
-	} else if title, ok = information["title"].(string); ok {
-		useTitle = true
-	} else if isbn, ok = information["isbn"].(string); ok {
-		useTitle = true
-	} else {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Error unable to identify the requested book by the given parameters"})
-		return
-	}
-
-	if useID {
-		if err = cancelBookReservation(conn, id, bookID); err != nil {
-			log.Println(err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-	}
-	if useISBN {
-		err = conn.QueryRow(context.Background(), "select id from books b where b.isbn = $1", isbn).Scan(&bookID)
-		if err != nil {
-			log.Println(err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to get information about the book from the database"})
-			return
-		}
-
-		if err = cancelBookReservation(conn, id, bookID); err != nil {
-			log.Println(err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-	}
-	if useTitle {
-		err = conn.QueryRow(context.Background(), "select id from books b where b.title = $1", title).Scan(&bookID)
-		if err != nil {
-			log.Println(err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to get information about the book from the database"})
-			return
-		}
-
-		if err = cancelBookReservation(conn, id, bookID); err != nil {
-			log.Println(err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "The book reservation was canceled successfully"})
-}
-
-func UpdateBookID(c *gin.Context) {
-	var information map[string]interface{}
-	json.NewDecoder(c.Request.Body).Decode(&information) // token && id (new) && title
-
-	token, ok := information["token"].(string)
-	if !ok {
-		log.Println("Incorrectly provided token")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided token"})
+	book, _, err := ResolveBook(conn, information)
+	if err != nil {
+		respondResolveError(c, err)
 		return
 	}
 
-	_, accountType, err := ValidateJWT(token)
+	tx, err := conn.Begin(context.Background())
 	if err != nil {
 		log.Println(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
-		return
-	}
-
-	if accountType != "librarian" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Error only librarians can update books"})
-		return
-	}
-
-	idFL, ok := information["id"].(float64)
-	if !ok {
-		log.Println("Incorrectly provided id")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided id"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error canceling the reservation"})
 		return
 	}
-	id := int(idFL)
+	defer tx.Rollback(context.Background())
 
-	title, ok := information["title"].(string)
-	if !ok {
-		log.Println("Incorrectly provided title")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided title"})
+	if _, err = lockBook(tx, book.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
-	if err != nil {
+	if err = cancelBookReservation(tx, id, book.ID); err != nil {
 		log.Println(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error couldn't connect to the database"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	defer conn.Close(context.Background())
 
-	_, err = conn.Exec(context.Background(), "update books set id = $1 where title = $2", id, title)
-	if err != nil {
+	if err = tx.Commit(context.Background()); err != nil {
 		log.Println(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error couldn't update the id of the book"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error canceling the reservation"})
 		return
 	}
 
-	c.JSON(http.StatusOK, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "The book reservation was canceled successfully"})
 }
@@ -2,14 +2,24 @@ package books
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"image"
+	"image/png"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/Phantomvv1/Library_management/internal/authentication"
+	"github.com/Phantomvv1/Library_management/internal/metadata"
+	"github.com/Phantomvv1/Library_management/internal/storage"
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
 )
 
 var Token = ""
@@ -106,6 +116,121 @@ func TestSearchForBook(t *testing.T) {
 	}
 }
 
+func TestAddCopy(t *testing.T) {
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	// The copy stays for the tests after this one, a second run finds it already there.
+	exists := false
+	err = conn.QueryRow(context.Background(), "select exists (select 1 from copies where barcode = 'LIB-000001')").Scan(&exists)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/book/copy", AddCopy)
+
+	add := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+
+		body := []byte(fmt.Sprintf(`{"bookID": 1, "barcode": "LIB-000001", "token": "%s"}`, Token))
+		req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/book/copy", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := add(); !exists && rr.Code != http.StatusOK || exists && rr.Code != http.StatusConflict {
+		t.Fatal(rr.Code, rr.Body)
+	}
+
+	if rr := add(); rr.Code != http.StatusConflict {
+		t.Fatalf("expected a second copy with the same barcode to conflict, got %d %s", rr.Code, rr.Body)
+	}
+}
+
+func TestSetCopyCondition(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/book/copy/condition", SetCopyCondition)
+
+	rr := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"barcode": "LIB-000001", "condition": "fair", "token": "%s"}`, Token))
+	reader := bytes.NewReader(body)
+
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/book/copy/condition", reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+}
+
+func TestSetCopyLocation(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/book/copy/location", SetCopyLocation)
+
+	rr := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"barcode": "LIB-000001", "room": "Reading room", "shelf": "B2", "token": "%s"}`, Token))
+	reader := bytes.NewReader(body)
+
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/book/copy/location", reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+}
+
+func TestBorrowBookNotFound(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/book/borrow", BorrowBook)
+
+	rr := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"title": "Some titel", "returnDate": "2025-07-01", "token": "%s"}`, Token))
+	reader := bytes.NewReader(body)
+
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/book/borrow", reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Fatal(rr.Body)
+	}
+
+	var response map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&response)
+	if _, ok := response["suggestions"]; !ok {
+		t.Fatal("Expected suggestions for a book that doesn't exist")
+	}
+}
+
 func TestBorrowBook(t *testing.T) {
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.Default()
@@ -113,7 +238,7 @@ func TestBorrowBook(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	body := []byte(fmt.Sprintf(`{"title": "Some title", "returnDate": "2025-07-01", "token": "%s"}`, Token))
+	body := []byte(fmt.Sprintf(`{"barcode": "LIB-000001", "token": "%s"}`, Token))
 	reader := bytes.NewReader(body)
 
 	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/book/borrow", reader)
@@ -129,6 +254,154 @@ func TestBorrowBook(t *testing.T) {
 	}
 }
 
+// TestConcurrentCirculation sends the loans, reservations and returns of a book with a single copy at the same time
+// and checks the copy is never lent twice and never goes missing.
+func TestConcurrentCirculation(t *testing.T) {
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	if err = CreateCirculationTables(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	var bookID int
+	err = conn.QueryRow(context.Background(), "insert into books (title, author, year, quantity) values ('Concurrency test', 'Tester', 2000, 1) returning id").Scan(&bookID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		conn.Exec(context.Background(), "delete from ledger where loan_id in (select id from borrowed_books where book_id = $1)", bookID)
+		conn.Exec(context.Background(), "delete from book_reservations where book_id = $1", bookID)
+		conn.Exec(context.Background(), "delete from borrowed_books where book_id = $1", bookID)
+		conn.Exec(context.Background(), "delete from books where id = $1", bookID)
+		conn.Exec(context.Background(), "delete from authentication where email like 'concurrency-%@test.com'")
+	}()
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/signup", authentication.SignUp)
+	router.POST("/login", authentication.LogIn)
+	router.POST("/book/borrow", BorrowBook)
+	router.POST("/book/reserve", ReserveBook)
+	router.POST("/book/return", ReturnBook)
+
+	// Several patrons race for the only copy, each of them with their own token.
+	const patrons = 8
+
+	tokens := make([]string, patrons)
+	for i := range patrons {
+		email := fmt.Sprintf("concurrency-%d@test.com", i)
+		for _, path := range []string{"/signup", "/login"} {
+			rr := httptest.NewRecorder()
+			body := []byte(fmt.Sprintf(`{"name": "Patron %d", "email": "%s", "password": "password", "type": "user"}`, i, email))
+			req, err := http.NewRequest(http.MethodPost, "http://localhost:42069"+path, bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			router.ServeHTTP(rr, req)
+			if rr.Code != http.StatusOK {
+				t.Fatal(rr.Body)
+			}
+
+			if path == "/login" {
+				var token map[string]string
+				json.NewDecoder(rr.Body).Decode(&token)
+				tokens[i] = token["token"]
+			}
+		}
+	}
+
+	// send makes a request with each of the tokens at once and returns the tokens of the requests that succeeded.
+	send := func(path string, tokens []string) []string {
+		codes := make([]int, len(tokens))
+
+		var wg sync.WaitGroup
+		for i, token := range tokens {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				rr := httptest.NewRecorder()
+				body := []byte(fmt.Sprintf(`{"id": %d, "token": "%s"}`, bookID, token))
+				req, err := http.NewRequest(http.MethodPost, "http://localhost:42069"+path, bytes.NewReader(body))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				router.ServeHTTP(rr, req)
+				codes[i] = rr.Code
+			}()
+		}
+		wg.Wait()
+
+		var succeeded []string
+		for i, code := range codes {
+			if code == http.StatusOK {
+				succeeded = append(succeeded, tokens[i])
+			} else if code == http.StatusInternalServerError {
+				t.Fatalf("%s failed with %v", path, codes)
+			}
+		}
+
+		return succeeded
+	}
+
+	// repeat is the same token as many times as there are patrons.
+	repeat := func(token string) []string {
+		repeated := make([]string, patrons)
+		for i := range repeated {
+			repeated[i] = token
+		}
+
+		return repeated
+	}
+
+	// check makes sure the copy is on the shelf, on loan or on hold, in exactly one of them.
+	check := func(wantLoans, wantHolds int) {
+		var quantity, loans, ready int
+		err := conn.QueryRow(context.Background(), "select quantity, (select count(*) from borrowed_books where book_id = $1 and returned_at is null), "+
+			"(select count(*) from book_reservations where book_id = $1 and status = 'ready') from books where id = $1", bookID).Scan(&quantity, &loans, &ready)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if quantity < 0 {
+			t.Fatalf("the quantity of the book dropped to %d", quantity)
+		}
+
+		if quantity+loans+ready != 1 || loans != wantLoans || ready != wantHolds {
+			t.Fatalf("expected %d loans and %d holds of the only copy, got quantity %d, %d loans and %d holds", wantLoans, wantHolds, quantity, loans, ready)
+		}
+	}
+
+	borrowers := send("/book/borrow", tokens)
+	if len(borrowers) != 1 {
+		t.Fatalf("expected the only copy to be lent to one of the patrons, it was lent %d times", len(borrowers))
+	}
+	check(1, 0)
+
+	send("/book/reserve", repeat(Token))
+	reservations := 0
+	err = conn.QueryRow(context.Background(), "select count(*) from book_reservations where book_id = $1 and status = 'waiting'", bookID).Scan(&reservations)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reservations != 1 {
+		t.Fatalf("expected a single reservation, got %d", reservations)
+	}
+
+	if returned := send("/book/return", repeat(borrowers[0])); len(returned) != 1 {
+		t.Fatalf("expected the copy to be returned once, it was returned %d times", len(returned))
+	}
+	check(0, 1)
+}
+
 func TestReturnBook(t *testing.T) {
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.Default()
@@ -136,7 +409,7 @@ func TestReturnBook(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	body := []byte(fmt.Sprintf(`{"title": "Some title", "token": "%s"}`, Token))
+	body := []byte(fmt.Sprintf(`{"barcode": "LIB-000001", "token": "%s"}`, Token))
 	reader := bytes.NewReader(body)
 
 	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/book/return", reader)
@@ -175,17 +448,99 @@ func TestGetHistory(t *testing.T) {
 	}
 }
 
-func TestUpdateBookID(t *testing.T) {
+func TestPageFrom(t *testing.T) {
+	tests := []struct {
+		information map[string]interface{}
+		page        Page
+		err         error
+	}{
+		{map[string]interface{}{}, Page{Number: 1, Size: DefaultPageSize}, nil},
+		{map[string]interface{}{"page": 3.0, "limit": 10.0}, Page{Number: 3, Size: 10}, nil},
+		{map[string]interface{}{"page": 0.0}, Page{}, ErrInvalidPage},
+		{map[string]interface{}{"page": 1.5}, Page{}, ErrInvalidPage},
+		{map[string]interface{}{"page": "2"}, Page{}, ErrInvalidPage},
+		{map[string]interface{}{"limit": 101.0}, Page{}, ErrInvalidPage},
+	}
+
+	for _, test := range tests {
+		page, err := PageFrom(test.information)
+		if page != test.page || err != test.err {
+			t.Fatalf("%v: expected %v %v, got %v %v", test.information, test.page, test.err, page, err)
+		}
+	}
+
+	if offset := (Page{Number: 3, Size: 10}).Offset(); offset != 20 {
+		t.Fatalf("expected the third page of 10 to start at 20, got %d", offset)
+	}
+}
+
+func TestUpdateBook(t *testing.T) {
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	version, title, lastChange := 0, "", 0
+	err = conn.QueryRow(context.Background(), "select version, title, (select coalesce(max(id), 0) from book_changes) from books where id = 1").Scan(&version, &title, &lastChange)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The title alternates so every run changes something.
+	newTitle := "Some other title"
+	if title == newTitle {
+		newTitle = "Some title"
+	}
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.PATCH("/books/:id", UpdateBook)
+
+	update := func(version int) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+
+		body := []byte(fmt.Sprintf(`{"version": %d, "title": "%s", "year": 1991, "callNumber": "823.912 orw", "ageRating": 12, "token": "%s"}`, version, newTitle, Token))
+		req, err := http.NewRequest(http.MethodPatch, "http://localhost:42069/books/1", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := update(version - 1); rr.Code != http.StatusConflict {
+		t.Fatalf("expected a stale version to conflict, got %d %s", rr.Code, rr.Body)
+	}
+
+	if rr := update(version); rr.Code != http.StatusOK {
+		t.Fatal(rr.Code, rr.Body)
+	}
+
+	recorded := false
+	err = conn.QueryRow(context.Background(), "select exists (select 1 from book_changes where book_id = 1 and id > $1 and field = 'title' and old_value = $2 and new_value = $3)",
+		lastChange, title, newTitle).Scan(&recorded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !recorded {
+		t.Fatal("expected the change of the title to be recorded")
+	}
+}
+
+func TestGetBookChanges(t *testing.T) {
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.Default()
-	router.POST("/book/update/id", UpdateBookID)
+	router.POST("/books/:id/history", GetBookChanges)
 
 	rr := httptest.NewRecorder()
 
-	body := []byte(fmt.Sprintf(`{"id": -1, "title": "Some title", "token": "%s"}`, Token))
+	body := []byte(fmt.Sprintf(`{"token": "%s"}`, Token))
 	reader := bytes.NewReader(body)
 
-	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/book/update/id", reader)
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/books/1/history", reader)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -228,7 +583,7 @@ func TestReserveBook(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	body := []byte(fmt.Sprintf(`{"title": "Some title", "token": "%s"}`, Token))
+	body := []byte(fmt.Sprintf(`{"isbn": "978-3-16-148410-0", "token": "%s"}`, Token))
 	reader := bytes.NewReader(body)
 
 	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/book/reserve", reader)
@@ -264,6 +619,66 @@ func TestGetBookByID(t *testing.T) {
 	}
 }
 
+func TestGetClassifications(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.GET("/classification", GetClassifications)
+
+	rr := httptest.NewRecorder()
+
+	req, err := http.NewRequest(http.MethodGet, "http://localhost:42069/classification", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+}
+
+func TestBrowseClassification(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.GET("/classification/books", BrowseClassification)
+
+	rr := httptest.NewRecorder()
+
+	req, err := http.NewRequest(http.MethodGet, "http://localhost:42069/classification/books?class=823", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+}
+
+func TestGetNearbyBooks(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.GET("/book/nearby", GetNearbyBooks)
+
+	rr := httptest.NewRecorder()
+
+	req, err := http.NewRequest(http.MethodGet, "http://localhost:42069/book/nearby?id=1&limit=3", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK && rr.Code != http.StatusNotFound {
+		t.Fatal(rr.Body)
+	}
+}
+
 func TestGetAuthors(t *testing.T) {
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.Default()
@@ -304,6 +719,29 @@ func TestIsAvailable(t *testing.T) {
 	}
 }
 
+func TestGetReservations(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/reservations", GetReservations)
+
+	rr := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"token": "%s"}`, Token))
+	reader := bytes.NewReader(body)
+
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/reservations", reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+}
+
 func TestCancelBookReservation(t *testing.T) {
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.Default()
@@ -372,3 +810,385 @@ func TestGetBooksOverdue(t *testing.T) {
 		t.Fatal(rr.Body)
 	}
 }
+
+func TestImportMARC(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/book/import/marc", ImportMARC)
+
+	rr := httptest.NewRecorder()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("token", Token)
+	writer.WriteField("dryRun", "true")
+	part, err := writer.CreateFormFile("file", "books.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(`<collection xmlns="http://www.loc.gov/MARC21/slim"><record><leader>00000nam a2200000 a 4500</leader>
+<datafield tag="020" ind1=" " ind2=" "><subfield code="a">978-3-16-148410-0</subfield></datafield>
+<datafield tag="245" ind1="0" ind2="0"><subfield code="a">Some title</subfield></datafield></record></collection>`))
+	writer.Close()
+
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/book/import/marc", &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+}
+
+func TestExportMARC(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.GET("/book/export/marc", ExportMARC)
+
+	rr := httptest.NewRecorder()
+
+	req, err := http.NewRequest(http.MethodGet, "http://localhost:42069/book/export/marc", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+}
+
+func TestImportBooksCSV(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/book/import/csv", ImportBooksCSV)
+
+	rr := httptest.NewRecorder()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("token", Token)
+	writer.WriteField("atomic", "true")
+	part, err := writer.CreateFormFile("file", "books.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte("isbn,title,author,year,quantity,subjects\n978-3-16-148410-0,Some title,Some author,1990,10000,Fiction;Classics\n"))
+	writer.Close()
+
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/book/import/csv", &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+}
+
+func TestExportBooksCSV(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/book/export/csv", ExportBooksCSV)
+
+	rr := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"token": "%s"}`, Token))
+	reader := bytes.NewReader(body)
+
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/book/export/csv", reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+}
+
+func TestLookupBook(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.GET("/book/lookup", LookupBook)
+
+	provider, err := metadata.NewLocal("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider.Add(metadata.Metadata{ISBN: "978-3-16-148410-0", Title: "Some title", Authors: []string{"Some author"}, Year: 1990})
+	SetMetadataProvider(provider)
+
+	rr := httptest.NewRecorder()
+
+	req, err := http.NewRequest(http.MethodGet, "http://localhost:42069/book/lookup?isbn=978-3-16-148410-0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a lookup without a token to be refused, got %d %s", rr.Code, rr.Body)
+	}
+
+	rr = httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"token": "%s"}`, Token))
+	req, err = http.NewRequest(http.MethodGet, "http://localhost:42069/book/lookup?isbn=978-3-16-148410-0", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+}
+
+func TestUploadCover(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/book/cover", UploadCover)
+	SetStorage(storage.NewLocal(t.TempDir(), "/uploads"))
+
+	rr := httptest.NewRecorder()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("token", Token)
+	writer.WriteField("id", "1")
+	part, err := writer.CreateFormFile("file", "cover.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	png.Encode(part, image.NewRGBA(image.Rect(0, 0, 600, 900)))
+	writer.Close()
+
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/book/cover", &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+}
+
+func TestReportDamage(t *testing.T) {
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	if err = CreateDamageReportsTable(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	userID, _, err := authentication.ValidateJWT(Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A copy of its own with a returned loan, so there is always somebody to charge and nothing was charged yet.
+	var bookID, copyID int
+	err = conn.QueryRow(context.Background(), "insert into books (title, author, year, quantity) values ('Damage test', 'Tester', 2000, 1) returning id").Scan(&bookID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		conn.Exec(context.Background(), "delete from ledger where id in (select charge_id from damage_reports where copy_id = $1)", copyID)
+		conn.Exec(context.Background(), "delete from damage_reports where copy_id = $1", copyID)
+		conn.Exec(context.Background(), "delete from borrowed_books where book_id = $1", bookID)
+		conn.Exec(context.Background(), "delete from books where id = $1", bookID)
+	}()
+
+	barcode := fmt.Sprintf("DAMAGE-%d", bookID)
+	err = conn.QueryRow(context.Background(), "insert into copies (book_id, barcode) values ($1, $2) returning id", bookID, barcode).Scan(&copyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = conn.Exec(context.Background(), "insert into borrowed_books (book_id, user_id, copy_id, return_date, returned_at) values ($1, $2, $3, current_date, current_timestamp)",
+		bookID, userID, copyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/book/damage", ReportDamage)
+	SetStorage(storage.NewLocal(t.TempDir(), "/uploads"))
+
+	report := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		writer.WriteField("token", Token)
+		writer.WriteField("barcode", barcode)
+		writer.WriteField("notes", "Water damage on the last pages")
+		writer.WriteField("charge", "12.50")
+		part, err := writer.CreateFormFile("photos", "damage.png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		png.Encode(part, image.NewRGBA(image.Rect(0, 0, 100, 100)))
+		writer.Close()
+
+		req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/book/damage", &body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := report(); rr.Code != http.StatusOK {
+		t.Fatal(rr.Code, rr.Body)
+	}
+
+	charged := false
+	err = conn.QueryRow(context.Background(), "select charge_id is not null from damage_reports where copy_id = $1 and resolution = ''", copyID).Scan(&charged)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !charged {
+		t.Fatal("expected the borrower to be charged for the damage")
+	}
+
+	if rr := report(); rr.Code != http.StatusConflict {
+		t.Fatalf("expected charging the same damage twice to conflict, got %d %s", rr.Code, rr.Body)
+	}
+}
+
+func TestGetDamageReports(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/book/damage/list", GetDamageReports)
+
+	rr := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"barcode": "LIB-000001", "all": true, "token": "%s"}`, Token))
+	reader := bytes.NewReader(body)
+
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/book/damage/list", reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+}
+
+func TestResolveDamage(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/book/damage/resolve", ResolveDamage)
+
+	rr := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"reportID": 1, "resolution": "repaired", "condition": "fair", "token": "%s"}`, Token))
+	reader := bytes.NewReader(body)
+
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/book/damage/resolve", reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK && rr.Code != http.StatusConflict {
+		t.Fatal(rr.Body)
+	}
+}
+
+func TestGrantAgeOverride(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/book/age/override", GrantAgeOverride)
+
+	rr := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"userID": 1, "barcode": "LIB-000001", "token": "%s"}`, Token))
+	reader := bytes.NewReader(body)
+
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/book/age/override", reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+}
+
+func TestPlanISBNs(t *testing.T) {
+	stored := []StoredISBN{
+		{BookID: 1, ISBN: "0-306-40615-2"},
+		{BookID: 2, ISBN: "9780306406157"},
+		{BookID: 3, ISBN: "978-1-86197-876-9"},
+		{BookID: 4, ISBN: "9781861978769"},
+		{BookID: 5, ISBN: "not an isbn"},
+		{BookID: 6, ISBN: "0-19-852663-6"},
+	}
+
+	updates, migration := planISBNs(stored)
+	if len(updates) != 1 || updates[0] != (StoredISBN{BookID: 6, ISBN: "9780198526636"}) {
+		t.Fatal(updates)
+	}
+
+	if len(migration.Duplicates["9780306406157"]) != 2 || len(migration.Duplicates["9781861978769"]) != 2 || len(migration.Duplicates) != 2 {
+		t.Fatal(migration.Duplicates)
+	}
+
+	if len(migration.Invalid) != 1 || migration.Invalid[0].BookID != 5 {
+		t.Fatal(migration.Invalid)
+	}
+}
+
+func TestApplyBookChangesYear(t *testing.T) {
+	for _, year := range []float64{0, -5, 1990.5, float64(time.Now().Year() + 2)} {
+		book := Book{Year: 1990}
+		if _, err := applyBookChanges(&book, map[string]interface{}{"year": year}); err == nil {
+			t.Fatalf("expected the year %v to be rejected", year)
+		}
+	}
+
+	book := Book{Year: 1990}
+	changes, err := applyBookChanges(&book, map[string]interface{}{"year": 1991.0})
+	if err != nil || len(changes) != 1 || book.Year != 1991 {
+		t.Fatal(changes, err)
+	}
+}
@@ -0,0 +1,290 @@
+package books
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Phantomvv1/Library_management/internal/blocks"
+	"github.com/Phantomvv1/Library_management/internal/ledger"
+	"github.com/Phantomvv1/Library_management/internal/missing"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrNotOnLoan = errors.New("Error this book isn't on loan")
+
+// LoanRequest is a loan to make, BorrowBook makes one for the caller and the circulation desk makes them for patrons.
+// ReturnDate is zero for the due date of the policy and Override is the reason a librarian lends against the rules, empty when they don't.
+type LoanRequest struct {
+	PatronID    int
+	AccountType string
+	Book        Book
+	CopyID      int
+	ReturnDate  time.Time
+	LentBy      int
+	Override    string
+}
+
+// LoanSlip describes a loan Lend made.
+type LoanSlip struct {
+	LoanID   int       `json:"loanID"`
+	BookID   int       `json:"bookID"`
+	Title    string    `json:"title"`
+	Author   string    `json:"author"`
+	CopyID   int       `json:"copyID"`
+	Barcode  string    `json:"barcode"`
+	DueDate  time.Time `json:"dueDate"`
+	Override string    `json:"override"`
+}
+
+// ReturnSlip describes a loan CheckIn closed.
+type ReturnSlip struct {
+	LoanID       int       `json:"loanID"`
+	UserID       int       `json:"userID"`
+	BookID       int       `json:"bookID"`
+	Title        string    `json:"title"`
+	CopyID       int       `json:"copyID"`
+	Barcode      string    `json:"barcode"`
+	DueDate      time.Time `json:"dueDate"`
+	ReturnedAt   time.Time `json:"returnedAt"`
+	Fine         float64   `json:"fine"`
+	DamageReport int       `json:"damageReport"`
+	Missing      string    `json:"missing"`
+	Reversed     float64   `json:"reversed"`
+}
+
+// BlockedError is what Lend returns when the blocking rules keep the patron from borrowing.
+type BlockedError struct {
+	Reason string
+}
+
+func (e *BlockedError) Error() string {
+	return "Error you can't borrow books, " + e.Reason
+}
+
+// Lend lends the book to the patron in tx, when it can't it returns the status to answer with. An override goes past the blocks,
+// the loan limit and the longest loan of the policy but not the age rating or a copy that isn't on the shelf, the reason is kept with the loan.
+func Lend(tx Querier, request LoanRequest) (LoanSlip, int, error) {
+	book := request.Book
+
+	var err error
+	if book.Quantity, err = lockBook(tx, book.ID); err != nil {
+		return LoanSlip{}, http.StatusInternalServerError, err
+	}
+
+	if err = lockUser(tx, request.PatronID); err != nil {
+		return LoanSlip{}, http.StatusInternalServerError, err
+	}
+
+	if request.Override == "" {
+		reason, err := blocks.Check(tx, request.PatronID)
+		if err != nil {
+			return LoanSlip{}, http.StatusInternalServerError, err
+		}
+
+		if reason != "" {
+			return LoanSlip{}, http.StatusForbidden, &BlockedError{Reason: reason}
+		}
+	}
+
+	if status, err := CheckAgeRating(tx, request.PatronID, request.AccountType, book); err != nil {
+		return LoanSlip{}, status, err
+	}
+
+	// A book put aside for the patron is collected instead of taking another copy off the shelf.
+	holdID, heldCopy, err := readyHold(tx, request.PatronID, book.ID)
+	if err != nil {
+		return LoanSlip{}, http.StatusInternalServerError, err
+	}
+
+	copyID := request.CopyID
+	if holdID != 0 && heldCopy != 0 {
+		if copyID != 0 && copyID != heldCopy {
+			return LoanSlip{}, http.StatusConflict, errors.New("Error another copy of this book is on hold for you, please take that one")
+		}
+		copyID = heldCopy
+	}
+
+	if copyID != 0 && copyID != heldCopy {
+		status := ""
+		err = tx.QueryRow(context.Background(), "select status from copies where id = $1 for update", copyID).Scan(&status)
+		if err != nil {
+			log.Println(err)
+			return LoanSlip{}, http.StatusInternalServerError, errors.New("Error getting the copy of the book")
+		}
+
+		if status != "available" {
+			return LoanSlip{}, http.StatusConflict, errors.New("Error this copy of the book is " + status)
+		}
+	}
+
+	if holdID == 0 && book.Quantity < 1 {
+		return LoanSlip{}, http.StatusForbidden, errors.New("All of the copies of this book have already been borrowed. Please chose another one.")
+	}
+
+	policy, err := LoanPolicy(tx, request.PatronID, book)
+	if err != nil {
+		return LoanSlip{}, http.StatusInternalServerError, err
+	}
+
+	if request.Override == "" {
+		if status, err := checkLoanLimit(tx, request.PatronID, policy); err != nil {
+			return LoanSlip{}, status, err
+		}
+	}
+
+	returnDate := policy.DueDate(time.Now())
+	if !request.ReturnDate.IsZero() {
+		if request.ReturnDate.Before(time.Now().Truncate(24 * time.Hour)) {
+			return LoanSlip{}, http.StatusBadRequest, errors.New("Error the return date can't be in the past")
+		}
+
+		if request.Override == "" && request.ReturnDate.After(returnDate) {
+			return LoanSlip{}, http.StatusBadRequest, errors.New("Error the return date has to be between today and " + returnDate.Format(time.DateOnly))
+		}
+		returnDate = request.ReturnDate
+	}
+
+	// Without a barcode the loan takes the first copy on the shelf, so the copies stay in step with the quantity. Books without copies lend none.
+	if copyID == 0 {
+		err = tx.QueryRow(context.Background(), "select id from copies where book_id = $1 and status = 'available' order by id limit 1 for update", book.ID).Scan(&copyID)
+		if err != nil && err != pgx.ErrNoRows {
+			log.Println(err)
+			return LoanSlip{}, http.StatusInternalServerError, errors.New("Error getting a copy of the book")
+		}
+	}
+
+	if holdID == 0 {
+		_, err = tx.Exec(context.Background(), "update books set quantity = quantity - 1 where id = $1;", book.ID)
+		if err != nil {
+			log.Println(err)
+			return LoanSlip{}, http.StatusInternalServerError, errors.New("Error getting the book")
+		}
+	}
+
+	slip := LoanSlip{BookID: book.ID, Title: book.Title, Author: book.Author, CopyID: copyID, DueDate: returnDate, Override: request.Override}
+	if slip.LoanID, err = borrowBook(tx, request.PatronID, book, copyID, returnDate, request.LentBy, request.Override); err != nil {
+		return LoanSlip{}, http.StatusInternalServerError, err
+	}
+
+	if holdID != 0 {
+		if err = collectHold(tx, holdID); err != nil {
+			return LoanSlip{}, http.StatusInternalServerError, err
+		}
+	}
+
+	if copyID != 0 {
+		if err = tx.QueryRow(context.Background(), "select barcode from copies where id = $1", copyID).Scan(&slip.Barcode); err != nil {
+			log.Println(err)
+			return LoanSlip{}, http.StatusInternalServerError, errors.New("Error getting the copy of the book")
+		}
+	}
+
+	return slip, http.StatusOK, nil
+}
+
+// CheckIn closes the loan and puts its copy back on the shelf, on hold for the next patron in the queue or, when it came back damaged,
+// in repair. condition is empty when nobody looked at the copy and checkedInBy is whoever took it back, the borrower or a librarian.
+// A missing loan is found: a book claimed returned counts as returned on the day of the claim and the replacement of a lost one is taken back.
+func CheckIn(tx Querier, loanID, checkedInBy int, condition, notes string) (ReturnSlip, error) {
+	slip, err := closeLoan(tx, loanID, checkedInBy)
+	if err != nil {
+		return ReturnSlip{}, err
+	}
+
+	if slip.CopyID != 0 && condition != "" {
+		slip.DamageReport, err = checkReturnedCopy(tx, slip.CopyID, loanID, slip.UserID, checkedInBy, condition, notes)
+		if err != nil {
+			return ReturnSlip{}, err
+		}
+
+		if slip.DamageReport != 0 {
+			return slip, nil
+		}
+	}
+
+	if slip.CopyID != 0 {
+		_, err = tx.Exec(context.Background(), "update copies set status = 'available' where id = $1;", slip.CopyID)
+		if err != nil {
+			log.Println(err)
+			return ReturnSlip{}, errors.New("Error putting the copy back on the shelf")
+		}
+	}
+
+	_, err = tx.Exec(context.Background(), "update books set quantity = quantity + 1 where id = $1;", slip.BookID)
+	if err != nil {
+		log.Println(err)
+		return ReturnSlip{}, errors.New("Error adding the book to our inventory")
+	}
+
+	if _, err = holdNextReservation(tx, Book{ID: slip.BookID}, slip.CopyID); err != nil {
+		return ReturnSlip{}, err
+	}
+
+	return slip, nil
+}
+
+// closeLoan closes the loan for CheckIn, fining the borrower and settling a missing loan, and leaves its copy to the caller.
+func closeLoan(tx Querier, loanID, checkedInBy int) (ReturnSlip, error) {
+	slip := ReturnSlip{LoanID: loanID}
+	err := tx.QueryRow(context.Background(), "select book_id from borrowed_books where id = $1", loanID).Scan(&slip.BookID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return ReturnSlip{}, ErrNotOnLoan
+		}
+
+		log.Println(err)
+		return ReturnSlip{}, errors.New("Error getting the loan")
+	}
+
+	if _, err = lockBook(tx, slip.BookID); err != nil {
+		return ReturnSlip{}, err
+	}
+
+	err = tx.QueryRow(context.Background(), "select missing from borrowed_books where id = $1 and returned_at is null for update", loanID).Scan(&slip.Missing)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return ReturnSlip{}, ErrNotOnLoan
+		}
+
+		log.Println(err)
+		return ReturnSlip{}, errors.New("Error getting the loan")
+	}
+
+	err = tx.QueryRow(context.Background(), "update borrowed_books set returned_at = case when missing = $2 then missing_since else current_timestamp end, "+
+		"missing = case when missing = '' then '' else $3 end where id = $1 returning user_id, coalesce(copy_id, 0), return_date, returned_at",
+		loanID, missing.StatusClaimed, missing.StatusFound).Scan(&slip.UserID, &slip.CopyID, &slip.DueDate, &slip.ReturnedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return ReturnSlip{}, ErrNotOnLoan
+		}
+
+		log.Println(err)
+		return ReturnSlip{}, errors.New("Error returning the book")
+	}
+
+	err = tx.QueryRow(context.Background(), "select b.title, coalesce(c.barcode, '') from books b left join copies c on c.id = $2 where b.id = $1", slip.BookID, slip.CopyID).Scan(
+		&slip.Title, &slip.Barcode)
+	if err != nil {
+		log.Println(err)
+		return ReturnSlip{}, errors.New("Error getting the returned book")
+	}
+
+	if slip.Fine, err = accrueFine(tx, loanID, slip.ReturnedAt); err != nil {
+		return ReturnSlip{}, err
+	}
+
+	if slip.Missing == missing.StatusLost {
+		reversal, err := ledger.ReverseReplacement(tx, slip.UserID, loanID, "The lost "+slip.Title+" was found", checkedInBy)
+		if err != nil {
+			return ReturnSlip{}, err
+		}
+		if reversal.ID != 0 {
+			slip.Reversed = -reversal.Amount
+		}
+	}
+
+	return slip, nil
+}
@@ -0,0 +1,168 @@
+package books
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+
+	. "github.com/Phantomvv1/Library_management/internal/authentication"
+	"github.com/Phantomvv1/Library_management/internal/storage"
+	"github.com/Phantomvv1/Library_management/internal/thumbnail"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+const maxCoverSize = 10 << 20
+
+var (
+	fileStorage     storage.Storage
+	fileStorageOnce sync.Once
+	fileStorageErr  error
+)
+
+// SetStorage replaces the storage chosen from the environment.
+func SetStorage(store storage.Storage) {
+	fileStorageOnce.Do(func() {})
+	fileStorage = store
+	fileStorageErr = nil
+}
+
+func getStorage() (storage.Storage, error) {
+	fileStorageOnce.Do(func() {
+		fileStorage, fileStorageErr = storage.FromEnv()
+	})
+
+	return fileStorage, fileStorageErr
+}
+
+func UploadCover(c *gin.Context) {
+	_, accountType, err := ValidateJWT(c.PostForm("token"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	if accountType != "librarian" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error only librarians can upload covers"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.PostForm("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided id of the book"})
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error no cover image provided"})
+		return
+	}
+
+	if fileHeader.Size > maxCoverSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Error the cover image can't be larger than 10MB"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to open the uploaded file"})
+		return
+	}
+	defer file.Close()
+
+	original, err := io.ReadAll(io.LimitReader(file, maxCoverSize))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to read the uploaded file"})
+		return
+	}
+
+	img, format, err := thumbnail.Decode(bytes.NewReader(original))
+	if err == thumbnail.ErrTooLarge {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error the cover must be a JPEG, PNG or GIF image"})
+		return
+	}
+
+	thumbnails, err := thumbnail.Generate(img)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to generate the thumbnails of the cover"})
+		return
+	}
+
+	store, err := getStorage()
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error the file storage is not configured correctly"})
+		return
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error connecting to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = CreateBookTable(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	check := 0
+	err = conn.QueryRow(context.Background(), "select id from books where id = $1", id).Scan(&check)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Error there is no such book in this library"})
+			return
+		}
+
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to get information from the database"})
+		return
+	}
+
+	originalKey := fmt.Sprintf("covers/%d/original.%s", id, format)
+	err = store.Put(c.Request.Context(), originalKey, bytes.NewReader(original), "image/"+format)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to store the cover"})
+		return
+	}
+
+	thumbnailURLs := make(map[string]string)
+	for size, data := range thumbnails {
+		key := fmt.Sprintf("covers/%d/%s.jpg", id, size)
+		if err = store.Put(c.Request.Context(), key, bytes.NewReader(data), "image/jpeg"); err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to store the thumbnails of the cover"})
+			return
+		}
+
+		thumbnailURLs[size] = store.URL(key)
+	}
+
+	coverURL := store.URL(originalKey)
+	_, err = conn.Exec(context.Background(), "update books set cover_url = $1, thumbnails = $2 where id = $3", coverURL, thumbnailURLs, id)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to save the cover of the book"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"coverURL": coverURL, "thumbnails": thumbnailURLs})
+}
@@ -0,0 +1,339 @@
+package books
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/Phantomvv1/Library_management/internal/authentication"
+	"github.com/Phantomvv1/Library_management/internal/isbn"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrNoISBNIndex is what ImportCSV returns when the books can't be upserted by ISBN because their ISBNs aren't unique yet.
+var ErrNoISBNIndex = errors.New("Error the ISBNs of the books aren't unique yet, run \"catalog migrate-isbns\" before importing")
+
+type CSVLineResult struct {
+	Line   int    `json:"line"`
+	ISBN   string `json:"isbn"`
+	Status string `json:"status"` // created | updated | invalid
+	Error  string `json:"error,omitempty"`
+	BookID int    `json:"bookID,omitempty"`
+}
+
+func parseCSVBook(header map[string]int, row []string) (Book, error) {
+	var book Book
+	get := func(column string) string {
+		i, ok := header[column]
+		if !ok || i >= len(row) {
+			return ""
+		}
+
+		return strings.TrimSpace(row[i])
+	}
+
+	var err error
+	book.ISBN, err = isbn.Canonical(get("isbn"))
+	if err != nil {
+		return book, err
+	}
+
+	book.Title = get("title")
+	if book.Title == "" {
+		return book, errors.New("Error the title is missing")
+	}
+	book.Author = get("author")
+
+	if yearString := get("year"); yearString != "" {
+		year, err := strconv.ParseInt(yearString, 10, 16)
+		if err != nil || year < 1 || int(year) > time.Now().Year()+1 {
+			return book, errors.New("Error the year must be a positive whole number not in the future")
+		}
+		book.Year = int16(year)
+	}
+
+	book.Quantity, err = strconv.Atoi(get("quantity"))
+	if err != nil || book.Quantity < 0 {
+		return book, errors.New("Error the quantity must be a positive number")
+	}
+
+	book.Subjects = []string{}
+	for _, subject := range strings.Split(get("subjects"), ";") {
+		if subject = strings.TrimSpace(subject); subject != "" {
+			book.Subjects = append(book.Subjects, subject)
+		}
+	}
+
+	return book, nil
+}
+
+// ImportCSV upserts the books in the CSV by ISBN. When atomic is set nothing is written if any line is invalid,
+// otherwise the valid lines are imported and the invalid ones are only reported. The quantity is only taken for new books,
+// the quantity of a book already in the catalog follows its loans and copies.
+func ImportCSV(conn *pgx.Conn, r io.Reader, atomic bool) ([]CSVLineResult, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	headerRow, err := reader.Read()
+	if err != nil {
+		return nil, errors.New("Error the CSV file has no header row")
+	}
+
+	header := make(map[string]int)
+	for i, column := range headerRow {
+		header[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+
+	for _, column := range []string{"isbn", "title", "quantity"} {
+		if _, ok := header[column]; !ok {
+			return nil, errors.New("Error the CSV file is missing the " + column + " column")
+		}
+	}
+
+	results := []CSVLineResult{}
+	var valid []Book
+	var validResults []int
+	hasInvalid := false
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			results = append(results, CSVLineResult{Line: line, Status: "invalid", Error: err.Error()})
+			hasInvalid = true
+			continue
+		}
+
+		book, err := parseCSVBook(header, row)
+		if err != nil {
+			results = append(results, CSVLineResult{Line: line, ISBN: book.ISBN, Status: "invalid", Error: err.Error()})
+			hasInvalid = true
+			continue
+		}
+
+		results = append(results, CSVLineResult{Line: line, ISBN: book.ISBN})
+		valid = append(valid, book)
+		validResults = append(validResults, len(results)-1)
+	}
+
+	if atomic && hasInvalid {
+		return results, nil
+	}
+
+	// The upsert needs the unique index "catalog migrate-isbns" creates on the databases from before the ISBNs were checked.
+	indexed := false
+	err = conn.QueryRow(context.Background(), "select exists (select 1 from pg_index i join pg_attribute a on a.attrelid = i.indrelid and a.attnum = i.indkey[0] "+
+		"where i.indrelid = 'books'::regclass and i.indisunique and i.indnatts = 1 and i.indpred is null and a.attname = 'isbn')").Scan(&indexed)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("Error starting the import")
+	}
+
+	if !indexed {
+		return nil, ErrNoISBNIndex
+	}
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("Error starting the import")
+	}
+	defer tx.Rollback(context.Background())
+
+	for i, book := range valid {
+		result := &results[validResults[i]]
+		inserted := false
+		err = tx.QueryRow(context.Background(), "insert into books (isbn, title, author, year, quantity, subjects) values ($1, $2, $3, $4, $5, $6) "+
+			"on conflict (isbn) do update set title = excluded.title, author = excluded.author, year = excluded.year, subjects = excluded.subjects, "+
+			"version = books.version + 1 returning id, (xmax = 0)", book.ISBN, book.Title, book.Author, book.Year, book.Quantity, book.Subjects).Scan(&result.BookID, &inserted)
+		if err != nil {
+			log.Println(err)
+			return nil, errors.New("Error importing the book on line " + strconv.Itoa(result.Line))
+		}
+
+		result.Status = "updated"
+		if inserted {
+			result.Status = "created"
+		}
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		log.Println(err)
+		return nil, errors.New("Error saving the imported books")
+	}
+
+	return results, nil
+}
+
+// ExportCSV writes the whole catalog with the copies on the shelf, on loan and reserved for every book.
+func ExportCSV(conn *pgx.Conn, w io.Writer) error {
+	rows, err := conn.Query(context.Background(), "select b.id, b.isbn, b.title, b.author, b.year, b.quantity, b.subjects, "+
+		"(select count(*) from borrowed_books bb where bb.book_id = b.id and bb.returned_at is null), (select count(*) from book_reservations br where br.book_id = b.id and br.status in ('waiting', 'ready')) "+
+		"from books b order by b.id")
+	if err != nil {
+		log.Println(err)
+		return errors.New("Error getting the books from the database")
+	}
+	defer rows.Close()
+
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"id", "isbn", "title", "author", "year", "quantity", "subjects", "borrowed", "reserved", "available"})
+	for rows.Next() {
+		var book Book
+		var borrowed, reserved int
+		err = rows.Scan(&book.ID, &book.ISBN, &book.Title, &book.Author, &book.Year, &book.Quantity, &book.Subjects, &borrowed, &reserved)
+		if err != nil {
+			log.Println(err)
+			return errors.New("Error working with the books data")
+		}
+
+		writer.Write([]string{
+			strconv.Itoa(book.ID),
+			book.ISBN,
+			book.Title,
+			book.Author,
+			strconv.Itoa(int(book.Year)),
+			strconv.Itoa(book.Quantity),
+			strings.Join(book.Subjects, ";"),
+			strconv.Itoa(borrowed),
+			strconv.Itoa(reserved),
+			strconv.FormatBool(book.Quantity > 0),
+		})
+	}
+
+	if rows.Err() != nil {
+		log.Println(rows.Err())
+		return errors.New("Error working with the books data")
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// CreateCatalogTables creates every table the CSV import and export touch.
+func CreateCatalogTables(conn *pgx.Conn) error {
+	if err := CreateBookTable(conn); err != nil {
+		return err
+	}
+
+	if err := createBorrowedBooksTable(conn); err != nil {
+		return err
+	}
+
+	return CreateBookReservationsTable(conn)
+}
+
+func ImportBooksCSV(c *gin.Context) {
+	_, accountType, err := ValidateJWT(c.PostForm("token"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	if accountType != "librarian" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error only librarians can import books"})
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error no CSV file provided"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to open the uploaded file"})
+		return
+	}
+	defer file.Close()
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error connecting to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = CreateCatalogTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	atomic := c.PostForm("atomic") == "true"
+	results, err := ImportCSV(conn, file, atomic)
+	if err == ErrNoISBNIndex {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	for _, result := range results {
+		if result.Status == "invalid" && atomic {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Error nothing was imported because some lines are invalid", "results": results})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
+
+func ExportBooksCSV(c *gin.Context) {
+	var information map[string]string
+	json.NewDecoder(c.Request.Body).Decode(&information) // token
+
+	_, accountType, err := ValidateJWT(information["token"])
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	if accountType != "librarian" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error only librarians can export the catalog"})
+		return
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error connecting to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = CreateCatalogTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err = CreateCirculationTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", "attachment; filename=books.csv")
+	c.Header("Content-Type", "text/csv")
+	c.Status(http.StatusOK)
+	if err = ExportCSV(conn, c.Writer); err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,671 @@
+package books
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/Phantomvv1/Library_management/internal/authentication"
+	"github.com/Phantomvv1/Library_management/internal/holds"
+	"github.com/Phantomvv1/Library_management/internal/ledger"
+	"github.com/Phantomvv1/Library_management/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	maxDamagePhotos    = 5
+	maxDamagePhotoSize = 10 << 20
+)
+
+type DamageReport struct {
+	ID         int        `json:"id"`
+	CopyID     int        `json:"copyID"`
+	BookID     int        `json:"bookID"`
+	Barcode    string     `json:"barcode"`
+	LoanID     int        `json:"loanID"`
+	BorrowerID int        `json:"borrowerID"`
+	Condition  string     `json:"condition"`
+	Notes      string     `json:"notes"`
+	Photos     []string   `json:"photos"`
+	Charge     float64    `json:"charge"`
+	ReportedBy int        `json:"reportedBy"`
+	Resolution string     `json:"resolution"`
+	ResolvedAt *time.Time `json:"resolvedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+const damageReportColumns = "d.id, d.copy_id, c.book_id, c.barcode, coalesce(d.loan_id, 0), coalesce(d.borrower_id, 0), d.condition, d.notes, d.photos, " +
+	"coalesce(l.amount, 0)::float8, d.reported_by, d.resolution, d.resolved_at, d.created_at"
+
+const damageReportTables = "damage_reports d join copies c on d.copy_id = c.id left join ledger l on d.charge_id = l.id"
+
+func (r *DamageReport) fields() []interface{} {
+	return []interface{}{&r.ID, &r.CopyID, &r.BookID, &r.Barcode, &r.LoanID, &r.BorrowerID, &r.Condition, &r.Notes, &r.Photos,
+		&r.Charge, &r.ReportedBy, &r.Resolution, &r.ResolvedAt, &r.CreatedAt}
+}
+
+// CreateDamageReportsTable creates the damage reports and everything they point to, a report is open until the copy is repaired or withdrawn.
+func CreateDamageReportsTable(conn *pgx.Conn) error {
+	if err := CreateCirculationTables(conn); err != nil {
+		return err
+	}
+
+	if err := CreateBookChangesTable(conn); err != nil {
+		return err
+	}
+
+	if err := ledger.CreateLedgerTable(conn); err != nil {
+		return err
+	}
+
+	_, err := conn.Exec(context.Background(), "create table if not exists damage_reports (id serial primary key, copy_id int not null references copies(id) on delete cascade, "+
+		"loan_id int references borrowed_books(id) on delete set null, borrower_id int, condition text not null, notes text not null default '', "+
+		"photos text[] not null default '{}', charge_id int references ledger(id) on delete set null, reported_by int not null, resolution text not null default '', "+
+		"resolved_at timestamp, created_at timestamp not null default current_timestamp);")
+	if err != nil {
+		log.Println(err)
+		return errors.New("Couldn't create a table for the damage reports")
+	}
+
+	return nil
+}
+
+// openDamageReport starts a damage report for a copy that was just returned damaged or takes the report that is already open for it.
+func openDamageReport(db Querier, copyID, loanID, borrowerID, reportedBy int, condition, notes string) (int, error) {
+	var loan, borrower interface{}
+	if loanID != 0 {
+		loan, borrower = loanID, borrowerID
+	}
+
+	reportID := 0
+	err := db.QueryRow(context.Background(), "select id from damage_reports where copy_id = $1 and resolution = '' for update", copyID).Scan(&reportID)
+	if err == nil {
+		_, err = db.Exec(context.Background(), "update damage_reports set condition = $1, notes = trim(notes || ' ' || $2), loan_id = coalesce(loan_id, $3), "+
+			"borrower_id = coalesce(borrower_id, $4) where id = $5", condition, notes, loan, borrower, reportID)
+		if err != nil {
+			log.Println(err)
+			return 0, errors.New("Error updating the damage report")
+		}
+
+		return reportID, nil
+	}
+
+	if err != pgx.ErrNoRows {
+		log.Println(err)
+		return 0, errors.New("Error getting the damage reports of the copy")
+	}
+
+	err = db.QueryRow(context.Background(), "insert into damage_reports (copy_id, loan_id, borrower_id, condition, notes, reported_by) values ($1, $2, $3, $4, $5, $6) returning id",
+		copyID, loan, borrower, condition, notes, reportedBy).Scan(&reportID)
+	if err != nil {
+		log.Println(err)
+		return 0, errors.New("Error creating the damage report")
+	}
+
+	return reportID, nil
+}
+
+// setCopyStatus moves a copy to another status and keeps the quantity of the book in step with it,
+// only available copies count towards the quantity. A borrowed copy is returned on behalf of the borrower, who is fined
+// like when they check it in, and a copy on hold is taken away from the patron it was put aside for.
+func setCopyStatus(tx Querier, copy Copy, userID int, status string) error {
+	if copy.Status == status {
+		return nil
+	}
+
+	delta := 0
+	if copy.Status == "available" {
+		delta = -1
+	} else if status == "available" {
+		delta = 1
+	}
+
+	if copy.Status == "borrowed" {
+		loanID := 0
+		err := tx.QueryRow(context.Background(), "select id from borrowed_books where copy_id = $1 and returned_at is null", copy.ID).Scan(&loanID)
+		if err != nil && err != pgx.ErrNoRows {
+			log.Println(err)
+			return errors.New("Error returning the copy")
+		}
+
+		if loanID != 0 {
+			if _, err = closeLoan(tx, loanID, userID); err != nil {
+				return err
+			}
+		}
+	}
+
+	// The patron the copy was on hold for goes back to the front of the queue.
+	if copy.Status == holds.CopyOnHold {
+		_, err := tx.Exec(context.Background(), "update book_reservations set status = 'waiting', ready_at = null, pickup_by = null, copy_id = null "+
+			"where copy_id = $1 and status = 'ready'", copy.ID)
+		if err != nil {
+			log.Println(err)
+			return errors.New("Error taking the copy off the hold shelf")
+		}
+	}
+
+	if delta != 0 {
+		quantity := 0
+		err := tx.QueryRow(context.Background(), "update books set quantity = greatest(quantity + $1, 0) where id = $2 returning quantity", delta, copy.BookID).Scan(&quantity)
+		if err != nil {
+			log.Println(err)
+			return errors.New("Error updating the quantity of the book")
+		}
+
+		if err = RecordBookChange(tx, copy.BookID, userID, "quantity", strconv.Itoa(quantity-delta), strconv.Itoa(quantity)); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(context.Background(), "update copies set status = $1 where id = $2", status, copy.ID); err != nil {
+		log.Println(err)
+		return errors.New("Error changing the status of the copy")
+	}
+
+	return RecordBookChange(tx, copy.BookID, userID, "copy "+copy.Barcode+" status", copy.Status, status)
+}
+
+func setCopyCondition(tx Querier, copy Copy, userID int, condition string) error {
+	if copy.Condition == condition {
+		return nil
+	}
+
+	if _, err := tx.Exec(context.Background(), "update copies set condition = $1 where id = $2", condition, copy.ID); err != nil {
+		log.Println(err)
+		return errors.New("Error changing the condition of the copy")
+	}
+
+	return RecordBookChange(tx, copy.BookID, userID, "copy "+copy.Barcode+" condition", copy.Condition, condition)
+}
+
+// checkReturnedCopy records the condition a copy came back in, a damaged copy goes to repair instead of back on the shelf
+// and a damage report is opened for it, so a librarian can add photos and charge the borrower. It returns the id of the report.
+// userID is whoever checked the copy in, the borrower themselves or a librarian at the desk.
+func checkReturnedCopy(db Querier, copyID, loanID, borrowerID, userID int, condition, notes string) (int, error) {
+	var copy Copy
+	err := db.QueryRow(context.Background(), "select id, book_id, barcode, room, shelf, status, condition from copies where id = $1 for update", copyID).Scan(
+		&copy.ID, &copy.BookID, &copy.Barcode, &copy.Room, &copy.Shelf, &copy.Status, &copy.Condition)
+	if err != nil {
+		log.Println(err)
+		return 0, errors.New("Error getting the returned copy")
+	}
+
+	if err = setCopyCondition(db, copy, userID, condition); err != nil {
+		return 0, err
+	}
+
+	if condition != "damaged" {
+		return 0, nil
+	}
+
+	reportID, err := openDamageReport(db, copy.ID, loanID, borrowerID, userID, condition, notes)
+	if err != nil {
+		return 0, err
+	}
+
+	return reportID, setCopyStatus(db, copy, userID, "repair")
+}
+
+// getCopyForUpdate locks the book of the copy and then the copy, in the same order the loans and the returns lock them.
+func getCopyForUpdate(tx Querier, barcode string) (Copy, error) {
+	var bookID int
+	err := tx.QueryRow(context.Background(), "select book_id from copies where barcode = $1", strings.TrimSpace(barcode)).Scan(&bookID)
+	if err != nil {
+		return Copy{}, err
+	}
+
+	if _, err = lockBook(tx, bookID); err != nil {
+		return Copy{}, err
+	}
+
+	var copy Copy
+	err = tx.QueryRow(context.Background(), "select id, book_id, barcode, room, shelf, status, condition from copies where barcode = $1 for update", strings.TrimSpace(barcode)).Scan(
+		&copy.ID, &copy.BookID, &copy.Barcode, &copy.Room, &copy.Shelf, &copy.Status, &copy.Condition)
+	return copy, err
+}
+
+// readDamagePhotos reads the photos uploaded with a damage report, every photo has to be an image of at most 10MB.
+func readDamagePhotos(c *gin.Context) ([][]byte, []string, error) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil, nil, nil
+	}
+
+	headers := form.File["photos"]
+	if len(headers) > maxDamagePhotos {
+		return nil, nil, fmt.Errorf("Error a damage report can have at most %d photos", maxDamagePhotos)
+	}
+
+	var photos [][]byte
+	var contentTypes []string
+	for _, header := range headers {
+		if header.Size > maxDamagePhotoSize {
+			return nil, nil, errors.New("Error a photo can't be larger than 10MB")
+		}
+
+		file, err := header.Open()
+		if err != nil {
+			log.Println(err)
+			return nil, nil, errors.New("Error unable to open the uploaded photo")
+		}
+
+		data, err := io.ReadAll(io.LimitReader(file, maxDamagePhotoSize))
+		file.Close()
+		if err != nil {
+			log.Println(err)
+			return nil, nil, errors.New("Error unable to read the uploaded photo")
+		}
+
+		contentType := http.DetectContentType(data)
+		if !strings.HasPrefix(contentType, "image/") {
+			return nil, nil, errors.New("Error the photos of the damage have to be images")
+		}
+
+		photos = append(photos, data)
+		contentTypes = append(contentTypes, contentType)
+	}
+
+	return photos, contentTypes, nil
+}
+
+// ReportDamage files a damage report for a copy (multipart form: token, barcode, condition, notes, withdraw, charge and photos).
+// The copy goes to repair, or is withdrawn, and stops counting as available. A copy that is still on loan is returned
+// on behalf of the borrower and the borrower of the last loan can be charged for the damage. When a report is already
+// open for the copy, e.g. because it was returned damaged, the notes, the photos and the charge are added to it.
+func ReportDamage(c *gin.Context) {
+	userID, accountType, err := ValidateJWT(c.PostForm("token"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return
+	}
+
+	if accountType != "librarian" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error only librarians can report damaged copies"})
+		return
+	}
+
+	barcode := strings.TrimSpace(c.PostForm("barcode"))
+	if barcode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided barcode"})
+		return
+	}
+
+	condition := c.DefaultPostForm("condition", "damaged")
+	if !validCondition(condition) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error the condition must be one of " + strings.Join(Conditions, ", ")})
+		return
+	}
+	notes := strings.TrimSpace(c.PostForm("notes"))
+	withdraw := c.PostForm("withdraw") == "true"
+
+	charge := 0.0
+	if value := c.PostForm("charge"); value != "" {
+		charge, err = strconv.ParseFloat(value, 64)
+		if err != nil || !ledger.ValidAmount(charge) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": ledger.ErrInvalidAmount.Error()})
+			return
+		}
+	}
+
+	photos, contentTypes, err := readDamagePhotos(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var store storage.Storage
+	if len(photos) > 0 {
+		if store, err = getStorage(); err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error the file storage is not configured correctly"})
+			return
+		}
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error couldn't connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = CreateDamageReportsTable(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reporting the damage"})
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	copy, err := getCopyForUpdate(tx, barcode)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Error there is no copy with this barcode"})
+			return
+		}
+
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the copy"})
+		return
+	}
+
+	if copy.Status == "withdrawn" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Error this copy has already been withdrawn"})
+		return
+	}
+
+	loanID, borrowerID := 0, 0
+	err = tx.QueryRow(context.Background(), "select id, user_id from borrowed_books where copy_id = $1 order by returned_at is null desc, returned_at desc, id desc limit 1",
+		copy.ID).Scan(&loanID, &borrowerID)
+	if err != nil && err != pgx.ErrNoRows {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the last loan of the copy"})
+		return
+	}
+
+	if charge > 0 && borrowerID == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Error this copy has never been borrowed, there is nobody to charge"})
+		return
+	}
+
+	reportID, err := openDamageReport(tx, copy.ID, loanID, borrowerID, userID, condition, notes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	status := "repair"
+	if withdraw {
+		status = "withdrawn"
+	}
+
+	if err = setCopyStatus(tx, copy, userID, status); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err = setCopyCondition(tx, copy, userID, condition); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if withdraw {
+		_, err = tx.Exec(context.Background(), "update damage_reports set resolution = 'withdrawn', resolved_at = current_timestamp where id = $1", reportID)
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error closing the damage report"})
+			return
+		}
+	}
+
+	if charge > 0 {
+		charged := false
+		if err = tx.QueryRow(context.Background(), "select charge_id is not null from damage_reports where id = $1", reportID).Scan(&charged); err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the damage report"})
+			return
+		}
+
+		if charged {
+			c.JSON(http.StatusConflict, gin.H{"error": "Error the borrower has already been charged for this damage"})
+			return
+		}
+
+		entry, err := ledger.Charge(tx, borrowerID, ledger.KindDamage, charge, "Damage to the copy "+copy.Barcode, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if _, err = tx.Exec(context.Background(), "update damage_reports set charge_id = $1 where id = $2", entry.ID, reportID); err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving the charge of the damage"})
+			return
+		}
+	}
+
+	var photoURLs []string
+	for i, photo := range photos {
+		extension := strings.TrimPrefix(contentTypes[i], "image/")
+		key := fmt.Sprintf("damage/%d/%d-%d.%s", reportID, time.Now().UnixNano(), i, extension)
+		if err = store.Put(c.Request.Context(), key, bytes.NewReader(photo), contentTypes[i]); err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to store the photos of the damage"})
+			return
+		}
+
+		photoURLs = append(photoURLs, store.URL(key))
+	}
+
+	if len(photoURLs) > 0 {
+		if _, err = tx.Exec(context.Background(), "update damage_reports set photos = photos || $1 where id = $2", photoURLs, reportID); err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving the photos of the damage"})
+			return
+		}
+	}
+
+	var report DamageReport
+	err = tx.QueryRow(context.Background(), "select "+damageReportColumns+" from "+damageReportTables+" where d.id = $1", reportID).Scan(report.fields()...)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the damage report"})
+		return
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reporting the damage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"report": report})
+}
+
+// ResolveDamage closes an open damage report: a "repaired" copy goes back on the shelf (and to the users waiting for it),
+// a "withdrawn" copy leaves the collection for good.
+func ResolveDamage(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && reportID && resolution && condition (optional)
+
+	token, _ := information["token"].(string)
+	userID, accountType, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return
+	}
+
+	if accountType != "librarian" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error only librarians can close damage reports"})
+		return
+	}
+
+	reportID, ok := information["reportID"].(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided id of the damage report"})
+		return
+	}
+
+	resolution, _ := information["resolution"].(string)
+	if resolution != "repaired" && resolution != "withdrawn" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error the resolution must be repaired or withdrawn"})
+		return
+	}
+
+	condition, ok := information["condition"].(string)
+	if !ok {
+		condition = "fair"
+	}
+
+	if !validCondition(condition) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error the condition must be one of " + strings.Join(Conditions, ", ")})
+		return
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error couldn't connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = CreateDamageReportsTable(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error closing the damage report"})
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	var report DamageReport
+	err = tx.QueryRow(context.Background(), "select "+damageReportColumns+" from "+damageReportTables+" where d.id = $1 for update of d", int(reportID)).Scan(report.fields()...)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Error there is no such damage report"})
+			return
+		}
+
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the damage report"})
+		return
+	}
+
+	if report.Resolution != "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Error this damage report has already been closed"})
+		return
+	}
+
+	copy, err := getCopyForUpdate(tx, report.Barcode)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the copy"})
+		return
+	}
+
+	status := "withdrawn"
+	if resolution == "repaired" {
+		status = "available"
+		if err = setCopyCondition(tx, copy, userID, condition); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err = setCopyStatus(tx, copy, userID, status); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = tx.QueryRow(context.Background(), "update damage_reports set resolution = $1, resolved_at = current_timestamp where id = $2 returning resolved_at",
+		resolution, report.ID).Scan(&report.ResolvedAt)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error closing the damage report"})
+		return
+	}
+	report.Resolution = resolution
+
+	if resolution == "repaired" {
+		if err = FulfilReservations(tx, Book{ID: copy.BookID}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error closing the damage report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"report": report})
+}
+
+// GetDamageReports lists the damage reports, the open ones by default (?all=true for every report, ?barcode= for one copy).
+func GetDamageReports(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && barcode (optional) && all (optional)
+
+	token, _ := information["token"].(string)
+	_, accountType, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return
+	}
+
+	if accountType != "librarian" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error only librarians can see the damage reports"})
+		return
+	}
+
+	barcode, _ := information["barcode"].(string)
+	all, _ := information["all"].(bool)
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error couldn't connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = CreateDamageReportsTable(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := conn.Query(context.Background(), "select "+damageReportColumns+" from "+damageReportTables+" where ($1 or d.resolution = '') "+
+		"and ($2 = '' or c.barcode = $2) order by d.created_at desc", all, strings.TrimSpace(barcode))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the damage reports"})
+		return
+	}
+	defer rows.Close()
+
+	reports := []DamageReport{}
+	for rows.Next() {
+		var report DamageReport
+		if err = rows.Scan(report.fields()...); err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error working with the damage reports"})
+			return
+		}
+
+		reports = append(reports, report)
+	}
+
+	if rows.Err() != nil {
+		log.Println(rows.Err())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error working with the damage reports"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"reports": reports})
+}
@@ -0,0 +1,152 @@
+package books
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"os"
+	"time"
+
+	"github.com/Phantomvv1/Library_management/internal/ledger"
+	"github.com/jackc/pgx/v5"
+)
+
+// accrueFine charges the borrower of the loan whatever its policy asks for on the day on and hasn't been charged yet,
+// a returned loan stops accruing on the day it was returned and a missing one on the day it went missing. It returns the whole fine of the loan.
+func accrueFine(db Querier, loanID int, on time.Time) (float64, error) {
+	var userID int
+	var due time.Time
+	var returnedAt, missingSince *time.Time
+	var book Book
+	err := db.QueryRow(context.Background(), "select l.user_id, l.return_date, l.returned_at, l.missing_since, b.id, b.title, b.item_category from borrowed_books l "+
+		"join books b on l.book_id = b.id where l.id = $1 for update of l", loanID).Scan(&userID, &due, &returnedAt, &missingSince, &book.ID, &book.Title, &book.Category)
+	if err != nil {
+		log.Println(err)
+		return 0, errors.New("Error getting the loan to fine")
+	}
+
+	if returnedAt != nil && returnedAt.Before(on) {
+		on = *returnedAt
+	}
+
+	if missingSince != nil && missingSince.Before(on) {
+		on = *missingSince
+	}
+
+	policy, err := LoanPolicy(db, userID, book)
+	if err != nil {
+		return 0, err
+	}
+
+	fine := policy.Fine(due, on)
+	charged, err := ledger.LoanCharged(db, loanID, ledger.KindFine)
+	if err != nil {
+		return 0, err
+	}
+
+	if owed := math.Round((fine-charged)*100) / 100; owed > 0 {
+		_, err = ledger.ChargeLoan(db, userID, loanID, ledger.KindFine, owed, "Overdue fine for "+book.Title+" due on "+due.Format(time.DateOnly), 0)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return math.Max(fine, charged), nil
+}
+
+// AccrueFines brings the fines of every overdue loan up to date and returns how many loans were fined.
+func AccrueFines(conn *pgx.Conn) (int, error) {
+	rows, err := conn.Query(context.Background(), "select id from borrowed_books where returned_at is null and missing = '' and return_date < current_date")
+	if err != nil {
+		log.Println(err)
+		return 0, errors.New("Error getting the overdue loans")
+	}
+
+	var loans []int
+	for rows.Next() {
+		var loanID int
+		if err = rows.Scan(&loanID); err != nil {
+			rows.Close()
+			log.Println(err)
+			return 0, errors.New("Error working with the overdue loans")
+		}
+
+		loans = append(loans, loanID)
+	}
+	rows.Close()
+
+	if rows.Err() != nil {
+		log.Println(rows.Err())
+		return 0, errors.New("Error working with the overdue loans")
+	}
+
+	fined := 0
+	now := time.Now()
+	for _, loanID := range loans {
+		fine, err := accrueLoanFine(conn, loanID, now)
+		if err != nil {
+			return fined, err
+		}
+
+		if fine > 0 {
+			fined++
+		}
+	}
+
+	return fined, nil
+}
+
+// accrueLoanFine runs accrueFine in a transaction of its own, the loan stays locked until the fine is charged
+// so a return at the same time can't charge it twice.
+func accrueLoanFine(conn *pgx.Conn, loanID int, now time.Time) (float64, error) {
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		log.Println(err)
+		return 0, errors.New("Error fining the loan")
+	}
+	defer tx.Rollback(context.Background())
+
+	fine, err := accrueFine(tx, loanID, now)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		log.Println(err)
+		return 0, errors.New("Error fining the loan")
+	}
+
+	return fine, nil
+}
+
+// StartFineWorker accrues the fines of the overdue loans every interval until the context is cancelled,
+// charging the same day twice adds nothing so the interval only decides how soon a new day shows up.
+func StartFineWorker(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				conn, err := pgx.Connect(ctx, os.Getenv("DATABASE_URL"))
+				if err != nil {
+					log.Println(err)
+					continue
+				}
+
+				if err = CreateCirculationTables(conn); err != nil {
+					log.Println(err)
+				} else if fined, err := AccrueFines(conn); err != nil {
+					log.Println(err)
+				} else if fined > 0 {
+					log.Printf("Accrued the fines of %d overdue loans\n", fined)
+				}
+				conn.Close(context.Background())
+			}
+		}
+	}()
+}
@@ -0,0 +1,243 @@
+package books
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	. "github.com/Phantomvv1/Library_management/internal/authentication"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+var ErrInvalidPage = errors.New("Error the page has to be a positive number and the limit a number between 1 and 100")
+
+// Page is one page of a list, Number starts at 1.
+type Page struct {
+	Number int `json:"page"`
+	Size   int `json:"limit"`
+}
+
+func (p Page) Offset() int {
+	return (p.Number - 1) * p.Size
+}
+
+// PageFrom reads the optional "page" and "limit" of a request, without them the first DefaultPageSize entries are returned.
+func PageFrom(information map[string]interface{}) (Page, error) {
+	page := Page{Number: 1, Size: DefaultPageSize}
+	if value, ok := information["page"]; ok {
+		number, ok := value.(float64)
+		if !ok || number < 1 || number != float64(int(number)) {
+			return Page{}, ErrInvalidPage
+		}
+		page.Number = int(number)
+	}
+
+	if value, ok := information["limit"]; ok {
+		size, ok := value.(float64)
+		if !ok || size < 1 || size > MaxPageSize || size != float64(int(size)) {
+			return Page{}, ErrInvalidPage
+		}
+		page.Size = int(size)
+	}
+
+	return page, nil
+}
+
+// HistoryEntry is a loan in the borrowing history of a patron. The dates of the loans migrated from the old history
+// of titles aren't known, so they are nil.
+type HistoryEntry struct {
+	LoanID     int        `json:"loanID"`
+	UserID     int        `json:"userID"`
+	BookID     int        `json:"bookID"`
+	Title      string     `json:"title"`
+	Author     string     `json:"author"`
+	CopyID     int        `json:"copyID"`
+	Barcode    string     `json:"barcode"`
+	BorrowedAt *time.Time `json:"borrowedAt"`
+	DueDate    *time.Time `json:"dueDate"`
+	ReturnedAt *time.Time `json:"returnedAt"`
+	Migrated   bool       `json:"migrated"`
+}
+
+// HistoryLeftover is a title MigrateHistory left in the old history of a user because no book or more than one book has it.
+type HistoryLeftover struct {
+	UserID int    `json:"userID"`
+	Title  string `json:"title"`
+	Books  int    `json:"books"`
+}
+
+// MigrateHistory turns the titles kept in the old history arrays of the users into loans, the loans are marked as migrated since
+// nobody knows when they were made. Only a title that matches exactly one book is moved, the others are returned to be sorted out by hand.
+// Once nothing is left, or with drop, the history column is dropped. It is run once with "catalog migrate-history", never by a request.
+func MigrateHistory(conn *pgx.Conn, drop bool) ([]HistoryLeftover, error) {
+	exists := false
+	err := conn.QueryRow(context.Background(), "select exists (select 1 from information_schema.columns where table_name = 'authentication' and column_name = 'history')").Scan(&exists)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("Error checking the history of the users")
+	}
+
+	leftovers := []HistoryLeftover{}
+	if !exists {
+		return leftovers, nil
+	}
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("Error moving the history of the users to their loans")
+	}
+	defer tx.Rollback(context.Background())
+
+	// Users signing up or changing while the history is moved would be missed.
+	_, err = tx.Exec(context.Background(), "lock table authentication in share row exclusive mode")
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("Error moving the history of the users to their loans")
+	}
+
+	_, err = tx.Exec(context.Background(), "insert into borrowed_books (book_id, user_id, borrowed_at, returned_at, migrated) "+
+		"select distinct b.id, a.id, null::timestamp, current_timestamp, true from authentication a cross join unnest(a.history) h(title) join books b on b.title = h.title "+
+		"where (select count(*) from books x where x.title = h.title) = 1 "+
+		"and not exists (select 1 from borrowed_books l where l.user_id = a.id and l.book_id = b.id)")
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("Error moving the history of the users to their loans")
+	}
+
+	_, err = tx.Exec(context.Background(), "update authentication a set history = array(select t from unnest(a.history) t where (select count(*) from books b where b.title = t) <> 1) "+
+		"where exists (select 1 from unnest(a.history) t where (select count(*) from books b where b.title = t) = 1)")
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("Error moving the history of the users to their loans")
+	}
+
+	rows, err := tx.Query(context.Background(), "select distinct a.id, h.title, (select count(*) from books b where b.title = h.title) from authentication a "+
+		"cross join unnest(a.history) h(title) order by a.id, h.title")
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("Error getting the history that wasn't moved")
+	}
+
+	for rows.Next() {
+		var leftover HistoryLeftover
+		if err = rows.Scan(&leftover.UserID, &leftover.Title, &leftover.Books); err != nil {
+			rows.Close()
+			log.Println(err)
+			return nil, errors.New("Error getting the history that wasn't moved")
+		}
+
+		leftovers = append(leftovers, leftover)
+	}
+	rows.Close()
+
+	if rows.Err() != nil {
+		log.Println(rows.Err())
+		return nil, errors.New("Error getting the history that wasn't moved")
+	}
+
+	if len(leftovers) == 0 || drop {
+		if _, err = tx.Exec(context.Background(), "alter table authentication drop column history"); err != nil {
+			log.Println(err)
+			return nil, errors.New("Error dropping the old history of the users")
+		}
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		log.Println(err)
+		return nil, errors.New("Error moving the history of the users to their loans")
+	}
+
+	return leftovers, nil
+}
+
+// LoanHistory returns a page of the loans of the user, the latest first, and how many loans there are. With userID 0 the loans of everybody are returned.
+func LoanHistory(db Querier, userID int, page Page) ([]HistoryEntry, int, error) {
+	total := 0
+	err := db.QueryRow(context.Background(), "select count(*) from borrowed_books where $1 = 0 or user_id = $1", userID).Scan(&total)
+	if err != nil {
+		log.Println(err)
+		return nil, 0, errors.New("Error counting the loans")
+	}
+
+	rows, err := db.Query(context.Background(), "select l.id, l.user_id, coalesce(l.book_id, 0), coalesce(b.title, ''), coalesce(b.author, ''), coalesce(l.copy_id, 0), "+
+		"coalesce(c.barcode, ''), l.borrowed_at, l.return_date, case when l.migrated then null else l.returned_at end, l.migrated from borrowed_books l "+
+		"left join books b on b.id = l.book_id left join copies c on c.id = l.copy_id where $1 = 0 or l.user_id = $1 "+
+		"order by l.borrowed_at desc nulls last, l.id desc limit $2 offset $3", userID, page.Size, page.Offset())
+	if err != nil {
+		log.Println(err)
+		return nil, 0, errors.New("Error getting the loans")
+	}
+	defer rows.Close()
+
+	history := []HistoryEntry{}
+	for rows.Next() {
+		var entry HistoryEntry
+		err = rows.Scan(&entry.LoanID, &entry.UserID, &entry.BookID, &entry.Title, &entry.Author, &entry.CopyID, &entry.Barcode, &entry.BorrowedAt,
+			&entry.DueDate, &entry.ReturnedAt, &entry.Migrated)
+		if err != nil {
+			log.Println(err)
+			return nil, 0, errors.New("Error working with the loans")
+		}
+
+		history = append(history, entry)
+	}
+
+	if rows.Err() != nil {
+		log.Println(rows.Err())
+		return nil, 0, errors.New("Error working with the loans")
+	}
+
+	return history, total, nil
+}
+
+// GetHistory returns a page of the loans of the caller, the latest first.
+func GetHistory(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && page (optional) && limit (optional)
+
+	token, _ := information["token"].(string)
+	id, _, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := PageFrom(information)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = CreateCirculationTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	history, total, err := LoanHistory(conn, id, page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"history": history, "page": page.Number, "limit": page.Size, "total": total})
+}
@@ -0,0 +1,397 @@
+package books
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	. "github.com/Phantomvv1/Library_management/internal/authentication"
+	"github.com/Phantomvv1/Library_management/internal/holds"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// Reservation is the place of a patron in the queue for a book.
+type Reservation struct {
+	ID             int        `json:"id"`
+	BookID         int        `json:"bookID"`
+	Title          string     `json:"title"`
+	UserID         int        `json:"userID"`
+	Status         string     `json:"status"`
+	CopyID         int        `json:"copyID"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	ReadyAt        *time.Time `json:"readyAt"`
+	PickupBy       *time.Time `json:"pickupBy"`
+	Position       int        `json:"position"`
+	EstimatedReady *time.Time `json:"estimatedReady"`
+}
+
+// holdNextReservation puts a copy of the book aside for the first patron waiting for it, who then has holds.PickupDays to collect it.
+// copyID is the copy to put aside, with 0 any available copy of the book is used. It reports whether anybody was waiting.
+func holdNextReservation(db Querier, book Book, copyID int) (bool, error) {
+	var reservationID int
+	err := db.QueryRow(context.Background(), "select id from book_reservations where book_id = $1 and status = 'waiting' order by id limit 1", book.ID).Scan(&reservationID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return false, nil
+		}
+
+		log.Println(err)
+		return false, errors.New("Error checking if the book is reserved")
+	}
+
+	return true, holdReservation(db, book, reservationID, copyID)
+}
+
+// HoldFor puts a copy of the book aside for the user ahead of the queue, like a book bought because they suggested it.
+// A reservation they already have is used instead of a new one. It reports false when a copy is already on hold for them
+// or there is no copy left to put aside.
+func HoldFor(db Querier, book Book, userID int) (bool, error) {
+	var err error
+	if book.Quantity, err = lockBook(db, book.ID); err != nil {
+		return false, err
+	}
+
+	reservationID, status := 0, ""
+	err = db.QueryRow(context.Background(), "select id, status from book_reservations where book_id = $1 and user_id = $2 and status in ('waiting', 'ready') order by id limit 1",
+		book.ID, userID).Scan(&reservationID, &status)
+	if err != nil && err != pgx.ErrNoRows {
+		log.Println(err)
+		return false, errors.New("Error checking the reservations of the user")
+	}
+
+	if status == holds.StatusReady || book.Quantity < 1 {
+		return false, nil
+	}
+
+	if reservationID == 0 {
+		err = db.QueryRow(context.Background(), "insert into book_reservations (book_id, user_id) values ($1, $2) returning id", book.ID, userID).Scan(&reservationID)
+		if err != nil {
+			log.Println(err)
+			return false, errors.New("Error reserving the book")
+		}
+	}
+
+	return true, holdReservation(db, book, reservationID, 0)
+}
+
+// holdReservation puts a copy of the book aside for the reservation, copyID is the copy to put aside like in holdNextReservation.
+func holdReservation(db Querier, book Book, reservationID, copyID int) error {
+	if copyID == 0 {
+		err := db.QueryRow(context.Background(), "select id from copies where book_id = $1 and status = 'available' order by id limit 1", book.ID).Scan(&copyID)
+		if err != nil && err != pgx.ErrNoRows {
+			log.Println(err)
+			return errors.New("Error finding a copy to put aside")
+		}
+	}
+
+	var copy *int
+	if copyID != 0 {
+		copy = &copyID
+	}
+
+	_, err := db.Exec(context.Background(), "update book_reservations set status = 'ready', ready_at = current_timestamp, pickup_by = $1, copy_id = $2 where id = $3",
+		holds.PickupDeadline(time.Now()), copy, reservationID)
+	if err != nil {
+		log.Println(err)
+		return errors.New("Error putting the book aside")
+	}
+
+	_, err = db.Exec(context.Background(), "update books set quantity = quantity - 1 where id = $1;", book.ID)
+	if err != nil {
+		log.Println(err)
+		return errors.New("Error updating the database")
+	}
+
+	if copyID != 0 {
+		_, err = db.Exec(context.Background(), "update copies set status = $1 where id = $2", holds.CopyOnHold, copyID)
+		if err != nil {
+			log.Println(err)
+			return errors.New("Error putting the copy on hold")
+		}
+	}
+
+	return nil
+}
+
+// releaseHold puts a book that was set aside but not collected back on the shelf and passes it to the next patron waiting.
+func releaseHold(db Querier, bookID, copyID int) error {
+	if copyID != 0 {
+		_, err := db.Exec(context.Background(), "update copies set status = 'available' where id = $1 and status = $2", copyID, holds.CopyOnHold)
+		if err != nil {
+			log.Println(err)
+			return errors.New("Error putting the copy back on the shelf")
+		}
+	}
+
+	_, err := db.Exec(context.Background(), "update books set quantity = quantity + 1 where id = $1;", bookID)
+	if err != nil {
+		log.Println(err)
+		return errors.New("Error adding the book to our inventory")
+	}
+
+	return FulfilReservations(db, Book{ID: bookID})
+}
+
+// readyHold returns the reservation of the user the book is ready for and the copy put aside for it, both are 0 when there isn't one.
+func readyHold(db Querier, userID, bookID int) (int, int, error) {
+	var reservationID, copyID int
+	err := db.QueryRow(context.Background(), "select id, coalesce(copy_id, 0) from book_reservations where user_id = $1 and book_id = $2 and status = 'ready' "+
+		"order by id limit 1", userID, bookID).Scan(&reservationID, &copyID)
+	if err != nil && err != pgx.ErrNoRows {
+		log.Println(err)
+		return 0, 0, errors.New("Error checking if the book is on hold for you")
+	}
+
+	return reservationID, copyID, nil
+}
+
+func collectHold(db Querier, reservationID int) error {
+	_, err := db.Exec(context.Background(), "update book_reservations set status = 'collected' where id = $1", reservationID)
+	if err != nil {
+		log.Println(err)
+		return errors.New("Error closing the reservation of the book")
+	}
+
+	return nil
+}
+
+// ExpireHolds expires the holds that weren't collected in time and passes the books to the next patrons, it returns how many expired.
+// Every hold expires in a transaction of its own that locks the book like the loans and the returns do.
+func ExpireHolds(conn *pgx.Conn) (int, error) {
+	rows, err := conn.Query(context.Background(), "select id, book_id from book_reservations where status = 'ready' and pickup_by < current_date order by id")
+	if err != nil {
+		log.Println(err)
+		return 0, errors.New("Error getting the expired holds")
+	}
+
+	var expired [][2]int
+	for rows.Next() {
+		var hold [2]int
+		if err = rows.Scan(&hold[0], &hold[1]); err != nil {
+			rows.Close()
+			log.Println(err)
+			return 0, errors.New("Error working with the expired holds")
+		}
+
+		expired = append(expired, hold)
+	}
+	rows.Close()
+
+	if rows.Err() != nil {
+		log.Println(rows.Err())
+		return 0, errors.New("Error working with the expired holds")
+	}
+
+	count := 0
+	for _, hold := range expired {
+		done, err := expireHold(conn, hold[0], hold[1])
+		if err != nil {
+			return count, err
+		}
+
+		if done {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// expireHold expires a single hold, it reports false when the hold was collected or cancelled in the meantime.
+func expireHold(conn *pgx.Conn, reservationID, bookID int) (bool, error) {
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		log.Println(err)
+		return false, errors.New("Error expiring the hold")
+	}
+	defer tx.Rollback(context.Background())
+
+	if _, err = lockBook(tx, bookID); err != nil {
+		return false, err
+	}
+
+	var copyID int
+	err = tx.QueryRow(context.Background(), "update book_reservations set status = 'expired' where id = $1 and status = 'ready' and pickup_by < current_date "+
+		"returning coalesce(copy_id, 0)", reservationID).Scan(&copyID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return false, nil
+		}
+
+		log.Println(err)
+		return false, errors.New("Error expiring the hold")
+	}
+
+	if err = releaseHold(tx, bookID, copyID); err != nil {
+		return false, err
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		log.Println(err)
+		return false, errors.New("Error expiring the hold")
+	}
+
+	return true, nil
+}
+
+// StartHoldWorker expires the holds that weren't collected in time every interval until the context is cancelled.
+func StartHoldWorker(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				conn, err := pgx.Connect(ctx, os.Getenv("DATABASE_URL"))
+				if err != nil {
+					log.Println(err)
+					continue
+				}
+
+				if err = CreateCirculationTables(conn); err != nil {
+					log.Println(err)
+				} else if expired, err := ExpireHolds(conn); err != nil {
+					log.Println(err)
+				} else if expired > 0 {
+					log.Printf("Expired %d holds that weren't collected\n", expired)
+				}
+				conn.Close(context.Background())
+			}
+		}
+	}()
+}
+
+// estimateReservation fills in the position of a waiting reservation in the queue and when the book should be ready for it.
+func estimateReservation(db Querier, reservation *Reservation) error {
+	reservation.Position, reservation.EstimatedReady = 0, nil
+	if reservation.Status != holds.StatusWaiting {
+		return nil
+	}
+
+	err := db.QueryRow(context.Background(), "select count(*) from book_reservations where book_id = $1 and status = 'waiting' and id <= $2",
+		reservation.BookID, reservation.ID).Scan(&reservation.Position)
+	if err != nil {
+		log.Println(err)
+		return errors.New("Error getting the position in the queue")
+	}
+
+	rows, err := db.Query(context.Background(), "select return_date from borrowed_books where book_id = $1 and returned_at is null and missing = ''", reservation.BookID)
+	if err != nil {
+		log.Println(err)
+		return errors.New("Error getting the loans of the book")
+	}
+
+	var dueDates []time.Time
+	for rows.Next() {
+		var due time.Time
+		if err = rows.Scan(&due); err != nil {
+			rows.Close()
+			log.Println(err)
+			return errors.New("Error working with the loans of the book")
+		}
+
+		dueDates = append(dueDates, due)
+	}
+	rows.Close()
+
+	if rows.Err() != nil {
+		log.Println(rows.Err())
+		return errors.New("Error working with the loans of the book")
+	}
+
+	book := Book{ID: reservation.BookID}
+	err = db.QueryRow(context.Background(), "select item_category from books where id = $1", book.ID).Scan(&book.Category)
+	if err != nil {
+		log.Println(err)
+		return errors.New("Error getting the book")
+	}
+
+	policy, err := LoanPolicy(db, reservation.UserID, book)
+	if err != nil {
+		return err
+	}
+
+	reservation.EstimatedReady = holds.EstimateReady(dueDates, reservation.Position, policy.LoanDays, time.Now())
+	return nil
+}
+
+// GetReservations lists the reservations of the caller that are still waiting or ready for pickup with their place in the queue
+// and when the book should be ready, librarians can ask for any patron with "userID".
+func GetReservations(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && userID (optional)
+
+	token, _ := information["token"].(string)
+	userID, accountType, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return
+	}
+
+	if patronID, ok := information["userID"].(float64); ok && int(patronID) != userID {
+		if accountType != "librarian" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Error you can only see your own reservations"})
+			return
+		}
+		userID = int(patronID)
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = CreateCirculationTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := conn.Query(context.Background(), "select r.id, r.book_id, b.title, r.user_id, r.status, coalesce(r.copy_id, 0), r.created_at, r.ready_at, r.pickup_by "+
+		"from book_reservations r join books b on r.book_id = b.id where r.user_id = $1 and r.status in ('waiting', 'ready') order by r.id", userID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the reservations"})
+		return
+	}
+
+	reservations := []Reservation{}
+	for rows.Next() {
+		var r Reservation
+		if err = rows.Scan(&r.ID, &r.BookID, &r.Title, &r.UserID, &r.Status, &r.CopyID, &r.CreatedAt, &r.ReadyAt, &r.PickupBy); err != nil {
+			rows.Close()
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error working with the reservations"})
+			return
+		}
+
+		reservations = append(reservations, r)
+	}
+	rows.Close()
+
+	if rows.Err() != nil {
+		log.Println(rows.Err())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error working with the reservations"})
+		return
+	}
+
+	for i := range reservations {
+		if err = estimateReservation(conn, &reservations[i]); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"reservations": reservations})
+}
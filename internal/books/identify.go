@@ -0,0 +1,474 @@
+package books
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	. "github.com/Phantomvv1/Library_management/internal/authentication"
+	"github.com/Phantomvv1/Library_management/internal/blocks"
+	"github.com/Phantomvv1/Library_management/internal/ledger"
+	"github.com/Phantomvv1/Library_management/internal/notifications"
+	"github.com/Phantomvv1/Library_management/internal/policies"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrNoIdentifier   = errors.New("Error the book has to be identified by its id, ISBN or the barcode of a copy")
+	ErrAmbiguousTitle = errors.New("Error there are several books with this title, use the id, ISBN or barcode instead")
+)
+
+// Conditions lists the conditions a copy can be in, from the best to the worst.
+var Conditions = []string{"new", "good", "fair", "poor", "damaged"}
+
+func validCondition(condition string) bool {
+	for _, valid := range Conditions {
+		if condition == valid {
+			return true
+		}
+	}
+
+	return false
+}
+
+// BookNotFoundError is returned when no book matches the identifier, it carries similarly titled books as suggestions.
+type BookNotFoundError struct {
+	Suggestions []Book
+}
+
+func (e *BookNotFoundError) Error() string {
+	return "Error there is no such book in this library"
+}
+
+type Copy struct {
+	ID        int    `json:"id"`
+	BookID    int    `json:"bookID"`
+	Barcode   string `json:"barcode"`
+	Room      string `json:"room"`
+	Shelf     string `json:"shelf"`
+	Status    string `json:"status"`
+	Condition string `json:"condition"`
+}
+
+func CreateCopiesTable(conn *pgx.Conn) error {
+	_, err := conn.Exec(context.Background(), "create table if not exists copies (id serial primary key, book_id int not null references books(id) on delete cascade, "+
+		"barcode text not null unique, status text not null default 'available', added_at timestamp not null default current_timestamp);")
+	if err != nil {
+		log.Println(err)
+		return errors.New("Couldn't create a table for the copies of the books")
+	}
+
+	_, err = conn.Exec(context.Background(), "alter table copies add column if not exists shelf text not null default '', "+
+		"add column if not exists room text not null default '', add column if not exists condition text not null default 'good';")
+	if err != nil {
+		log.Println(err)
+		return errors.New("Couldn't add the shelves and the condition to the copies of the books")
+	}
+
+	_, err = conn.Exec(context.Background(), "alter table borrowed_books add column if not exists copy_id int references copies(id) on delete set null;")
+	if err != nil {
+		log.Println(err)
+		return errors.New("Couldn't add the copies to the borrowed books")
+	}
+
+	return nil
+}
+
+// CreateCirculationTables creates every table used when books are borrowed, returned and reserved.
+func CreateCirculationTables(conn *pgx.Conn) error {
+	if err := CreateAuthTable(conn); err != nil {
+		return err
+	}
+
+	if err := CreateBookTable(conn); err != nil {
+		return err
+	}
+
+	if err := CreateBookReservationsTable(conn); err != nil {
+		return err
+	}
+
+	if err := createBorrowedBooksTable(conn); err != nil {
+		return err
+	}
+
+	if err := policies.CreatePoliciesTable(conn); err != nil {
+		return err
+	}
+
+	if err := ledger.CreateLedgerTable(conn); err != nil {
+		return err
+	}
+
+	if err := blocks.CreateBlocksTables(conn); err != nil {
+		return err
+	}
+
+	if err := CreateCopiesTable(conn); err != nil {
+		return err
+	}
+
+	return notifications.CreateNotificationsTable(conn)
+}
+
+func suggestBooks(db Querier, text string) ([]Book, error) {
+	var patterns []string
+	for _, word := range strings.Fields(text) {
+		if len(word) >= 3 {
+			patterns = append(patterns, "%"+word+"%")
+		}
+	}
+
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+
+	rows, err := db.Query(context.Background(), "select "+bookColumns+" from books where title ilike any($1) or author ilike any($1) or isbn like any($1) order by title limit 5", patterns)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var suggestions []Book
+	for rows.Next() {
+		var book Book
+		if err = rows.Scan(book.fields()...); err != nil {
+			return nil, err
+		}
+
+		suggestions = append(suggestions, book)
+	}
+
+	return suggestions, rows.Err()
+}
+
+func identifierString(information map[string]interface{}, key string) string {
+	switch value := information[key].(type) {
+	case string:
+		return strings.TrimSpace(value)
+	case float64:
+		return strconv.FormatInt(int64(value), 10)
+	default:
+		return ""
+	}
+}
+
+// ResolveBook finds the book a request refers to by "id", "isbn" or "barcode" (in this order of preference),
+// the legacy "title" is accepted only when it matches exactly one book. When a copy barcode was used its id is returned too.
+func ResolveBook(db Querier, information map[string]interface{}) (Book, int, error) {
+	var book Book
+	copyID := 0
+	var err error
+	lookup := ""
+
+	switch {
+	case identifierString(information, "id") != "":
+		lookup = identifierString(information, "id")
+		id, convErr := strconv.Atoi(lookup)
+		if convErr != nil {
+			return book, 0, errors.New("Error unable to parse the id of the book")
+		}
+		err = db.QueryRow(context.Background(), "select "+bookColumns+" from books where id = $1", id).Scan(book.fields()...)
+	case identifierString(information, "isbn") != "":
+		lookup = identifierString(information, "isbn")
+		book, err = findBookByISBN(db, lookup)
+	case identifierString(information, "barcode") != "":
+		lookup = identifierString(information, "barcode")
+		err = db.QueryRow(context.Background(), "select id, book_id from copies where barcode = $1", lookup).Scan(&copyID, &book.ID)
+		if err == nil {
+			err = db.QueryRow(context.Background(), "select "+bookColumns+" from books where id = $1", book.ID).Scan(book.fields()...)
+		}
+	case identifierString(information, "title") != "":
+		lookup = identifierString(information, "title")
+		book, err = findBookByTitle(db, lookup)
+	default:
+		return book, 0, ErrNoIdentifier
+	}
+
+	if err == pgx.ErrNoRows {
+		suggestions, suggestErr := suggestBooks(db, lookup)
+		if suggestErr != nil {
+			log.Println(suggestErr)
+		}
+
+		return book, 0, &BookNotFoundError{Suggestions: suggestions}
+	}
+
+	return book, copyID, err
+}
+
+func findBookByISBN(db Querier, isbnString string) (Book, error) {
+	var book Book
+	id, err := findBookIDByISBN(db, isbnString)
+	if err != nil {
+		return book, err
+	}
+
+	err = db.QueryRow(context.Background(), "select "+bookColumns+" from books where id = $1", id).Scan(book.fields()...)
+	return book, err
+}
+
+func findBookByTitle(db Querier, title string) (Book, error) {
+	var book Book
+	rows, err := db.Query(context.Background(), "select "+bookColumns+" from books where title = $1 limit 2", title)
+	if err != nil {
+		return book, err
+	}
+	defer rows.Close()
+
+	found := 0
+	for rows.Next() {
+		if err = rows.Scan(book.fields()...); err != nil {
+			return book, err
+		}
+		found++
+	}
+
+	if rows.Err() != nil {
+		return book, rows.Err()
+	}
+
+	switch found {
+	case 0:
+		return book, pgx.ErrNoRows
+	case 1:
+		return book, nil
+	default:
+		return book, ErrAmbiguousTitle
+	}
+}
+
+// respondResolveError writes the response for an error returned by ResolveBook.
+func respondResolveError(c *gin.Context, err error) {
+	var notFound *BookNotFoundError
+	switch {
+	case errors.As(err, &notFound):
+		suggestions := notFound.Suggestions
+		if suggestions == nil {
+			suggestions = []Book{}
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound.Error(), "suggestions": suggestions})
+	case err == ErrAmbiguousTitle:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err == ErrNoIdentifier:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+}
+
+// AddCopy registers a physical copy of a book under a unique barcode. Unless "existing" is set
+// the copy is new to the library and the quantity of the book goes up by one.
+func AddCopy(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && bookID && barcode && room (optional) && shelf (optional) && condition (optional) && existing (optional)
+
+	token, ok := information["token"].(string)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided token"})
+		return
+	}
+
+	userID, accountType, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return
+	}
+
+	if accountType != "librarian" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error only librarians can add copies of books"})
+		return
+	}
+
+	bookID, ok := information["bookID"].(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided id of the book"})
+		return
+	}
+
+	barcode, ok := information["barcode"].(string)
+	if !ok || strings.TrimSpace(barcode) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided barcode"})
+		return
+	}
+	barcode = strings.TrimSpace(barcode)
+	room, _ := information["room"].(string)
+	room = strings.TrimSpace(room)
+	shelf, _ := information["shelf"].(string)
+	shelf = strings.TrimSpace(shelf)
+	condition, ok := information["condition"].(string)
+	if !ok {
+		condition = "good"
+	}
+
+	if !validCondition(condition) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error the condition must be one of " + strings.Join(Conditions, ", ")})
+		return
+	}
+	existing, _ := information["existing"].(bool)
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error couldn't connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = CreateCirculationTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err = CreateBookChangesTable(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adding the copy"})
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	copyID := 0
+	err = tx.QueryRow(context.Background(), "insert into copies (book_id, barcode, room, shelf, condition) values ($1, $2, $3, $4, $5) returning id",
+		int(bookID), barcode, room, shelf, condition).Scan(&copyID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Error there is already a copy with this barcode"})
+			return
+		}
+
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error unable to add a copy to this book"})
+		return
+	}
+
+	if !existing {
+		quantity := 0
+		err = tx.QueryRow(context.Background(), "update books set quantity = quantity + 1 where id = $1 returning quantity", int(bookID)).Scan(&quantity)
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating the quantity of the book"})
+			return
+		}
+
+		err = RecordBookChange(tx, int(bookID), userID, "quantity", strconv.Itoa(quantity-1), strconv.Itoa(quantity))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adding the copy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"copy": Copy{ID: copyID, BookID: int(bookID), Barcode: barcode, Room: room, Shelf: shelf, Status: "available", Condition: condition}})
+}
+
+// SetCopyCondition records the condition of a copy after an inspection, the change is kept in the history of the book.
+func SetCopyCondition(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && barcode && condition
+
+	token, _ := information["token"].(string)
+	userID, accountType, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return
+	}
+
+	if accountType != "librarian" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error only librarians can change the condition of copies"})
+		return
+	}
+
+	barcode, ok := information["barcode"].(string)
+	if !ok || strings.TrimSpace(barcode) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided barcode"})
+		return
+	}
+
+	condition, _ := information["condition"].(string)
+	if !validCondition(condition) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error the condition must be one of " + strings.Join(Conditions, ", ")})
+		return
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error couldn't connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = CreateCirculationTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err = CreateBookChangesTable(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error changing the condition of the copy"})
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	var copy Copy
+	err = tx.QueryRow(context.Background(), "select id, book_id, barcode, room, shelf, status, condition from copies where barcode = $1 for update", strings.TrimSpace(barcode)).Scan(
+		&copy.ID, &copy.BookID, &copy.Barcode, &copy.Room, &copy.Shelf, &copy.Status, &copy.Condition)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Error there is no copy with this barcode"})
+			return
+		}
+
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the copy"})
+		return
+	}
+
+	if copy.Condition != condition {
+		if _, err = tx.Exec(context.Background(), "update copies set condition = $1 where id = $2", condition, copy.ID); err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error changing the condition of the copy"})
+			return
+		}
+
+		if err = RecordBookChange(tx, copy.BookID, userID, "copy "+copy.Barcode+" condition", copy.Condition, condition); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		copy.Condition = condition
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error changing the condition of the copy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"copy": copy})
+}
@@ -0,0 +1,128 @@
+package books
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/Phantomvv1/Library_management/internal/isbn"
+	"github.com/jackc/pgx/v5"
+)
+
+// StoredISBN is the ISBN a book has in the books table.
+type StoredISBN struct {
+	BookID int    `json:"bookID"`
+	ISBN   string `json:"isbn"`
+}
+
+// ISBNMigration reports what MigrateISBNs did. The books in Invalid and in Duplicates were left as they were,
+// Duplicates maps an ISBN to the books that share it and while there are any the unique index isn't created.
+type ISBNMigration struct {
+	Canonicalised int                     `json:"canonicalised"`
+	Invalid       []StoredISBN            `json:"invalid"`
+	Duplicates    map[string][]StoredISBN `json:"duplicates"`
+	Indexed       bool                    `json:"indexed"`
+}
+
+// planISBNs works out which stored ISBNs to rewrite in their canonical form. An invalid ISBN is kept as it is and
+// is compared with the others after stripping its hyphens, books that would end up with the same ISBN are all left alone.
+func planISBNs(stored []StoredISBN) ([]StoredISBN, ISBNMigration) {
+	migration := ISBNMigration{Invalid: []StoredISBN{}, Duplicates: map[string][]StoredISBN{}}
+	groups := make(map[string][]StoredISBN)
+	var keys []string
+	for _, book := range stored {
+		key, err := isbn.Canonical(book.ISBN)
+		if err != nil {
+			migration.Invalid = append(migration.Invalid, book)
+			key = isbn.Normalize(book.ISBN)
+		}
+
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], book)
+	}
+
+	var updates []StoredISBN
+	for _, key := range keys {
+		group := groups[key]
+		if len(group) > 1 {
+			migration.Duplicates[key] = group
+			continue
+		}
+
+		if _, err := isbn.Canonical(group[0].ISBN); err == nil && group[0].ISBN != key {
+			updates = append(updates, StoredISBN{BookID: group[0].BookID, ISBN: key})
+		}
+	}
+
+	return updates, migration
+}
+
+// MigrateISBNs rewrites the ISBNs stored before they were validated in their canonical ISBN-13 form and, when no two books
+// share an ISBN, creates the unique index on them. It is run once with "catalog migrate-isbns", never by a request.
+func MigrateISBNs(conn *pgx.Conn) (ISBNMigration, error) {
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		log.Println(err)
+		return ISBNMigration{}, errors.New("Error migrating the ISBNs of the books")
+	}
+	defer tx.Rollback(context.Background())
+
+	// Books added while the ISBNs are rewritten could slip past the duplicate check.
+	_, err = tx.Exec(context.Background(), "lock table books in share row exclusive mode")
+	if err != nil {
+		log.Println(err)
+		return ISBNMigration{}, errors.New("Error migrating the ISBNs of the books")
+	}
+
+	rows, err := tx.Query(context.Background(), "select id, isbn from books where isbn is not null order by id")
+	if err != nil {
+		log.Println(err)
+		return ISBNMigration{}, errors.New("Error getting the ISBNs of the books")
+	}
+
+	var stored []StoredISBN
+	for rows.Next() {
+		var book StoredISBN
+		if err = rows.Scan(&book.BookID, &book.ISBN); err != nil {
+			rows.Close()
+			log.Println(err)
+			return ISBNMigration{}, errors.New("Error getting the ISBNs of the books")
+		}
+
+		stored = append(stored, book)
+	}
+	rows.Close()
+
+	if rows.Err() != nil {
+		log.Println(rows.Err())
+		return ISBNMigration{}, errors.New("Error getting the ISBNs of the books")
+	}
+
+	updates, migration := planISBNs(stored)
+	for _, update := range updates {
+		_, err = tx.Exec(context.Background(), "update books set isbn = $1 where id = $2", update.ISBN, update.BookID)
+		if err != nil {
+			log.Println(err)
+			return ISBNMigration{}, errors.New("Error changing the ISBN of the book")
+		}
+	}
+	migration.Canonicalised = len(updates)
+
+	if len(migration.Duplicates) == 0 {
+		_, err = tx.Exec(context.Background(), "create unique index if not exists books_isbn_key on books (isbn);")
+		if err != nil {
+			log.Println(err)
+			return ISBNMigration{}, errors.New("Couldn't create a unique index for the ISBN of the books")
+		}
+		migration.Indexed = true
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		log.Println(err)
+		return ISBNMigration{}, errors.New("Error migrating the ISBNs of the books")
+	}
+
+	return migration, nil
+}
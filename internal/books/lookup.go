@@ -0,0 +1,126 @@
+package books
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	. "github.com/Phantomvv1/Library_management/internal/authentication"
+	"github.com/Phantomvv1/Library_management/internal/isbn"
+	"github.com/Phantomvv1/Library_management/internal/metadata"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	metadataProvider     metadata.MetadataProvider
+	metadataProviderOnce sync.Once
+	metadataProviderErr  error
+)
+
+// SetMetadataProvider replaces the provider chosen from the environment.
+func SetMetadataProvider(provider metadata.MetadataProvider) {
+	metadataProviderOnce.Do(func() {})
+	metadataProvider = provider
+	metadataProviderErr = nil
+}
+
+func getMetadataProvider() (metadata.MetadataProvider, error) {
+	metadataProviderOnce.Do(func() {
+		metadataProvider, metadataProviderErr = metadata.FromEnv()
+	})
+
+	return metadataProvider, metadataProviderErr
+}
+
+// LookupMetadata asks the configured metadata provider for the details of the book with the ISBN.
+func LookupMetadata(ctx context.Context, isbnString string) (metadata.Metadata, error) {
+	provider, err := getMetadataProvider()
+	if err != nil {
+		return metadata.Metadata{}, err
+	}
+
+	return provider.Lookup(ctx, isbnString)
+}
+
+// LookupBook pre-fills the details of a book from its ISBN so that a librarian only has to confirm them before calling AddBook.
+func LookupBook(c *gin.Context) {
+	var information map[string]string
+	json.NewDecoder(c.Request.Body).Decode(&information) // token
+
+	// Every lookup is a request to the metadata provider, so only librarians can make them.
+	_, accountType, err := ValidateJWT(information["token"])
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	if accountType != "librarian" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error only librarians can look up the details of books"})
+		return
+	}
+
+	isbnString := c.Query("isbn")
+	canonical, err := isbn.Canonical(isbnString)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	provider, err := getMetadataProvider()
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error the metadata provider is not configured correctly"})
+		return
+	}
+
+	details, err := provider.Lookup(c.Request.Context(), canonical)
+	if err != nil {
+		if err == metadata.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		log.Println(err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Error unable to get the details of the book from the metadata provider"})
+		return
+	}
+
+	book := Book{
+		ISBN:      canonical,
+		Title:     details.Title,
+		Author:    strings.Join(details.Authors, ", "),
+		Year:      int16(details.Year),
+		Publisher: details.Publisher,
+		Pages:     details.Pages,
+		CoverURL:  details.CoverURL,
+		Subjects:  []string{},
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error connecting to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = CreateBookTable(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	existingID, err := findBookIDByISBN(conn, canonical)
+	if err != nil && err != pgx.ErrNoRows {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking if the book is already in the catalog"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"book": book, "authors": details.Authors, "existingID": existingID})
+}
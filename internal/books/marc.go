@@ -0,0 +1,202 @@
+package books
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	. "github.com/Phantomvv1/Library_management/internal/authentication"
+	"github.com/Phantomvv1/Library_management/internal/isbn"
+	"github.com/Phantomvv1/Library_management/internal/marc"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+type ImportResult struct {
+	Record  int    `json:"record"`
+	ISBN    string `json:"isbn"`
+	Title   string `json:"title"`
+	Status  string `json:"status"` // created | conflict | invalid
+	Message string `json:"message,omitempty"`
+	BookID  int    `json:"bookID,omitempty"`
+}
+
+func ImportMARC(c *gin.Context) {
+	_, accountType, err := ValidateJWT(c.PostForm("token"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	if accountType != "librarian" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error only librarians can import books"})
+		return
+	}
+
+	dryRun := c.PostForm("dryRun") == "true"
+	quantity := 1
+	if quantityString := c.PostForm("quantity"); quantityString != "" {
+		quantity, err = strconv.Atoi(quantityString)
+		if err != nil || quantity < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Error the quantity must be a positive number"})
+			return
+		}
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error no MARC file provided"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to open the uploaded file"})
+		return
+	}
+	defer file.Close()
+
+	records, err := marc.Read(file)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error unable to parse the MARC file: " + err.Error()})
+		return
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error connecting to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = CreateBookTable(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	results := []ImportResult{}
+	seen := make(map[string]int)
+	for i, record := range records {
+		data := marc.ToBook(record)
+		result := ImportResult{Record: i + 1, ISBN: data.ISBN, Title: data.Title}
+
+		canonical, err := isbn.Canonical(data.ISBN)
+		switch {
+		case data.Title == "":
+			result.Status, result.Message = "invalid", "The record has no title"
+		case err != nil:
+			result.Status, result.Message = "invalid", err.Error()
+		}
+
+		if result.Status != "" {
+			results = append(results, result)
+			continue
+		}
+		result.ISBN = canonical
+
+		if first, ok := seen[canonical]; ok {
+			result.Status, result.Message = "conflict", "The ISBN already appears in record "+strconv.Itoa(first)
+			results = append(results, result)
+			continue
+		}
+		seen[canonical] = i + 1
+
+		existingID, err := findBookIDByISBN(conn, canonical)
+		if err == nil {
+			result.Status, result.Message, result.BookID = "conflict", "There is already a book with this ISBN", existingID
+			results = append(results, result)
+			continue
+		} else if err != pgx.ErrNoRows {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking for existing books"})
+			return
+		}
+
+		result.Status = "created"
+		if !dryRun {
+			book := Book{ISBN: canonical, Title: data.Title, Author: data.Author, Year: int16(data.Year), Quantity: quantity, Subjects: data.Subjects}
+			result.BookID, err = InsertBook(conn, book)
+			if err != nil {
+				log.Println(err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adding the book from record " + strconv.Itoa(i+1), "results": results})
+				return
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"dryRun": dryRun, "results": results})
+}
+
+func ExportMARC(c *gin.Context) {
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error connecting to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = CreateBookTable(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	age, userID, err := OptionalReader(conn, c.Query("token"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var ids []int
+	for _, idString := range c.QueryArray("id") {
+		id, err := strconv.Atoi(idString)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Error unable to parse the id of the book"})
+			return
+		}
+
+		ids = append(ids, id)
+	}
+
+	bookList, err := getBooks(conn, age, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	wanted := make(map[int]bool)
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	var records []marc.Record
+	for _, book := range bookList {
+		if len(wanted) > 0 && !wanted[book.ID] {
+			continue
+		}
+
+		records = append(records, marc.FromBook(book.ID, marc.BookData{
+			ISBN:     book.ISBN,
+			Title:    book.Title,
+			Author:   book.Author,
+			Year:     int(book.Year),
+			Subjects: book.Subjects,
+		}))
+	}
+
+	c.Header("Content-Disposition", "attachment; filename=books.xml")
+	c.Header("Content-Type", "application/marcxml+xml")
+	c.Status(http.StatusOK)
+	if err = marc.WriteXML(c.Writer, records); err != nil {
+		log.Println(err)
+	}
+}
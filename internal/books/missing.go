@@ -0,0 +1,155 @@
+package books
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Phantomvv1/Library_management/internal/ledger"
+	"github.com/Phantomvv1/Library_management/internal/missing"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrNoLoan = errors.New("Error there is no such loan")
+
+// MissingLoan describes a loan MarkMissing marked lost or claimed returned.
+type MissingLoan struct {
+	LoanID      int       `json:"loanID"`
+	UserID      int       `json:"userID"`
+	BookID      int       `json:"bookID"`
+	Title       string    `json:"title"`
+	CopyID      int       `json:"copyID"`
+	Status      string    `json:"status"`
+	Since       time.Time `json:"since"`
+	Fine        float64   `json:"fine"`
+	Replacement float64   `json:"replacement"`
+}
+
+// lockLoan locks the book of the loan and then the loan, in the same order the loans and the returns lock them.
+func lockLoan(tx Querier, loanID int) (int, *time.Time, string, error) {
+	var bookID int
+	err := tx.QueryRow(context.Background(), "select book_id from borrowed_books where id = $1 and not migrated", loanID).Scan(&bookID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return 0, nil, "", ErrNoLoan
+		}
+
+		log.Println(err)
+		return 0, nil, "", errors.New("Error getting the loan")
+	}
+
+	if _, err = lockBook(tx, bookID); err != nil {
+		return 0, nil, "", err
+	}
+
+	var returnedAt *time.Time
+	status := ""
+	err = tx.QueryRow(context.Background(), "select returned_at, missing from borrowed_books where id = $1 for update", loanID).Scan(&returnedAt, &status)
+	if err != nil {
+		log.Println(err)
+		return 0, nil, "", errors.New("Error getting the loan")
+	}
+
+	return bookID, returnedAt, status, nil
+}
+
+// MarkMissing marks the loan lost or claimed returned, its fine is brought up to date and then stops growing and its copy is taken
+// out of circulation. The borrower of a lost book is charged replacement, with 0 the replacement cost of the policy of the loan.
+func MarkMissing(tx Querier, loanID, librarianID int, status string, replacement float64) (MissingLoan, error) {
+	if status != missing.StatusLost && status != missing.StatusClaimed {
+		return MissingLoan{}, missing.ErrInvalidStatus
+	}
+
+	bookID, returnedAt, from, err := lockLoan(tx, loanID)
+	if err != nil {
+		return MissingLoan{}, err
+	}
+
+	if returnedAt != nil {
+		return MissingLoan{}, missing.ErrNotOutstanding
+	}
+
+	if err = missing.Mark(from, status); err != nil {
+		return MissingLoan{}, err
+	}
+
+	loan := MissingLoan{LoanID: loanID, BookID: bookID, Status: status}
+	if loan.Fine, err = accrueFine(tx, loanID, time.Now()); err != nil {
+		return MissingLoan{}, err
+	}
+
+	// A book claimed returned that is then lost stays missing since the day of the claim.
+	err = tx.QueryRow(context.Background(), "update borrowed_books set missing = $1, missing_since = coalesce(missing_since, current_timestamp) where id = $2 "+
+		"returning user_id, coalesce(copy_id, 0), missing_since", status, loanID).Scan(&loan.UserID, &loan.CopyID, &loan.Since)
+	if err != nil {
+		log.Println(err)
+		return MissingLoan{}, errors.New("Error marking the loan as " + status)
+	}
+
+	book := Book{ID: bookID}
+	err = tx.QueryRow(context.Background(), "select title, item_category from books where id = $1", bookID).Scan(&book.Title, &book.Category)
+	if err != nil {
+		log.Println(err)
+		return MissingLoan{}, errors.New("Error getting the book")
+	}
+	loan.Title = book.Title
+
+	if loan.CopyID != 0 {
+		var copy Copy
+		err = tx.QueryRow(context.Background(), "select barcode, status from copies where id = $1 for update", loan.CopyID).Scan(&copy.Barcode, &copy.Status)
+		if err != nil {
+			log.Println(err)
+			return MissingLoan{}, errors.New("Error getting the copy of the book")
+		}
+
+		copyStatus := missing.CopyStatus(status)
+		if _, err = tx.Exec(context.Background(), "update copies set status = $1 where id = $2", copyStatus, loan.CopyID); err != nil {
+			log.Println(err)
+			return MissingLoan{}, errors.New("Error changing the status of the copy")
+		}
+
+		if err = RecordBookChange(tx, bookID, librarianID, "copy "+copy.Barcode+" status", copy.Status, copyStatus); err != nil {
+			return MissingLoan{}, err
+		}
+	}
+
+	if status != missing.StatusLost {
+		return loan, nil
+	}
+
+	if replacement == 0 {
+		policy, err := LoanPolicy(tx, loan.UserID, book)
+		if err != nil {
+			return MissingLoan{}, err
+		}
+		replacement = policy.ReplacementCost
+	}
+
+	if replacement > 0 {
+		if _, err = ledger.ChargeLoan(tx, loan.UserID, loanID, ledger.KindReplacement, replacement, "Replacement of the lost "+book.Title, librarianID); err != nil {
+			return MissingLoan{}, err
+		}
+		loan.Replacement = replacement
+	}
+
+	return loan, nil
+}
+
+// MarkFound checks in a loan that was lost or claimed returned once the book turns up.
+func MarkFound(tx Querier, loanID, librarianID int, condition, notes string) (ReturnSlip, error) {
+	_, returnedAt, status, err := lockLoan(tx, loanID)
+	if err != nil {
+		return ReturnSlip{}, err
+	}
+
+	if returnedAt != nil {
+		return ReturnSlip{}, missing.ErrNotMissing
+	}
+
+	if err = missing.Mark(status, missing.StatusFound); err != nil {
+		return ReturnSlip{}, err
+	}
+
+	return CheckIn(tx, loanID, librarianID, condition, notes)
+}
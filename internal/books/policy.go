@@ -0,0 +1,65 @@
+package books
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Phantomvv1/Library_management/internal/policies"
+)
+
+// applyItemCategory validates the "itemCategory" in information and applies it to book, it returns the changed field like applyBookChanges.
+func applyItemCategory(book *Book, information map[string]interface{}) ([][3]string, error) {
+	value, ok := information["itemCategory"]
+	if !ok {
+		return nil, nil
+	}
+
+	category, ok := value.(string)
+	category = strings.TrimSpace(category)
+	if !ok || !policies.ValidItemCategory(category) {
+		return nil, policies.ErrInvalidItemCategory
+	}
+
+	if category == book.Category {
+		return nil, nil
+	}
+
+	changes := [][3]string{{"itemCategory", book.Category, category}}
+	book.Category = category
+
+	return changes, nil
+}
+
+// LoanPolicy returns the policy the user borrows the book under.
+func LoanPolicy(db Querier, userID int, book Book) (policies.Policy, error) {
+	accountType, category := "", ""
+	err := db.QueryRow(context.Background(), "select coalesce(type, ''), category from authentication where id = $1", userID).Scan(&accountType, &category)
+	if err != nil {
+		log.Println(err)
+		return policies.Policy{}, errors.New("Error getting the category of the user")
+	}
+
+	return policies.For(db, policies.PatronType(accountType, category), book.Category)
+}
+
+// checkLoanLimit makes sure the user can take one more loan under the policy, loans of other item categories
+// count only towards the policies that apply to every category. It returns the status to answer with when not.
+func checkLoanLimit(db Querier, userID int, policy policies.Policy) (int, error) {
+	loans := 0
+	err := db.QueryRow(context.Background(), "select count(*) from borrowed_books l join books b on l.book_id = b.id where l.user_id = $1 and l.returned_at is null and l.missing = '' "+
+		"and ($2 = '*' or b.item_category = $2)", userID, policy.ItemCategory).Scan(&loans)
+	if err != nil {
+		log.Println(err)
+		return http.StatusInternalServerError, errors.New("Error counting the books you have borrowed")
+	}
+
+	if loans >= policy.MaxLoans {
+		return http.StatusForbidden, errors.New("Error you can't have more than " + strconv.Itoa(policy.MaxLoans) + " books of this kind borrowed at the same time")
+	}
+
+	return http.StatusOK, nil
+}
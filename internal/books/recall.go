@@ -0,0 +1,157 @@
+package books
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Phantomvv1/Library_management/internal/notifications"
+)
+
+var (
+	ErrAlreadyRecalled = errors.New("Error this loan has already been recalled")
+	ErrCantRecall      = errors.New("Error this loan is due before it could be recalled")
+	ErrMissingLoan     = errors.New("Error this book is missing, it can't be recalled")
+)
+
+// RecalledLoan describes a loan Recall recalled.
+type RecalledLoan struct {
+	LoanID     int       `json:"loanID"`
+	UserID     int       `json:"userID"`
+	BookID     int       `json:"bookID"`
+	Title      string    `json:"title"`
+	OldDueDate time.Time `json:"oldDueDate"`
+	DueDate    time.Time `json:"dueDate"`
+	RecalledAt time.Time `json:"recalledAt"`
+}
+
+// Recall brings the due date of the loan forward to the end of the guaranteed days of its policy, giving the borrower
+// a few days to bring the book back, and lets them know. recalledBy is the librarian that recalled it, 0 when the queue did.
+func Recall(tx Querier, loanID, recalledBy int) (RecalledLoan, error) {
+	bookID, returnedAt, status, err := lockLoan(tx, loanID)
+	if err != nil {
+		return RecalledLoan{}, err
+	}
+
+	if returnedAt != nil {
+		return RecalledLoan{}, ErrNotOnLoan
+	}
+
+	if status != "" {
+		return RecalledLoan{}, ErrMissingLoan
+	}
+
+	loan := RecalledLoan{LoanID: loanID, BookID: bookID}
+	var borrowedAt time.Time
+	var recalledAt *time.Time
+	err = tx.QueryRow(context.Background(), "select user_id, coalesce(borrowed_at, current_timestamp), return_date, recalled_at from borrowed_books where id = $1",
+		loanID).Scan(&loan.UserID, &borrowedAt, &loan.OldDueDate, &recalledAt)
+	if err != nil {
+		log.Println(err)
+		return RecalledLoan{}, errors.New("Error getting the loan")
+	}
+
+	if recalledAt != nil {
+		return RecalledLoan{}, ErrAlreadyRecalled
+	}
+
+	book := Book{ID: bookID}
+	err = tx.QueryRow(context.Background(), "select title, item_category from books where id = $1", bookID).Scan(&book.Title, &book.Category)
+	if err != nil {
+		log.Println(err)
+		return RecalledLoan{}, errors.New("Error getting the book")
+	}
+	loan.Title = book.Title
+
+	policy, err := LoanPolicy(tx, loan.UserID, book)
+	if err != nil {
+		return RecalledLoan{}, err
+	}
+
+	dueDate, ok := policy.RecalledDueDate(borrowedAt, loan.OldDueDate, time.Now())
+	if !ok {
+		return RecalledLoan{}, ErrCantRecall
+	}
+
+	err = tx.QueryRow(context.Background(), "update borrowed_books set return_date = $1, recalled_at = current_timestamp, recalled_by = nullif($2, 0) where id = $3 "+
+		"returning return_date, recalled_at", dueDate, recalledBy, loanID).Scan(&loan.DueDate, &loan.RecalledAt)
+	if err != nil {
+		log.Println(err)
+		return RecalledLoan{}, errors.New("Error recalling the loan")
+	}
+
+	_, err = notifications.Notify(tx, loan.UserID, "Recall of "+book.Title, "Other patrons are waiting for "+book.Title+
+		", please return it by "+loan.DueDate.Format(time.DateOnly)+" instead of "+loan.OldDueDate.Format(time.DateOnly)+".")
+	if err != nil {
+		return RecalledLoan{}, err
+	}
+
+	return loan, nil
+}
+
+// recallForQueue recalls one loan of the book, the one due last, once the patrons waiting for it reach the recall queue of its policy.
+// It is called in the transaction that put a patron in the queue, with the book already locked.
+func recallForQueue(tx Querier, bookID int) (*RecalledLoan, error) {
+	waiting := 0
+	err := tx.QueryRow(context.Background(), "select count(*) from book_reservations where book_id = $1 and status = 'waiting'", bookID).Scan(&waiting)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("Error counting the reservations of the book")
+	}
+
+	book := Book{ID: bookID}
+	err = tx.QueryRow(context.Background(), "select item_category from books where id = $1", bookID).Scan(&book.Category)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("Error getting the book")
+	}
+
+	rows, err := tx.Query(context.Background(), "select id, user_id from borrowed_books where book_id = $1 and returned_at is null and missing = '' and recalled_at is null "+
+		"and not migrated order by return_date desc, id", bookID)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("Error getting the loans of the book")
+	}
+
+	var loanIDs, userIDs []int
+	for rows.Next() {
+		var loanID, userID int
+		if err = rows.Scan(&loanID, &userID); err != nil {
+			rows.Close()
+			log.Println(err)
+			return nil, errors.New("Error getting the loans of the book")
+		}
+
+		loanIDs = append(loanIDs, loanID)
+		userIDs = append(userIDs, userID)
+	}
+	rows.Close()
+
+	if rows.Err() != nil {
+		log.Println(rows.Err())
+		return nil, errors.New("Error getting the loans of the book")
+	}
+
+	for i, loanID := range loanIDs {
+		policy, err := LoanPolicy(tx, userIDs[i], book)
+		if err != nil {
+			return nil, err
+		}
+
+		if policy.RecallQueue == 0 || waiting < policy.RecallQueue {
+			continue
+		}
+
+		loan, err := Recall(tx, loanID, 0)
+		if err == ErrCantRecall {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		return &loan, nil
+	}
+
+	return nil, nil
+}
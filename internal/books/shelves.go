@@ -0,0 +1,421 @@
+package books
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	. "github.com/Phantomvv1/Library_management/internal/authentication"
+	"github.com/Phantomvv1/Library_management/internal/callnumber"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+type ClassSummary struct {
+	callnumber.Class
+	Books int `json:"books"`
+}
+
+func callNumberKey(book Book) string {
+	if book.CallNumber == "" {
+		return ""
+	}
+
+	return callnumber.SortKey(book.Scheme, book.CallNumber)
+}
+
+func deweyClass(book Book) string {
+	if book.Scheme != callnumber.Dewey {
+		return ""
+	}
+
+	return callnumber.ClassOf(book.CallNumber)
+}
+
+// applyCallNumber validates the "callNumber" and "callNumberScheme" in information and applies them to book, a call number
+// without a scheme is a Dewey number and an empty call number removes it. It returns the changed fields like applyBookChanges.
+func applyCallNumber(book *Book, information map[string]interface{}) ([][3]string, error) {
+	numberValue, hasNumber := information["callNumber"]
+	schemeValue, hasScheme := information["callNumberScheme"]
+	if !hasNumber && !hasScheme {
+		return nil, nil
+	}
+
+	number, scheme := book.CallNumber, book.Scheme
+	var ok bool
+	if hasNumber {
+		if number, ok = numberValue.(string); !ok {
+			return nil, errors.New("Error the call number is not a string")
+		}
+	}
+
+	if hasScheme {
+		if scheme, ok = schemeValue.(string); !ok {
+			return nil, errors.New("Error the classification scheme is not a string")
+		}
+	}
+
+	if strings.TrimSpace(number) == "" {
+		number, scheme = "", ""
+	} else {
+		if scheme == "" {
+			scheme = callnumber.Dewey
+		}
+
+		var err error
+		if number, err = callnumber.Normalize(scheme, number); err != nil {
+			return nil, err
+		}
+	}
+
+	var changes [][3]string
+	if number != book.CallNumber {
+		changes = append(changes, [3]string{"callNumber", book.CallNumber, number})
+	}
+
+	if scheme != book.Scheme {
+		changes = append(changes, [3]string{"callNumberScheme", book.Scheme, scheme})
+	}
+	book.CallNumber, book.Scheme = number, scheme
+
+	return changes, nil
+}
+
+// getCopies returns the copies of a book with where they stand in the building.
+func getCopies(db Querier, bookID int) ([]Copy, error) {
+	rows, err := db.Query(context.Background(), "select id, book_id, barcode, room, shelf, status, condition from copies where book_id = $1 order by room, shelf, barcode", bookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	copies := []Copy{}
+	for rows.Next() {
+		var copy Copy
+		if err = rows.Scan(&copy.ID, &copy.BookID, &copy.Barcode, &copy.Room, &copy.Shelf, &copy.Status, &copy.Condition); err != nil {
+			return nil, err
+		}
+
+		copies = append(copies, copy)
+	}
+
+	return copies, rows.Err()
+}
+
+// SetCopyLocation moves a copy to another room or shelf, the move is kept in the history of the book.
+func SetCopyLocation(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && barcode && (room | shelf)
+
+	token, _ := information["token"].(string)
+	userID, accountType, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return
+	}
+
+	if accountType != "librarian" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error only librarians can move copies"})
+		return
+	}
+
+	barcode, ok := information["barcode"].(string)
+	if !ok || strings.TrimSpace(barcode) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided barcode"})
+		return
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error couldn't connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = CreateCirculationTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err = CreateBookChangesTable(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error moving the copy"})
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	var copy Copy
+	err = tx.QueryRow(context.Background(), "select id, book_id, barcode, room, shelf, status, condition from copies where barcode = $1 for update", strings.TrimSpace(barcode)).Scan(
+		&copy.ID, &copy.BookID, &copy.Barcode, &copy.Room, &copy.Shelf, &copy.Status, &copy.Condition)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Error there is no copy with this barcode"})
+			return
+		}
+
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the copy"})
+		return
+	}
+
+	for _, field := range []struct {
+		name  string
+		value *string
+	}{{"room", &copy.Room}, {"shelf", &copy.Shelf}} {
+		value, ok := information[field.name]
+		if !ok {
+			continue
+		}
+
+		location, ok := value.(string)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Error the " + field.name + " is not a string"})
+			return
+		}
+
+		location = strings.TrimSpace(location)
+		if location == *field.value {
+			continue
+		}
+
+		if err = RecordBookChange(tx, copy.BookID, userID, "copy "+copy.Barcode+" "+field.name, *field.value, location); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		*field.value = location
+	}
+
+	if _, err = tx.Exec(context.Background(), "update copies set room = $1, shelf = $2 where id = $3", copy.Room, copy.Shelf, copy.ID); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error moving the copy"})
+		return
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error moving the copy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"copy": copy})
+}
+
+// GetClassifications lists the main Dewey classes with the number of books in each of them.
+func GetClassifications(c *gin.Context) {
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = CreateBookTable(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := conn.Query(context.Background(), "select left(dewey_class, 1), count(*) from books where dewey_class <> '' group by 1")
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error counting the books in every class"})
+		return
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var class string
+		var count int
+		if err = rows.Scan(&class, &count); err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error counting the books in every class"})
+			return
+		}
+		counts[class] = count
+	}
+
+	if rows.Err() != nil {
+		log.Println(rows.Err())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error counting the books in every class"})
+		return
+	}
+
+	classes := []ClassSummary{}
+	for _, class := range callnumber.Classes {
+		classes = append(classes, ClassSummary{Class: class, Books: counts[class.Number]})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"classes": classes})
+}
+
+// BrowseClassification lists the books of a Dewey class (?class=8, 82, 823 or 823.9) in shelf order, ?token= hides the books
+// rated above the age of the reader.
+func BrowseClassification(c *gin.Context) {
+	class := strings.ReplaceAll(c.Query("class"), ".", "")
+	if class == "" || strings.Trim(class, "0123456789") != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error the class has to be a Dewey class number, e.g. 8, 82 or 823"})
+		return
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = CreateBookTable(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	age, userID, err := OptionalReader(conn, c.Query("token"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := conn.Query(context.Background(), "select "+bookColumns+" from books where "+ageFilter+" and dewey_class like $3 || '%' order by call_number_key collate \"C\", id",
+		age, userID, class)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the books of the class"})
+		return
+	}
+	defer rows.Close()
+
+	books := []Book{}
+	for rows.Next() {
+		var book Book
+		if err = rows.Scan(book.fields()...); err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error working with the books of the class"})
+			return
+		}
+
+		books = append(books, book)
+	}
+
+	if rows.Err() != nil {
+		log.Println(rows.Err())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error working with the books of the class"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"class": callnumber.Class{Number: class, Name: callnumber.ClassName(class)}, "books": books})
+}
+
+// GetNearbyBooks lists the books standing next to a book on the shelf (?id= or ?isbn= and ?limit= on each side, 5 by default),
+// ?token= hides the books rated above the age of the reader like in BrowseClassification.
+func GetNearbyBooks(c *gin.Context) {
+	limit := 5
+	if value := c.Query("limit"); value != "" {
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 1 || number > 50 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Error the limit has to be a number between 1 and 50"})
+			return
+		}
+		limit = number
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = CreateBookTable(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	age, userID, err := OptionalReader(conn, c.Query("token"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, err := bookIDFromQuery(conn, c)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Error there is no such book in this library"})
+			return
+		}
+
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var book Book
+	key := ""
+	err = conn.QueryRow(context.Background(), "select "+bookColumns+", call_number_key from books where "+ageFilter+" and books.id = $3", age, userID, id).Scan(
+		append(book.fields(), &key)...)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Error there is no such book in this library"})
+			return
+		}
+
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to get information from the database"})
+		return
+	}
+
+	if book.CallNumber == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Error this book has no call number yet"})
+		return
+	}
+
+	rows, err := conn.Query(context.Background(), "(select "+bookColumns+" from books where "+ageFilter+" and call_number_scheme = $3 and call_number <> '' "+
+		"and (call_number_key collate \"C\", id) < ($4, $5) order by call_number_key collate \"C\" desc, id desc limit $6) union all (select "+bookColumns+
+		" from books where "+ageFilter+" and call_number_scheme = $3 and call_number <> '' and (call_number_key collate \"C\", id) > ($4, $5) "+
+		"order by call_number_key collate \"C\", id limit $6)",
+		age, userID, book.Scheme, key, book.ID, limit)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the books on the shelf"})
+		return
+	}
+	defer rows.Close()
+
+	before, after := []Book{}, []Book{}
+	for rows.Next() {
+		var nearby Book
+		if err = rows.Scan(nearby.fields()...); err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error working with the books on the shelf"})
+			return
+		}
+
+		if callnumber.Compare(book.Scheme, nearby.CallNumber, book.CallNumber) < 0 || (nearby.CallNumber == book.CallNumber && nearby.ID < book.ID) {
+			before = append([]Book{nearby}, before...)
+		} else {
+			after = append(after, nearby)
+		}
+	}
+
+	if rows.Err() != nil {
+		log.Println(rows.Err())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error working with the books on the shelf"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"book": book, "before": before, "after": after})
+}
@@ -0,0 +1,368 @@
+package books
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/Phantomvv1/Library_management/internal/authentication"
+	"github.com/Phantomvv1/Library_management/internal/isbn"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Querier is implemented by both *pgx.Conn and pgx.Tx so helpers can run inside or outside of a transaction.
+type Querier interface {
+	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+type BookChange struct {
+	ID        int       `json:"id"`
+	BookID    int       `json:"bookID"`
+	UserID    int       `json:"userID"`
+	Field     string    `json:"field"`
+	OldValue  string    `json:"oldValue"`
+	NewValue  string    `json:"newValue"`
+	ChangedAt time.Time `json:"changedAt"`
+}
+
+func CreateBookChangesTable(conn *pgx.Conn) error {
+	_, err := conn.Exec(context.Background(), "create table if not exists book_changes (id serial primary key, book_id int references books(id) on delete cascade, "+
+		"user_id int, field text, old_value text, new_value text, changed_at timestamp not null default current_timestamp);")
+	if err != nil {
+		log.Println(err)
+		return errors.New("Couldn't create a table for the history of changes to the books")
+	}
+
+	return nil
+}
+
+// RecordBookChange adds an entry to the change history (audit trail) of a book.
+func RecordBookChange(db Querier, bookID, userID int, field, oldValue, newValue string) error {
+	_, err := db.Exec(context.Background(), "insert into book_changes (book_id, user_id, field, old_value, new_value) values ($1, $2, $3, $4, $5)",
+		bookID, userID, field, oldValue, newValue)
+	if err != nil {
+		log.Println(err)
+		return errors.New("Error recording the change to the book")
+	}
+
+	return nil
+}
+
+// applyBookChanges validates the fields present in information and applies them to book,
+// returning the changed fields with their old and new values.
+func applyBookChanges(book *Book, information map[string]interface{}) ([][3]string, error) {
+	var changes [][3]string
+	changed := func(field, oldValue, newValue string) {
+		if oldValue != newValue {
+			changes = append(changes, [3]string{field, oldValue, newValue})
+		}
+	}
+
+	if value, ok := information["title"]; ok {
+		title, ok := value.(string)
+		if !ok || strings.TrimSpace(title) == "" {
+			return nil, errors.New("Error the title must be a non-empty string")
+		}
+		changed("title", book.Title, title)
+		book.Title = title
+	}
+
+	if value, ok := information["author"]; ok {
+		author, ok := value.(string)
+		if !ok || strings.TrimSpace(author) == "" {
+			return nil, errors.New("Error the author must be a non-empty string")
+		}
+		changed("author", book.Author, author)
+		book.Author = author
+	}
+
+	if value, ok := information["isbn"]; ok {
+		isbnString, ok := value.(string)
+		if !ok {
+			return nil, errors.New("Error ISBN is not a string")
+		}
+
+		canonical, err := isbn.Canonical(isbnString)
+		if err != nil {
+			return nil, err
+		}
+		changed("isbn", book.ISBN, canonical)
+		book.ISBN = canonical
+	}
+
+	if value, ok := information["year"]; ok {
+		year, ok := value.(float64)
+		if !ok || year < 1 || year != float64(int16(year)) || int(year) > time.Now().Year()+1 {
+			return nil, errors.New("Error the year must be a positive whole number not in the future")
+		}
+		changed("year", strconv.Itoa(int(book.Year)), strconv.Itoa(int(year)))
+		book.Year = int16(year)
+	}
+
+	if value, ok := information["publisher"]; ok {
+		publisher, ok := value.(string)
+		if !ok {
+			return nil, errors.New("Error the publisher is not a string")
+		}
+		changed("publisher", book.Publisher, publisher)
+		book.Publisher = publisher
+	}
+
+	if value, ok := information["pages"]; ok {
+		pages, ok := value.(float64)
+		if !ok || pages < 0 || pages != float64(int(pages)) {
+			return nil, errors.New("Error the number of pages must be a positive whole number")
+		}
+		changed("pages", strconv.Itoa(book.Pages), strconv.Itoa(int(pages)))
+		book.Pages = int(pages)
+	}
+
+	if value, ok := information["coverURL"]; ok {
+		coverURL, ok := value.(string)
+		if !ok {
+			return nil, errors.New("Error the URL of the cover is not a string")
+		}
+		changed("coverURL", book.CoverURL, coverURL)
+		book.CoverURL = coverURL
+	}
+
+	if value, ok := information["subjects"]; ok {
+		list, ok := value.([]interface{})
+		if !ok {
+			return nil, errors.New("Error the subjects must be a list")
+		}
+
+		subjects := []string{}
+		for _, subject := range list {
+			subject, ok := subject.(string)
+			if !ok {
+				return nil, errors.New("Error every subject must be a string")
+			}
+			subjects = append(subjects, subject)
+		}
+		changed("subjects", strings.Join(book.Subjects, "; "), strings.Join(subjects, "; "))
+		book.Subjects = subjects
+	}
+
+	callNumberChanges, err := applyCallNumber(book, information)
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, callNumberChanges...)
+
+	ageRatingChanges, err := applyAgeRating(book, information)
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, ageRatingChanges...)
+
+	categoryChanges, err := applyItemCategory(book, information)
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, categoryChanges...)
+
+	return changes, nil
+}
+
+// UpdateBook edits the metadata of a book. The client has to send the version of the book it edited,
+// if somebody else changed the book in the meantime the update is refused with 409 and the current book.
+func UpdateBook(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && version && (title | author | isbn | year | publisher | pages | coverURL | subjects | callNumber | callNumberScheme | ageRating | itemCategory)
+
+	token, ok := information["token"].(string)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided token"})
+		return
+	}
+
+	userID, accountType, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return
+	}
+
+	if accountType != "librarian" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error only librarians can update books"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error unable to parse the id of the book"})
+		return
+	}
+
+	version, ok := information["version"].(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error the version of the book you are editing is missing"})
+		return
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error couldn't connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = CreateBookTable(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err = CreateBookChangesTable(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error starting the update"})
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	var book Book
+	err = tx.QueryRow(context.Background(), "select "+bookColumns+" from books where id = $1 for update", id).Scan(book.fields()...)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Error there is no such book in this library"})
+			return
+		}
+
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to get information from the database"})
+		return
+	}
+
+	if book.Version != int(version) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Error the book was changed by somebody else, review the current version and try again", "book": book})
+		return
+	}
+
+	changes, err := applyBookChanges(&book, information)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(changes) == 0 {
+		c.JSON(http.StatusOK, gin.H{"book": book})
+		return
+	}
+
+	err = tx.QueryRow(context.Background(), "update books set title = $1, author = $2, isbn = $3, year = $4, publisher = $5, pages = $6, cover_url = $7, "+
+		"subjects = $8, call_number = $9, call_number_scheme = $10, call_number_key = $11, dewey_class = $12, age_rating = $13, item_category = $14, "+
+		"version = version + 1 where id = $15 returning version", book.Title, book.Author, book.ISBN, book.Year, book.Publisher, book.Pages, book.CoverURL, book.Subjects, book.CallNumber,
+		book.Scheme, callNumberKey(book), deweyClass(book), book.AgeRating, book.Category, book.ID).Scan(&book.Version)
+	if err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Error there is already a book with this ISBN"})
+			return
+		}
+
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error couldn't update the book"})
+		return
+	}
+
+	for _, change := range changes {
+		if err = RecordBookChange(tx, book.ID, userID, change[0], change[1], change[2]); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error couldn't save the changes to the book"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"book": book})
+}
+
+func GetBookChanges(c *gin.Context) {
+	var information map[string]string
+	json.NewDecoder(c.Request.Body).Decode(&information) // token
+
+	_, accountType, err := ValidateJWT(information["token"])
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return
+	}
+
+	if accountType != "librarian" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error only librarians can view the history of a book"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error unable to parse the id of the book"})
+		return
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error couldn't connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = CreateBookTable(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err = CreateBookChangesTable(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := conn.Query(context.Background(), "select id, book_id, coalesce(user_id, 0), field, old_value, new_value, changed_at from book_changes "+
+		"where book_id = $1 order by changed_at desc, id desc", id)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the history of the book"})
+		return
+	}
+
+	changes := []BookChange{}
+	for rows.Next() {
+		var change BookChange
+		err = rows.Scan(&change.ID, &change.BookID, &change.UserID, &change.Field, &change.OldValue, &change.NewValue, &change.ChangedAt)
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error working with the history of the book"})
+			return
+		}
+
+		changes = append(changes, change)
+	}
+
+	if rows.Err() != nil {
+		log.Println(rows.Err())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error working with the history of the book"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"changes": changes})
+}
@@ -0,0 +1,134 @@
+package callnumber
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const (
+	Dewey  = "dewey"
+	Custom = "custom"
+)
+
+var (
+	ErrUnknownScheme = errors.New("Error the classification scheme has to be dewey or custom")
+	ErrInvalidDewey  = errors.New("Error a Dewey call number starts with a three digit class, e.g. 823.912 ORW")
+	ErrEmpty         = errors.New("Error the call number is empty")
+)
+
+var deweyPattern = regexp.MustCompile(`^(\d{3})(?:\.(\d+))?(?:\s+(.+))?$`)
+
+// Classes are the ten main classes of the Dewey Decimal Classification.
+var Classes = []Class{
+	{"0", "Computer science, information and general works"},
+	{"1", "Philosophy and psychology"},
+	{"2", "Religion"},
+	{"3", "Social sciences"},
+	{"4", "Language"},
+	{"5", "Science"},
+	{"6", "Technology"},
+	{"7", "Arts and recreation"},
+	{"8", "Literature"},
+	{"9", "History and geography"},
+}
+
+type Class struct {
+	Number string `json:"number"`
+	Name   string `json:"name"`
+}
+
+// ClassName returns the name of the main Dewey class a call number or class prefix belongs to.
+func ClassName(number string) string {
+	if number == "" || number[0] < '0' || number[0] > '9' {
+		return ""
+	}
+
+	return Classes[number[0]-'0'].Name
+}
+
+// Normalize cleans up the spacing and the case of a call number and checks it against its scheme.
+func Normalize(scheme, callNumber string) (string, error) {
+	callNumber = strings.ToUpper(strings.Join(strings.Fields(callNumber), " "))
+	if callNumber == "" {
+		return "", ErrEmpty
+	}
+
+	switch scheme {
+	case Dewey:
+		if !deweyPattern.MatchString(callNumber) {
+			return "", ErrInvalidDewey
+		}
+	case Custom:
+	default:
+		return "", ErrUnknownScheme
+	}
+
+	return callNumber, nil
+}
+
+// ClassOf returns the Dewey class number of a call number without the decimal point, "823.912 ORW" has the class "823912",
+// so that every class prefix ("8", "82", "823", "8239") matches the call numbers below it.
+func ClassOf(callNumber string) string {
+	match := deweyPattern.FindStringSubmatch(callNumber)
+	if match == nil {
+		return ""
+	}
+
+	return match[1] + match[2]
+}
+
+// SortKey returns a key that sorts call numbers of a scheme in shelf order when compared as strings.
+// Dewey numbers sort by their class as a decimal number and then by the rest (the cutter), custom call numbers
+// sort naturally, every run of digits is compared by its value.
+func SortKey(scheme, callNumber string) string {
+	callNumber = strings.ToUpper(strings.Join(strings.Fields(callNumber), " "))
+	if scheme == Dewey {
+		if match := deweyPattern.FindStringSubmatch(callNumber); match != nil {
+			key := match[1]
+			if match[2] != "" {
+				key += "." + match[2]
+			}
+
+			if match[3] != "" {
+				key += " " + naturalKey(match[3])
+			}
+
+			return key
+		}
+	}
+
+	return naturalKey(callNumber)
+}
+
+func naturalKey(s string) string {
+	var b strings.Builder
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		if !unicode.IsDigit(runes[i]) {
+			b.WriteRune(runes[i])
+			i++
+			continue
+		}
+
+		j := i
+		for j < len(runes) && unicode.IsDigit(runes[j]) {
+			j++
+		}
+
+		digits := strings.TrimLeft(string(runes[i:j]), "0")
+		if len(digits) < 10 {
+			b.WriteString(strings.Repeat("0", 10-len(digits)))
+		}
+		b.WriteString(digits)
+		i = j
+	}
+
+	return b.String()
+}
+
+// Compare orders two call numbers of the same scheme the way they stand on the shelf.
+func Compare(scheme, a, b string) int {
+	return strings.Compare(SortKey(scheme, a), SortKey(scheme, b))
+}
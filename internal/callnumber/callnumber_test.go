@@ -0,0 +1,69 @@
+package callnumber
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		scheme string
+		input  string
+		want   string
+		err    error
+	}{
+		{Dewey, " 823.912  orw ", "823.912 ORW", nil},
+		{Dewey, "005", "005", nil},
+		{Dewey, "82.3 ORW", "", ErrInvalidDewey},
+		{Dewey, "", "", ErrEmpty},
+		{Custom, "fic  smi", "FIC SMI", nil},
+		{"lcc", "QA76", "", ErrUnknownScheme},
+	}
+
+	for _, test := range tests {
+		got, err := Normalize(test.scheme, test.input)
+		if got != test.want || err != test.err {
+			t.Fatalf("Normalize(%q, %q) = %q, %v, want %q, %v", test.scheme, test.input, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestClass(t *testing.T) {
+	if class := ClassOf("823.912 ORW"); class != "823912" {
+		t.Fatalf("expected the class 823912, got %q", class)
+	}
+
+	if class := ClassOf("FIC SMI"); class != "" {
+		t.Fatalf("expected no class for a custom call number, got %q", class)
+	}
+
+	if name := ClassName("823"); name != "Literature" {
+		t.Fatalf("expected Literature, got %q", name)
+	}
+}
+
+func TestSortDewey(t *testing.T) {
+	shelf := []string{"823.912 ORW", "005.133 K47", "823 AUS", "823.8 DIC", "100 PLA", "823.912 HUX", "823.91 WOO", "005.1 K47"}
+	want := []string{"005.1 K47", "005.133 K47", "100 PLA", "823 AUS", "823.8 DIC", "823.91 WOO", "823.912 HUX", "823.912 ORW"}
+
+	sort.Slice(shelf, func(i, j int) bool { return Compare(Dewey, shelf[i], shelf[j]) < 0 })
+
+	for i := range want {
+		if shelf[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, shelf)
+		}
+	}
+}
+
+func TestSortCustom(t *testing.T) {
+	shelf := []string{"FIC 10", "FIC 2", "BIO 1", "FIC 1A"}
+	want := []string{"BIO 1", "FIC 1A", "FIC 2", "FIC 10"}
+
+	sort.Slice(shelf, func(i, j int) bool { return Compare(Custom, shelf[i], shelf[j]) < 0 })
+
+	for i := range want {
+		if shelf[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, shelf)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package desk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	. "github.com/Phantomvv1/Library_management/internal/authentication"
+	"github.com/Phantomvv1/Library_management/internal/books"
+	"github.com/Phantomvv1/Library_management/internal/ledger"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrNoPatron = errors.New("Error there is no patron with this library card")
+
+// patron is the holder of a library card.
+type patron struct {
+	ID          int
+	Name        string
+	AccountType string
+	CardNumber  string
+}
+
+func findPatron(db books.Querier, cardNumber string) (patron, error) {
+	p := patron{CardNumber: cardNumber}
+	err := db.QueryRow(context.Background(), "select id, name, type from authentication where card_number = $1", cardNumber).Scan(&p.ID, &p.Name, &p.AccountType)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return patron{}, ErrNoPatron
+		}
+
+		log.Println(err)
+		return patron{}, errors.New("Error getting the patron")
+	}
+
+	return p, nil
+}
+
+func findPatronByID(db books.Querier, userID int) (patron, error) {
+	p := patron{ID: userID}
+	err := db.QueryRow(context.Background(), "select name, type, coalesce(card_number, '') from authentication where id = $1", userID).Scan(&p.Name, &p.AccountType, &p.CardNumber)
+	if err != nil {
+		log.Println(err)
+		return patron{}, errors.New("Error getting the patron")
+	}
+
+	return p, nil
+}
+
+// findCopy returns the book of the copy with the barcode and the id of the copy.
+func findCopy(conn *pgx.Conn, barcode string) (books.Book, int, int, error) {
+	book, copyID, err := books.ResolveBook(conn, map[string]interface{}{"barcode": barcode})
+	if err != nil {
+		var notFound *books.BookNotFoundError
+		if errors.As(err, &notFound) {
+			return books.Book{}, 0, http.StatusNotFound, errors.New("Error there is no copy with this barcode")
+		}
+
+		return books.Book{}, 0, http.StatusBadRequest, err
+	}
+
+	return book, copyID, http.StatusOK, nil
+}
+
+// findLoan returns the open loan of the copy, loans made without scanning a copy are found by the book when the card of the patron is given.
+func findLoan(db books.Querier, book books.Book, copyID, patronID int) (int, error) {
+	var loanID int
+	err := db.QueryRow(context.Background(), "select id from borrowed_books where copy_id = $1 and returned_at is null", copyID).Scan(&loanID)
+	if err == pgx.ErrNoRows && patronID != 0 {
+		err = db.QueryRow(context.Background(), "select id from borrowed_books where book_id = $1 and user_id = $2 and copy_id is null and returned_at is null "+
+			"order by return_date asc, id asc limit 1", book.ID, patronID).Scan(&loanID)
+	}
+
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return 0, books.ErrNotOnLoan
+		}
+
+		log.Println(err)
+		return 0, errors.New("Error getting the loan")
+	}
+
+	return loanID, nil
+}
+
+// DeskCheckout lends the copy with the barcode to the holder of the library card. With an override reason the librarian can lend
+// past the blocks, the loan limit and the longest loan of the policy, the reason is kept with the loan and printed on the receipt.
+func DeskCheckout(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && cardNumber && barcode && returnDate (optional) && override (optional)
+
+	token, _ := information["token"].(string)
+	librarianID, accountType, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return
+	}
+
+	if accountType != "librarian" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error only librarians can lend books at the desk"})
+		return
+	}
+
+	cardNumber, _ := information["cardNumber"].(string)
+	barcode, _ := information["barcode"].(string)
+	cardNumber, barcode = strings.TrimSpace(cardNumber), strings.TrimSpace(barcode)
+	if cardNumber == "" || barcode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error the library card number and the barcode of the copy have to be given"})
+		return
+	}
+
+	var returnDate time.Time
+	if returnDateString, _ := information["returnDate"].(string); returnDateString != "" {
+		if returnDate, err = time.Parse(time.DateOnly, returnDateString); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Error parsing the return date."})
+			return
+		}
+	}
+
+	override, _ := information["override"].(string)
+	override = strings.TrimSpace(override)
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = books.CreateCirculationTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	p, err := findPatron(conn, cardNumber)
+	if err != nil {
+		if err == ErrNoPatron {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	book, copyID, status, err := findCopy(conn, barcode)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error lending the book"})
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	slip, status, err := books.Lend(tx, books.LoanRequest{PatronID: p.ID, AccountType: p.AccountType, Book: book, CopyID: copyID, ReturnDate: returnDate,
+		LentBy: librarianID, Override: override})
+	if err != nil {
+		if blocked, ok := err.(*books.BlockedError); ok {
+			c.JSON(status, gin.H{"error": "Error the patron can't borrow books, " + blocked.Reason, "reason": blocked.Reason})
+			return
+		}
+
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	balance, err := ledger.Balance(tx, p.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error lending the book"})
+		return
+	}
+
+	receipt := Receipt{Kind: KindCheckout, LoanID: slip.LoanID, CardNumber: p.CardNumber, Patron: p.Name, Title: slip.Title, Barcode: slip.Barcode,
+		DueDate: slip.DueDate, Balance: balance, Override: slip.Override, IssuedAt: time.Now()}
+	c.JSON(http.StatusOK, gin.H{"receipt": receipt, "printable": receipt.Text()})
+}
+
+// DeskCheckin takes back the copy with the barcode for whoever borrowed it, the librarian can record the condition it came back in.
+// The library card is only needed for loans that were made without scanning a copy.
+func DeskCheckin(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && barcode && cardNumber (optional) && condition (optional) && notes (optional)
+
+	token, _ := information["token"].(string)
+	librarianID, accountType, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return
+	}
+
+	if accountType != "librarian" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error only librarians can take books back at the desk"})
+		return
+	}
+
+	barcode, _ := information["barcode"].(string)
+	barcode = strings.TrimSpace(barcode)
+	if barcode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error the barcode of the copy has to be given"})
+		return
+	}
+
+	condition, _ := information["condition"].(string)
+	notes, _ := information["notes"].(string)
+	if condition != "" && !slices.Contains(books.Conditions, condition) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error the condition must be one of " + strings.Join(books.Conditions, ", ")})
+		return
+	}
+
+	cardNumber, _ := information["cardNumber"].(string)
+	cardNumber = strings.TrimSpace(cardNumber)
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = books.CreateCirculationTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if condition != "" {
+		if err = books.CreateDamageReportsTable(conn); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var p patron
+	if cardNumber != "" {
+		if p, err = findPatron(conn, cardNumber); err != nil {
+			if err == ErrNoPatron {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	book, copyID, status, err := findCopy(conn, barcode)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error taking the book back"})
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	loanID, err := findLoan(tx, book, copyID, p.ID)
+	if err != nil {
+		if err == books.ErrNotOnLoan {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	slip, err := books.CheckIn(tx, loanID, librarianID, condition, strings.TrimSpace(notes))
+	if err != nil {
+		if err == books.ErrNotOnLoan {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if p.ID != 0 && p.ID != slip.UserID {
+		c.JSON(http.StatusConflict, gin.H{"error": "Error this copy is on loan to another patron"})
+		return
+	}
+
+	if p, err = findPatronByID(tx, slip.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	balance, err := ledger.Balance(tx, slip.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error taking the book back"})
+		return
+	}
+
+	receipt := Receipt{Kind: KindCheckin, LoanID: slip.LoanID, CardNumber: p.CardNumber, Patron: p.Name, Title: slip.Title, Barcode: slip.Barcode,
+		DueDate: slip.DueDate, ReturnedAt: &slip.ReturnedAt, Fine: slip.Fine, Balance: balance, Damaged: slip.DamageReport != 0, IssuedAt: time.Now()}
+	c.JSON(http.StatusOK, gin.H{"receipt": receipt, "printable": receipt.Text(), "damageReport": slip.DamageReport})
+}
@@ -0,0 +1,236 @@
+package desk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Phantomvv1/Library_management/internal/authentication"
+	"github.com/Phantomvv1/Library_management/internal/books"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+func TestReceiptText(t *testing.T) {
+	issued := time.Date(2025, time.May, 10, 12, 30, 0, 0, time.UTC)
+	due := time.Date(2025, time.May, 24, 0, 0, 0, 0, time.UTC)
+
+	checkout := Receipt{Kind: KindCheckout, LoanID: 7, CardNumber: "P00000001", Patron: "Kris", Title: "Dune", Barcode: "C-1",
+		DueDate: due, Balance: 1.5, Override: "visiting scholar", IssuedAt: issued}
+	text := checkout.Text()
+	for _, line := range []string{"checkout", "Issued: 2025-05-10 12:30", "Card: P00000001 (Kris)", "Copy: C-1", "Due: 2025-05-24",
+		"Policy override: visiting scholar", "Balance: 1.50"} {
+		if !strings.Contains(text, line) {
+			t.Fatalf("expected %q in the receipt:\n%s", line, text)
+		}
+	}
+
+	if strings.Contains(text, "Returned") || strings.Contains(text, "fine") {
+		t.Fatalf("unexpected return on a checkout receipt:\n%s", text)
+	}
+
+	returned := time.Date(2025, time.May, 27, 0, 0, 0, 0, time.UTC)
+	checkin := Receipt{Kind: KindCheckin, LoanID: 7, CardNumber: "P00000001", Patron: "Kris", Title: "Dune", DueDate: due, ReturnedAt: &returned,
+		Fine: 0.75, Balance: 2.25, Damaged: true, IssuedAt: issued}
+	text = checkin.Text()
+	for _, line := range []string{"check-in", "Returned: 2025-05-27", "Overdue fine: 0.75", "sent for repair", "Balance: 2.25"} {
+		if !strings.Contains(text, line) {
+			t.Fatalf("expected %q in the receipt:\n%s", line, text)
+		}
+	}
+
+	if strings.Contains(text, "Copy:") || strings.Contains(text, "override") {
+		t.Fatalf("unexpected line on a check-in receipt:\n%s", text)
+	}
+}
+
+var Token = ""
+
+func TestDeskCheckoutWithoutCard(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/desk/checkout", DeskCheckout)
+	router.POST("/login", authentication.LogIn)
+
+	rrLogin := httptest.NewRecorder()
+
+	jsonBody := []byte(`{"email": "kris@kris.com", "password": "passowrd"}`)
+	reqL, err := http.NewRequest(http.MethodPost, "http://localhost:42069/login", bytes.NewReader(jsonBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rrLogin.Result().Body.Close()
+
+	router.ServeHTTP(rrLogin, reqL)
+
+	if rrLogin.Code != http.StatusOK {
+		t.Fatal(rrLogin.Body)
+	}
+
+	var token map[string]string
+	json.NewDecoder(rrLogin.Body).Decode(&token)
+	Token = token["token"]
+
+	rr := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"token": "%s", "barcode": "C-1"}`, Token))
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/desk/checkout", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest && rr.Code != http.StatusForbidden {
+		t.Fatal(rr.Body)
+	}
+}
+
+func TestDeskCheckinUnknownCard(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/desk/checkin", DeskCheckin)
+
+	rr := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"token": "%s", "barcode": "C-1", "cardNumber": "no such card"}`, Token))
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/desk/checkin", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound && rr.Code != http.StatusForbidden {
+		t.Fatal(rr.Body)
+	}
+}
+
+// TestDeskCheckoutAndCheckin lends a copy by card and barcode past the rules with an override, then takes it back overdue
+// and checks the receipts and the fine.
+func TestDeskCheckoutAndCheckin(t *testing.T) {
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	if err = books.CreateCirculationTables(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	userID, _, err := authentication.ValidateJWT(Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cardNumber := ""
+	if err = conn.QueryRow(context.Background(), "select card_number from authentication where id = $1", userID).Scan(&cardNumber); err != nil {
+		t.Fatal(err)
+	}
+
+	var bookID int
+	err = conn.QueryRow(context.Background(), "insert into books (title, author, year, quantity) values ('Desk test', 'Tester', 2000, 1) returning id").Scan(&bookID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		conn.Exec(context.Background(), "delete from ledger where loan_id in (select id from borrowed_books where book_id = $1)", bookID)
+		conn.Exec(context.Background(), "delete from borrowed_books where book_id = $1", bookID)
+		conn.Exec(context.Background(), "delete from books where id = $1", bookID)
+	}()
+
+	barcode := fmt.Sprintf("DESK-%d", bookID)
+	if _, err = conn.Exec(context.Background(), "insert into copies (book_id, barcode, shelf) values ($1, $2, 'Desk')", bookID, barcode); err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/desk/checkout", DeskCheckout)
+	router.POST("/desk/checkin", DeskCheckin)
+
+	// send makes the request and returns the receipt from the answer.
+	send := func(path, body string) Receipt {
+		rr := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodPost, "http://localhost:42069"+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatal(rr.Body)
+		}
+
+		var answer struct {
+			Receipt Receipt `json:"receipt"`
+		}
+		if err = json.NewDecoder(rr.Body).Decode(&answer); err != nil {
+			t.Fatal(err)
+		}
+
+		return answer.Receipt
+	}
+
+	// The override lends for longer than any policy allows.
+	returnDate := time.Now().AddDate(1, 0, 0).Format(time.DateOnly)
+	checkout := send("/desk/checkout", fmt.Sprintf(`{"token": "%s", "cardNumber": "%s", "barcode": "%s", "returnDate": "%s", "override": "visiting scholar"}`,
+		Token, cardNumber, barcode, returnDate))
+	if checkout.Kind != KindCheckout || checkout.CardNumber != cardNumber || checkout.Barcode != barcode || checkout.Override != "visiting scholar" ||
+		checkout.DueDate.Format(time.DateOnly) != returnDate {
+		t.Fatalf("unexpected checkout receipt %+v", checkout)
+	}
+
+	reason := ""
+	err = conn.QueryRow(context.Background(), "select override_reason from borrowed_books where id = $1", checkout.LoanID).Scan(&reason)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reason != "visiting scholar" {
+		t.Fatalf("expected the override reason to be kept with the loan, got %q", reason)
+	}
+
+	_, err = conn.Exec(context.Background(), "update borrowed_books set borrowed_at = current_timestamp - interval '30 days', return_date = current_date - 10 where id = $1",
+		checkout.LoanID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkin := send("/desk/checkin", fmt.Sprintf(`{"token": "%s", "barcode": "%s"}`, Token, barcode))
+	if checkin.Kind != KindCheckin || checkin.LoanID != checkout.LoanID || checkin.CardNumber != cardNumber || checkin.Barcode != barcode ||
+		checkin.ReturnedAt == nil || checkin.Damaged {
+		t.Fatalf("unexpected check-in receipt %+v", checkin)
+	}
+
+	var charged float64
+	err = conn.QueryRow(context.Background(), "select coalesce(sum(amount), 0)::float8 from ledger where loan_id = $1 and kind = 'fine'", checkout.LoanID).Scan(&charged)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if checkin.Fine <= 0 || checkin.Fine != charged {
+		t.Fatalf("expected the overdue fine on the receipt to be the one charged, got %.2f on the receipt and %.2f charged", checkin.Fine, charged)
+	}
+
+	var quantity int
+	status := ""
+	err = conn.QueryRow(context.Background(), "select b.quantity, c.status from books b join copies c on c.book_id = b.id where b.id = $1", bookID).Scan(&quantity, &status)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if quantity != 1 || status != "available" {
+		t.Fatalf("expected the copy back on the shelf, got quantity %d and status %q", quantity, status)
+	}
+}
@@ -0,0 +1,66 @@
+package desk
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	KindCheckout = "checkout"
+	KindCheckin  = "checkin"
+)
+
+// Receipt is what the circulation desk prints for the patron after lending or taking back a book.
+type Receipt struct {
+	Kind       string     `json:"kind"`
+	LoanID     int        `json:"loanID"`
+	CardNumber string     `json:"cardNumber"`
+	Patron     string     `json:"patron"`
+	Title      string     `json:"title"`
+	Barcode    string     `json:"barcode"`
+	DueDate    time.Time  `json:"dueDate"`
+	ReturnedAt *time.Time `json:"returnedAt"`
+	Fine       float64    `json:"fine"`
+	Balance    float64    `json:"balance"`
+	Override   string     `json:"override"`
+	Damaged    bool       `json:"damaged"`
+	IssuedAt   time.Time  `json:"issuedAt"`
+}
+
+// Text lays the receipt out in plain lines for a receipt printer.
+func (r Receipt) Text() string {
+	var b strings.Builder
+	if r.Kind == KindCheckin {
+		b.WriteString("Library receipt - check-in\n")
+	} else {
+		b.WriteString("Library receipt - checkout\n")
+	}
+	fmt.Fprintf(&b, "Issued: %s\n", r.IssuedAt.Format("2006-01-02 15:04"))
+	fmt.Fprintf(&b, "Card: %s (%s)\n", r.CardNumber, r.Patron)
+	fmt.Fprintf(&b, "Loan: %d\n", r.LoanID)
+	fmt.Fprintf(&b, "Title: %s\n", r.Title)
+	if r.Barcode != "" {
+		fmt.Fprintf(&b, "Copy: %s\n", r.Barcode)
+	}
+
+	fmt.Fprintf(&b, "Due: %s\n", r.DueDate.Format(time.DateOnly))
+	if r.ReturnedAt != nil {
+		fmt.Fprintf(&b, "Returned: %s\n", r.ReturnedAt.Format(time.DateOnly))
+	}
+
+	if r.Override != "" {
+		fmt.Fprintf(&b, "Policy override: %s\n", r.Override)
+	}
+
+	if r.Damaged {
+		b.WriteString("The copy came back damaged and was sent for repair\n")
+	}
+
+	if r.Fine > 0 {
+		fmt.Fprintf(&b, "Overdue fine: %.2f\n", r.Fine)
+	}
+	fmt.Fprintf(&b, "Balance: %.2f\n", r.Balance)
+
+	return b.String()
+}
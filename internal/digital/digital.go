@@ -0,0 +1,660 @@
+package digital
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/Phantomvv1/Library_management/internal/authentication"
+	. "github.com/Phantomvv1/Library_management/internal/books"
+	"github.com/Phantomvv1/Library_management/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// DownloadLinkTTL is how long a download link works, it never works longer than the loan itself.
+const DownloadLinkTTL = time.Hour
+
+const maxItemSize = 1 << 30
+
+type DigitalItem struct {
+	ID          int       `json:"id"`
+	BookID      int       `json:"bookID"`
+	Format      string    `json:"format"`
+	FileName    string    `json:"fileName"`
+	License     License   `json:"license"`
+	LoanDays    int       `json:"loanDays"`
+	LoansUsed   int       `json:"loansUsed"`
+	ActiveLoans int       `json:"activeLoans"`
+	Available   bool      `json:"available"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type DigitalLoan struct {
+	ID         int        `json:"id"`
+	ItemID     int        `json:"itemID"`
+	UserID     int        `json:"userID"`
+	BorrowedAt time.Time  `json:"borrowedAt"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	ReturnedAt *time.Time `json:"returnedAt"`
+	Download   string     `json:"download,omitempty"`
+}
+
+var (
+	fileStorage     storage.Storage
+	fileStorageOnce sync.Once
+)
+
+// SetDigitalStorage replaces the directory the files of the digital items are kept in. The files must not be
+// reachable through the uploads served to everybody, they are only downloaded through signed links.
+func SetDigitalStorage(store storage.Storage) {
+	fileStorageOnce.Do(func() {})
+	fileStorage = store
+}
+
+func getStorage() storage.Storage {
+	fileStorageOnce.Do(func() {
+		dir := os.Getenv("DIGITAL_DIR")
+		if dir == "" {
+			dir = "digital"
+		}
+
+		fileStorage = storage.NewLocal(dir, "")
+	})
+
+	return fileStorage
+}
+
+// linkKey is the key download links are signed with, DOWNLOAD_KEY or the key of the tokens when it isn't set.
+func linkKey() []byte {
+	if key := os.Getenv("DOWNLOAD_KEY"); key != "" {
+		return []byte(key)
+	}
+
+	return []byte(os.Getenv("JWT_KEY"))
+}
+
+func downloadLink(loan DigitalLoan, now time.Time) string {
+	expires := now.Add(DownloadLinkTTL)
+	if loan.ExpiresAt.Before(expires) {
+		expires = loan.ExpiresAt
+	}
+
+	query := url.Values{
+		"loan":      {strconv.Itoa(loan.ID)},
+		"expires":   {strconv.FormatInt(expires.Unix(), 10)},
+		"signature": {SignLink(linkKey(), loan.ID, expires)},
+	}
+
+	return "/digital/download?" + query.Encode()
+}
+
+func createTables(conn *pgx.Conn) error {
+	if err := CreateAuthTable(conn); err != nil {
+		return err
+	}
+
+	if err := CreateBookTable(conn); err != nil {
+		return err
+	}
+
+	_, err := conn.Exec(context.Background(), "create table if not exists digital_items (id serial primary key, book_id int not null references books(id) on delete cascade, "+
+		"format text not null, file_key text not null, file_name text not null, content_type text not null, license text not null, copies int not null default 1, "+
+		"max_loans int not null default 0, license_expires_at timestamp, loan_days int not null default 14, loans_used int not null default 0, "+
+		"created_at timestamp not null default current_timestamp);")
+	if err != nil {
+		log.Println(err)
+		return errors.New("Couldn't create a table for the digital items")
+	}
+
+	_, err = conn.Exec(context.Background(), "create table if not exists digital_loans (id serial primary key, item_id int not null references digital_items(id) on delete cascade, "+
+		"user_id int not null references authentication(id) on delete cascade, borrowed_at timestamp not null default current_timestamp, expires_at timestamp not null, "+
+		"returned_at timestamp);")
+	if err != nil {
+		log.Println(err)
+		return errors.New("Couldn't create a table for the loans of digital items")
+	}
+
+	return nil
+}
+
+const itemColumns = "i.id, i.book_id, i.format, i.file_name, i.license, i.copies, i.max_loans, i.license_expires_at, i.loan_days, i.loans_used, i.created_at, " +
+	"(select count(*) from digital_loans l where l.item_id = i.id and l.returned_at is null and l.expires_at > current_timestamp)"
+
+func (item *DigitalItem) fields() []interface{} {
+	return []interface{}{&item.ID, &item.BookID, &item.Format, &item.FileName, &item.License.Model, &item.License.Copies, &item.License.MaxLoans,
+		&item.License.ExpiresAt, &item.LoanDays, &item.LoansUsed, &item.CreatedAt, &item.ActiveLoans}
+}
+
+func formInt(c *gin.Context, name string, fallback int) (int, error) {
+	value := c.PostForm(name)
+	if value == "" {
+		return fallback, nil
+	}
+
+	return strconv.Atoi(value)
+}
+
+// AddDigitalItem uploads an e-book or audiobook file of a book together with the license it was bought under.
+func AddDigitalItem(c *gin.Context) {
+	_, accountType, err := ValidateJWT(c.PostForm("token"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	if accountType != "librarian" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error only librarians can add digital items"})
+		return
+	}
+
+	item := DigitalItem{Format: c.PostForm("format"), License: License{Model: c.PostForm("license")}}
+	item.BookID, err = strconv.Atoi(c.PostForm("bookID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided id of the book"})
+		return
+	}
+
+	if item.Format != "ebook" && item.Format != "audiobook" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error the format has to be ebook or audiobook"})
+		return
+	}
+
+	item.License.Copies, err = formInt(c, "copies", 1)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided number of copies"})
+		return
+	}
+
+	item.License.MaxLoans, err = formInt(c, "maxLoans", 0)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided number of loans"})
+		return
+	}
+
+	item.LoanDays, err = formInt(c, "loanDays", 14)
+	if err != nil || item.LoanDays < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided length of the loans"})
+		return
+	}
+
+	if expires := c.PostForm("licenseExpires"); expires != "" {
+		expiresAt, err := time.Parse(time.DateOnly, expires)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Error the expiry of the license has to be a date (YYYY-MM-DD)"})
+			return
+		}
+		item.License.ExpiresAt = &expiresAt
+	}
+
+	if err = item.License.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error no file provided"})
+		return
+	}
+
+	if fileHeader.Size > maxItemSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Error the file can't be larger than 1GB"})
+		return
+	}
+	item.FileName = path.Base(strings.ReplaceAll(fileHeader.Filename, "\\", "/"))
+
+	contentType := fileHeader.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = createTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adding the digital item"})
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	err = tx.QueryRow(context.Background(), "insert into digital_items (book_id, format, file_key, file_name, content_type, license, copies, max_loans, license_expires_at, loan_days) "+
+		"values ($1, $2, '', $3, $4, $5, $6, $7, $8, $9) returning id, created_at", item.BookID, item.Format, item.FileName, contentType, item.License.Model,
+		item.License.Copies, item.License.MaxLoans, item.License.ExpiresAt, item.LoanDays).Scan(&item.ID, &item.CreatedAt)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error unable to add a digital item to this book"})
+		return
+	}
+
+	key := fmt.Sprintf("items/%d/%s", item.ID, item.FileName)
+	file, err := fileHeader.Open()
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to open the uploaded file"})
+		return
+	}
+	defer file.Close()
+
+	if err = getStorage().Put(context.Background(), key, file, contentType); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error storing the file"})
+		return
+	}
+
+	if _, err = tx.Exec(context.Background(), "update digital_items set file_key = $1 where id = $2", key, item.ID); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adding the digital item"})
+		return
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		log.Println(err)
+		getStorage().Delete(context.Background(), key)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adding the digital item"})
+		return
+	}
+
+	item.Available = item.License.CanLend(0, 0, time.Now()) == nil
+	c.JSON(http.StatusOK, gin.H{"item": item})
+}
+
+// GetDigitalItems lists the e-books and audiobooks of a book and whether they can be borrowed right now.
+func GetDigitalItems(c *gin.Context) {
+	bookID, err := strconv.Atoi(c.Query("bookID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided id of the book"})
+		return
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = createTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := conn.Query(context.Background(), "select "+itemColumns+" from digital_items i where i.book_id = $1 order by i.id", bookID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the digital items"})
+		return
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	items := []DigitalItem{}
+	for rows.Next() {
+		var item DigitalItem
+		if err = rows.Scan(item.fields()...); err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error working with the digital items"})
+			return
+		}
+
+		item.Available = item.License.CanLend(item.ActiveLoans, item.LoansUsed, now) == nil
+		items = append(items, item)
+	}
+
+	if rows.Err() != nil {
+		log.Println(rows.Err())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error working with the digital items"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+// BorrowDigital lends a digital item when its license allows it and returns a download link for the loan.
+func BorrowDigital(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && itemID
+
+	token, _ := information["token"].(string)
+	userID, accountType, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return
+	}
+
+	itemID, ok := information["itemID"].(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided id of the digital item"})
+		return
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = createTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error borrowing the digital item"})
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	// the row lock makes concurrent loans of the same item wait for each other so a license is never overused
+	var item DigitalItem
+	err = tx.QueryRow(context.Background(), "select "+itemColumns+" from digital_items i where i.id = $1 for update", int(itemID)).Scan(item.fields()...)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Error there is no such digital item"})
+			return
+		}
+
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the digital item"})
+		return
+	}
+
+	book := Book{ID: item.BookID}
+	if err = tx.QueryRow(context.Background(), "select age_rating from books where id = $1", book.ID).Scan(&book.AgeRating); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the book of the digital item"})
+		return
+	}
+
+	if status, err := CheckAgeRating(tx, userID, accountType, book); err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	active := 0
+	err = tx.QueryRow(context.Background(), "select count(*) from digital_loans where item_id = $1 and user_id = $2 and returned_at is null and expires_at > current_timestamp",
+		item.ID, userID).Scan(&active)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking the loans of the digital item"})
+		return
+	}
+
+	if active > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Error you have already borrowed this item"})
+		return
+	}
+
+	now := time.Now()
+	if err = item.License.CanLend(item.ActiveLoans, item.LoansUsed, now); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	loan := DigitalLoan{ItemID: item.ID, UserID: userID, ExpiresAt: item.License.LoanEnd(now, item.LoanDays)}
+	err = tx.QueryRow(context.Background(), "insert into digital_loans (item_id, user_id, expires_at) values ($1, $2, $3) returning id, borrowed_at",
+		loan.ItemID, loan.UserID, loan.ExpiresAt).Scan(&loan.ID, &loan.BorrowedAt)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error borrowing the digital item"})
+		return
+	}
+
+	if _, err = tx.Exec(context.Background(), "update digital_items set loans_used = loans_used + 1 where id = $1", item.ID); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error borrowing the digital item"})
+		return
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error borrowing the digital item"})
+		return
+	}
+
+	loan.Download = downloadLink(loan, now)
+	c.JSON(http.StatusOK, gin.H{"loan": loan})
+}
+
+// ReturnDigital ends a loan of a digital item before it expires.
+func ReturnDigital(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && loanID
+
+	token, _ := information["token"].(string)
+	userID, _, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return
+	}
+
+	loanID, ok := information["loanID"].(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided id of the loan"})
+		return
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = createTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	check := 0
+	err = conn.QueryRow(context.Background(), "update digital_loans set returned_at = current_timestamp where id = $1 and user_id = $2 and returned_at is null returning id",
+		int(loanID), userID).Scan(&check)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Error you don't have such a loan or it has already ended"})
+			return
+		}
+
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error returning the digital item"})
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
+
+// GetDigitalLoans lists the running loans of the user with a fresh download link for each of them.
+func GetDigitalLoans(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token
+
+	token, _ := information["token"].(string)
+	userID, _, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = createTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := conn.Query(context.Background(), "select id, item_id, user_id, borrowed_at, expires_at, returned_at from digital_loans "+
+		"where user_id = $1 and returned_at is null and expires_at > current_timestamp order by expires_at", userID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting your loans"})
+		return
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	loans := []DigitalLoan{}
+	for rows.Next() {
+		var loan DigitalLoan
+		if err = rows.Scan(&loan.ID, &loan.ItemID, &loan.UserID, &loan.BorrowedAt, &loan.ExpiresAt, &loan.ReturnedAt); err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error working with your loans"})
+			return
+		}
+
+		loan.Download = downloadLink(loan, now)
+		loans = append(loans, loan)
+	}
+
+	if rows.Err() != nil {
+		log.Println(rows.Err())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error working with your loans"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"loans": loans})
+}
+
+// DownloadDigital serves the file of a running loan to whoever holds a valid signed link.
+func DownloadDigital(c *gin.Context) {
+	loanID, err := strconv.Atoi(c.Query("loan"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidLink.Error()})
+		return
+	}
+
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidLink.Error()})
+		return
+	}
+
+	if err = VerifyLink(linkKey(), loanID, expires, c.Query("signature"), time.Now()); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = createTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var key, fileName, contentType string
+	err = conn.QueryRow(context.Background(), "select i.file_key, i.file_name, i.content_type from digital_loans l join digital_items i on l.item_id = i.id "+
+		"where l.id = $1 and l.returned_at is null and l.expires_at > current_timestamp", loanID).Scan(&key, &fileName, &contentType)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusGone, gin.H{"error": "Error this loan has ended"})
+			return
+		}
+
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the loan"})
+		return
+	}
+
+	file, err := getStorage().Open(context.Background(), key)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading the file"})
+		return
+	}
+	defer file.Close()
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+	c.Header("Content-Type", contentType)
+	c.Status(http.StatusOK)
+	if _, err = io.Copy(c.Writer, file); err != nil {
+		log.Println(err)
+	}
+}
+
+// ExpireDigitalLoans returns every loan that ran out, it returns how many loans were ended.
+func ExpireDigitalLoans(conn *pgx.Conn) (int64, error) {
+	if err := createTables(conn); err != nil {
+		return 0, err
+	}
+
+	tag, err := conn.Exec(context.Background(), "update digital_loans set returned_at = expires_at where returned_at is null and expires_at <= current_timestamp")
+	if err != nil {
+		log.Println(err)
+		return 0, errors.New("Error returning the expired loans of digital items")
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// StartExpiryWorker returns the expired loans of digital items every interval until the context is cancelled.
+func StartExpiryWorker(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				conn, err := pgx.Connect(ctx, os.Getenv("DATABASE_URL"))
+				if err != nil {
+					log.Println(err)
+					continue
+				}
+
+				if expired, err := ExpireDigitalLoans(conn); err != nil {
+					log.Println(err)
+				} else if expired > 0 {
+					log.Printf("Returned %d expired loans of digital items\n", expired)
+				}
+				conn.Close(context.Background())
+			}
+		}
+	}()
+}
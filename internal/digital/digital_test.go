@@ -0,0 +1,219 @@
+package digital
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Phantomvv1/Library_management/internal/authentication"
+	"github.com/Phantomvv1/Library_management/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+var Token = ""
+var ItemID = 0
+
+func TestCanLend(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	later := now.AddDate(0, 1, 0)
+	earlier := now.AddDate(0, -1, 0)
+
+	tests := []struct {
+		license License
+		active  int
+		used    int
+		want    error
+	}{
+		{License{Model: OneCopyOneUser, Copies: 2}, 1, 10, nil},
+		{License{Model: OneCopyOneUser, Copies: 2}, 2, 10, ErrNoCopyAvailable},
+		{License{Model: Concurrent}, 500, 1000, nil},
+		{License{Model: MeteredLoans, Copies: 1, MaxLoans: 26}, 0, 25, nil},
+		{License{Model: MeteredLoans, Copies: 1, MaxLoans: 26}, 0, 26, ErrLicenseExhausted},
+		{License{Model: MeteredTime, Copies: 1, ExpiresAt: &later}, 0, 100, nil},
+		{License{Model: MeteredTime, Copies: 1, ExpiresAt: &earlier}, 0, 0, ErrLicenseExpired},
+	}
+
+	for _, test := range tests {
+		if err := test.license.Validate(); err != nil {
+			t.Fatalf("%+v: %v", test.license, err)
+		}
+
+		if got := test.license.CanLend(test.active, test.used, now); got != test.want {
+			t.Fatalf("%+v with %d active and %d used loans: got %v, want %v", test.license, test.active, test.used, got, test.want)
+		}
+	}
+
+	if err := (License{Model: "forever"}).Validate(); err != ErrUnknownLicense {
+		t.Fatalf("expected an unknown license, got %v", err)
+	}
+}
+
+func TestLoanEnd(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	expires := now.AddDate(0, 0, 3)
+
+	if end := (License{Model: OneCopyOneUser, Copies: 1}).LoanEnd(now, 14); !end.Equal(now.AddDate(0, 0, 14)) {
+		t.Fatalf("expected the loan to last 14 days, it ends %v", end)
+	}
+
+	if end := (License{Model: MeteredTime, Copies: 1, ExpiresAt: &expires}).LoanEnd(now, 14); !end.Equal(expires) {
+		t.Fatalf("expected the loan to end with the license, it ends %v", end)
+	}
+}
+
+func TestSignLink(t *testing.T) {
+	key := []byte("secret")
+	now := time.Unix(1700000000, 0)
+	expires := now.Add(time.Hour)
+	signature := SignLink(key, 7, expires)
+
+	if err := VerifyLink(key, 7, expires.Unix(), signature, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := VerifyLink(key, 8, expires.Unix(), signature, now); err != ErrInvalidLink {
+		t.Fatalf("expected the link of another loan to be invalid, got %v", err)
+	}
+
+	if err := VerifyLink(key, 7, expires.Unix()+3600, signature, now); err != ErrInvalidLink {
+		t.Fatalf("expected an extended link to be invalid, got %v", err)
+	}
+
+	if err := VerifyLink(key, 7, expires.Unix(), signature, expires.Add(time.Second)); err != ErrExpiredLink {
+		t.Fatalf("expected the link to expire, got %v", err)
+	}
+}
+
+func TestDownloadDigitalInvalidLink(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.GET("/digital/download", DownloadDigital)
+
+	rr := httptest.NewRecorder()
+
+	url := fmt.Sprintf("http://localhost:42069/digital/download?loan=1&expires=%d&signature=forged", time.Now().Add(time.Hour).Unix())
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Fatal(rr.Body)
+	}
+}
+
+func TestAddDigitalItem(t *testing.T) {
+	dir, err := os.MkdirTemp("", "digital")
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetDigitalStorage(storage.NewLocal(dir, ""))
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/digital", AddDigitalItem)
+	router.POST("/login", authentication.LogIn)
+
+	rr := httptest.NewRecorder()
+
+	jsonBody := []byte(`{"email": "kris@kris.com", "password": "passowrd"}`)
+	reader := bytes.NewReader(jsonBody)
+
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/login", reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+
+	var token map[string]string
+	json.NewDecoder(rr.Body).Decode(&token)
+	Token = token["token"]
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("token", Token)
+	writer.WriteField("bookID", "1")
+	writer.WriteField("format", "ebook")
+	writer.WriteField("license", OneCopyOneUser)
+	part, err := writer.CreateFormFile("file", "book.epub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte("not really an epub"))
+	writer.Close()
+
+	itemRR := httptest.NewRecorder()
+
+	req, err = http.NewRequest(http.MethodPost, "http://localhost:42069/digital", &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	defer itemRR.Result().Body.Close()
+
+	router.ServeHTTP(itemRR, req)
+
+	if itemRR.Code != http.StatusOK {
+		t.Fatal(itemRR.Body)
+	}
+
+	var response map[string]DigitalItem
+	json.NewDecoder(itemRR.Body).Decode(&response)
+	ItemID = response["item"].ID
+}
+
+func TestBorrowDigital(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/digital/borrow", BorrowDigital)
+	router.GET("/digital/download", DownloadDigital)
+
+	rr := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"itemID": %d, "token": "%s"}`, ItemID, Token))
+	reader := bytes.NewReader(body)
+
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/digital/borrow", reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+
+	var response map[string]DigitalLoan
+	json.NewDecoder(rr.Body).Decode(&response)
+
+	downloadRR := httptest.NewRecorder()
+
+	req, err = http.NewRequest(http.MethodGet, "http://localhost:42069"+response["loan"].Download, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer downloadRR.Result().Body.Close()
+
+	router.ServeHTTP(downloadRR, req)
+
+	if downloadRR.Code != http.StatusOK || downloadRR.Body.String() != "not really an epub" {
+		t.Fatal(downloadRR.Body)
+	}
+}
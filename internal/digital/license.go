@@ -0,0 +1,108 @@
+package digital
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// The license models publishers sell digital items under.
+const (
+	OneCopyOneUser = "one_copy_one_user" // every license lends to one patron at a time
+	Concurrent     = "concurrent"        // any number of patrons at the same time
+	MeteredLoans   = "metered_loans"     // one patron per license, until a number of loans is used up
+	MeteredTime    = "metered_time"      // one patron per license, until the license expires
+)
+
+var (
+	ErrUnknownLicense   = errors.New("Error the license has to be one_copy_one_user, concurrent, metered_loans or metered_time")
+	ErrNoCopyAvailable  = errors.New("Error all the licenses of this item are on loan, try again later")
+	ErrLicenseExhausted = errors.New("Error the license of this item has no loans left")
+	ErrLicenseExpired   = errors.New("Error the license of this item has expired")
+	ErrInvalidLink      = errors.New("Error the download link is invalid")
+	ErrExpiredLink      = errors.New("Error the download link has expired")
+)
+
+type License struct {
+	Model     string     `json:"model"`
+	Copies    int        `json:"copies"`
+	MaxLoans  int        `json:"maxLoans"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+func (l License) Validate() error {
+	switch l.Model {
+	case OneCopyOneUser, Concurrent:
+	case MeteredLoans:
+		if l.MaxLoans < 1 {
+			return errors.New("Error a license metered by loans needs the number of loans")
+		}
+	case MeteredTime:
+		if l.ExpiresAt == nil {
+			return errors.New("Error a license metered by time needs an expiry date")
+		}
+	default:
+		return ErrUnknownLicense
+	}
+
+	if l.Model != Concurrent && l.Copies < 1 {
+		return errors.New("Error the number of copies has to be at least one")
+	}
+
+	return nil
+}
+
+// CanLend reports whether one more loan is allowed when active loans are running and used loans were ever made.
+func (l License) CanLend(active, used int, now time.Time) error {
+	if l.Model == MeteredTime && !now.Before(*l.ExpiresAt) {
+		return ErrLicenseExpired
+	}
+
+	if l.Model == MeteredLoans && used >= l.MaxLoans {
+		return ErrLicenseExhausted
+	}
+
+	if l.Model != Concurrent && active >= l.Copies {
+		return ErrNoCopyAvailable
+	}
+
+	return nil
+}
+
+// LoanEnd returns when a loan made now for loanDays ends, a loan never outlives a license metered by time.
+func (l License) LoanEnd(now time.Time, loanDays int) time.Time {
+	end := now.AddDate(0, 0, loanDays)
+	if l.Model == MeteredTime && l.ExpiresAt.Before(end) {
+		return *l.ExpiresAt
+	}
+
+	return end
+}
+
+func linkSignature(key []byte, loanID int, expires int64) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strconv.Itoa(loanID) + ":" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignLink returns the signature of a download link for the loan that is valid until expires.
+func SignLink(key []byte, loanID int, expires time.Time) string {
+	return linkSignature(key, loanID, expires.Unix())
+}
+
+// VerifyLink checks the signature and the expiry of a download link.
+func VerifyLink(key []byte, loanID int, expires int64, signature string, now time.Time) error {
+	expected := linkSignature(key, loanID, expires)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrInvalidLink
+	}
+
+	if now.Unix() > expires {
+		return ErrExpiredLink
+	}
+
+	return nil
+}
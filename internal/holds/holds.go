@@ -0,0 +1,51 @@
+package holds
+
+import (
+	"sort"
+	"time"
+)
+
+// The states a reservation goes through, a patron waits in the queue until a copy is put aside for them
+// and then has PickupDays to collect it before the hold expires and passes to the next patron.
+const (
+	StatusWaiting   = "waiting"
+	StatusReady     = "ready"
+	StatusCollected = "collected"
+	StatusExpired   = "expired"
+)
+
+// CopyOnHold is the status of a copy set aside for the patron it is ready for.
+const CopyOnHold = "on hold"
+
+// PickupDays is how long a patron has to collect a book once it is ready for them.
+const PickupDays = 7
+
+// PickupDeadline returns the last day a hold ready on now can be collected.
+func PickupDeadline(now time.Time) time.Time {
+	year, month, day := now.Date()
+	return time.Date(year, month, day+PickupDays, 0, 0, 0, 0, time.UTC)
+}
+
+// EstimateReady guesses the day the reservation at position in the queue (1 for the first patron waiting) will be ready,
+// assuming the copies on loan come back on their due dates and every patron before keeps the book for loanDays.
+// It returns nil when no copy is on loan, as then nothing is known about when one will come back.
+func EstimateReady(dueDates []time.Time, position, loanDays int, now time.Time) *time.Time {
+	if len(dueDates) == 0 || position < 1 {
+		return nil
+	}
+
+	dues := make([]time.Time, len(dueDates))
+	copy(dues, dueDates)
+	sort.Slice(dues, func(i, j int) bool { return dues[i].Before(dues[j]) })
+
+	year, month, day := now.Date()
+	today := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+
+	due := dues[(position-1)%len(dues)]
+	if due.Before(today) {
+		due = today
+	}
+
+	ready := due.AddDate(0, 0, (position-1)/len(dues)*loanDays)
+	return &ready
+}
@@ -0,0 +1,42 @@
+package holds
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPickupDeadline(t *testing.T) {
+	now := time.Date(2025, time.February, 25, 16, 0, 0, 0, time.UTC)
+	if deadline := PickupDeadline(now); !deadline.Equal(time.Date(2025, time.March, 4, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected deadline %v", deadline)
+	}
+}
+
+func TestEstimateReady(t *testing.T) {
+	now := time.Date(2025, time.March, 1, 10, 0, 0, 0, time.UTC)
+	dues := []time.Time{
+		time.Date(2025, time.March, 20, 0, 0, 0, 0, time.UTC),
+		time.Date(2025, time.February, 27, 0, 0, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		position int
+		want     time.Time
+	}{
+		{1, time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC)},
+		{2, time.Date(2025, time.March, 20, 0, 0, 0, 0, time.UTC)},
+		{3, time.Date(2025, time.March, 22, 0, 0, 0, 0, time.UTC)},
+		{4, time.Date(2025, time.April, 10, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		got := EstimateReady(dues, test.position, 21, now)
+		if got == nil || !got.Equal(test.want) {
+			t.Fatalf("position %d: got %v, want %v", test.position, got, test.want)
+		}
+	}
+
+	if EstimateReady(nil, 1, 21, now) != nil {
+		t.Fatal("expected no estimate without any loans")
+	}
+}
@@ -0,0 +1,143 @@
+package isbn
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrInvalidLength   = errors.New("Error an ISBN must have 10 or 13 digits")
+	ErrInvalidChar     = errors.New("Error the ISBN contains invalid characters")
+	ErrInvalidChecksum = errors.New("Error the check digit of the ISBN is incorrect")
+	ErrNoISBN10        = errors.New("Error only ISBN-13 numbers starting with 978 can be converted to ISBN-10")
+)
+
+// Normalize strips hyphens and spaces and upper-cases a trailing x.
+func Normalize(s string) string {
+	var b strings.Builder
+	for _, r := range strings.TrimSpace(s) {
+		switch {
+		case r == '-' || r == ' ':
+			continue
+		case r == 'x':
+			b.WriteRune('X')
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+func checkDigit10(digits string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(digits[i]-'0') * (10 - i)
+	}
+
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return 'X'
+	}
+
+	return byte('0' + check)
+}
+
+func checkDigit13(digits string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += int(digits[i]-'0') * weight
+	}
+
+	return byte('0' + (10-sum%10)%10)
+}
+
+func onlyDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func validate10(s string) error {
+	if !onlyDigits(s[:9]) || !(onlyDigits(s[9:]) || s[9] == 'X') {
+		return ErrInvalidChar
+	}
+
+	if checkDigit10(s) != s[9] {
+		return ErrInvalidChecksum
+	}
+
+	return nil
+}
+
+func validate13(s string) error {
+	if !onlyDigits(s) {
+		return ErrInvalidChar
+	}
+
+	if checkDigit13(s) != s[12] {
+		return ErrInvalidChecksum
+	}
+
+	return nil
+}
+
+// Validate reports whether s is a well formed ISBN-10 or ISBN-13 with a correct check digit.
+func Validate(s string) error {
+	s = Normalize(s)
+	switch len(s) {
+	case 10:
+		return validate10(s)
+	case 13:
+		return validate13(s)
+	default:
+		return ErrInvalidLength
+	}
+}
+
+// To13 converts a valid ISBN-10 or ISBN-13 into its normalized ISBN-13 form.
+func To13(s string) (string, error) {
+	s = Normalize(s)
+	if err := Validate(s); err != nil {
+		return "", err
+	}
+
+	if len(s) == 13 {
+		return s, nil
+	}
+
+	digits := "978" + s[:9]
+	return digits + string(checkDigit13(digits)), nil
+}
+
+// To10 converts a valid ISBN into its normalized ISBN-10 form when one exists.
+func To10(s string) (string, error) {
+	s = Normalize(s)
+	if err := Validate(s); err != nil {
+		return "", err
+	}
+
+	if len(s) == 10 {
+		return s, nil
+	}
+
+	if !strings.HasPrefix(s, "978") {
+		return "", ErrNoISBN10
+	}
+
+	digits := s[3:12]
+	return digits + string(checkDigit10(digits)), nil
+}
+
+// Canonical is the form stored in the books table: a normalized ISBN-13.
+func Canonical(s string) (string, error) {
+	return To13(s)
+}
@@ -0,0 +1,58 @@
+package isbn
+
+import "testing"
+
+func TestValidate(t *testing.T) {
+	valid := []string{"978-3-16-148410-0", "0-306-40615-2", "080442957X", "080442957x", "9780306406157"}
+	for _, s := range valid {
+		if err := Validate(s); err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+	}
+
+	invalid := map[string]error{
+		"978-3-16-148410-1": ErrInvalidChecksum,
+		"0-306-40615-3":     ErrInvalidChecksum,
+		"12345":             ErrInvalidLength,
+		"97831614841A0":     ErrInvalidChar,
+		"X306406152":        ErrInvalidChar,
+	}
+	for s, want := range invalid {
+		if err := Validate(s); err != want {
+			t.Fatalf("%s: expected %v, got %v", s, want, err)
+		}
+	}
+}
+
+func TestConversion(t *testing.T) {
+	isbn13, err := To13("0-306-40615-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if isbn13 != "9780306406157" {
+		t.Fatal(isbn13)
+	}
+
+	isbn10, err := To10(isbn13)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if isbn10 != "0306406152" {
+		t.Fatal(isbn10)
+	}
+
+	isbn10, err = To10("9780804429573")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if isbn10 != "080442957X" {
+		t.Fatal(isbn10)
+	}
+
+	if _, err = To10("979-10-90636-07-1"); err != ErrNoISBN10 {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,217 @@
+package ledger
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	KindDamage      = "damage"
+	KindFine        = "fine"
+	KindPayment     = "payment"
+	KindWaiver      = "waiver"
+	KindReplacement = "replacement"
+	KindReversal    = "reversal"
+)
+
+var (
+	ErrInvalidAmount = errors.New("Error the amount has to be a positive number with at most two decimals")
+	ErrNoUser        = errors.New("Error there is nobody to charge")
+	ErrInvalidCredit = errors.New("Error only payments and waivers can lower the balance")
+	ErrOverpayment   = errors.New("Error the amount is more than the user owes")
+)
+
+// DB is what the ledger needs from a connection, both *pgx.Conn and pgx.Tx satisfy it.
+type DB interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// Entry is a single line in the account of a user, charges are positive amounts and payments, waivers and reversals negative ones.
+type Entry struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"userID"`
+	LoanID    int       `json:"loanID"`
+	Kind      string    `json:"kind"`
+	Amount    float64   `json:"amount"`
+	Note      string    `json:"note"`
+	CreatedBy int       `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func CreateLedgerTable(db DB) error {
+	_, err := db.Exec(context.Background(), "create table if not exists ledger (id serial primary key, user_id int not null, kind text not null, "+
+		"amount numeric(10, 2) not null, note text not null default '', created_by int not null default 0, created_at timestamp not null default current_timestamp);")
+	if err != nil {
+		log.Println(err)
+		return errors.New("Couldn't create a table for the accounts of the users")
+	}
+
+	_, err = db.Exec(context.Background(), "alter table ledger add column if not exists loan_id int;")
+	if err != nil {
+		log.Println(err)
+		return errors.New("Couldn't create a table for the accounts of the users")
+	}
+
+	_, err = db.Exec(context.Background(), "create index if not exists ledger_user_id on ledger (user_id, created_at);")
+	if err != nil {
+		log.Println(err)
+		return errors.New("Couldn't create a table for the accounts of the users")
+	}
+
+	return nil
+}
+
+// ValidAmount reports whether amount can be charged, a positive sum in whole cents.
+func ValidAmount(amount float64) bool {
+	return amount > 0 && amount < 1e8 && math.Abs(amount*100-math.Round(amount*100)) < 1e-6
+}
+
+const entryColumns = "id, user_id, coalesce(loan_id, 0), kind, amount, note, created_by, created_at"
+
+func (e *Entry) fields() []interface{} {
+	return []interface{}{&e.ID, &e.UserID, &e.LoanID, &e.Kind, &e.Amount, &e.Note, &e.CreatedBy, &e.CreatedAt}
+}
+
+func record(db DB, entry Entry) (Entry, error) {
+	var loanID *int
+	if entry.LoanID != 0 {
+		loanID = &entry.LoanID
+	}
+
+	err := db.QueryRow(context.Background(), "insert into ledger (user_id, loan_id, kind, amount, note, created_by) values ($1, $2, $3, $4, $5, $6) returning id, created_at",
+		entry.UserID, loanID, entry.Kind, entry.Amount, entry.Note, entry.CreatedBy).Scan(&entry.ID, &entry.CreatedAt)
+	if err != nil {
+		log.Println(err)
+		return Entry{}, errors.New("Error writing to the account of the user")
+	}
+
+	return entry, nil
+}
+
+// Charge adds a charge of amount to the account of the user, createdBy is the librarian who charged it.
+func Charge(db DB, userID int, kind string, amount float64, note string, createdBy int) (Entry, error) {
+	return ChargeLoan(db, userID, 0, kind, amount, note, createdBy)
+}
+
+// ChargeLoan is Charge for a charge that comes from a loan, like an overdue fine.
+func ChargeLoan(db DB, userID, loanID int, kind string, amount float64, note string, createdBy int) (Entry, error) {
+	if userID == 0 {
+		return Entry{}, ErrNoUser
+	}
+
+	if !ValidAmount(amount) {
+		return Entry{}, ErrInvalidAmount
+	}
+
+	return record(db, Entry{UserID: userID, LoanID: loanID, Kind: kind, Amount: math.Round(amount*100) / 100, Note: strings.TrimSpace(note), CreatedBy: createdBy})
+}
+
+// Credit lowers the balance of the user by amount with a payment or a waiver, loanID is the loan it is for or 0.
+// It can't take the balance below zero, so the caller should hold a lock on the user while crediting.
+func Credit(db DB, userID, loanID int, kind string, amount float64, note string, createdBy int) (Entry, error) {
+	if kind != KindPayment && kind != KindWaiver {
+		return Entry{}, ErrInvalidCredit
+	}
+
+	if userID == 0 {
+		return Entry{}, ErrNoUser
+	}
+
+	if !ValidAmount(amount) {
+		return Entry{}, ErrInvalidAmount
+	}
+
+	balance, err := Balance(db, userID)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	amount = math.Round(amount*100) / 100
+	if amount > balance {
+		return Entry{}, ErrOverpayment
+	}
+
+	return record(db, Entry{UserID: userID, LoanID: loanID, Kind: kind, Amount: -amount, Note: strings.TrimSpace(note), CreatedBy: createdBy})
+}
+
+// ReverseReplacement takes back what the user was charged for replacing the book of a loan that turned up again,
+// it returns an empty entry when nothing is left to take back. The balance can go below zero when the charge was already paid.
+func ReverseReplacement(db DB, userID, loanID int, note string, createdBy int) (Entry, error) {
+	charged, err := LoanCharged(db, loanID, KindReplacement)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	reversed, err := LoanCharged(db, loanID, KindReversal)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	owed := math.Round((charged+reversed)*100) / 100
+	if owed <= 0 {
+		return Entry{}, nil
+	}
+
+	return record(db, Entry{UserID: userID, LoanID: loanID, Kind: KindReversal, Amount: -owed, Note: strings.TrimSpace(note), CreatedBy: createdBy})
+}
+
+// Balance returns how much the user owes.
+func Balance(db DB, userID int) (float64, error) {
+	balance := 0.0
+	err := db.QueryRow(context.Background(), "select coalesce(sum(amount), 0)::float8 from ledger where user_id = $1", userID).Scan(&balance)
+	if err != nil {
+		log.Println(err)
+		return 0, errors.New("Error getting the balance of the user")
+	}
+
+	return balance, nil
+}
+
+// LoanCharged returns the sum of the charges of the kind made for the loan.
+func LoanCharged(db DB, loanID int, kind string) (float64, error) {
+	charged := 0.0
+	err := db.QueryRow(context.Background(), "select coalesce(sum(amount), 0)::float8 from ledger where loan_id = $1 and kind = $2", loanID, kind).Scan(&charged)
+	if err != nil {
+		log.Println(err)
+		return 0, errors.New("Error getting the charges of the loan")
+	}
+
+	return charged, nil
+}
+
+// Entries returns the account of the user, the newest entries first.
+func Entries(db DB, userID int) ([]Entry, error) {
+	rows, err := db.Query(context.Background(), "select "+entryColumns+" from ledger where user_id = $1 order by created_at desc, id desc", userID)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("Error getting the account of the user")
+	}
+	defer rows.Close()
+
+	entries := []Entry{}
+	for rows.Next() {
+		var entry Entry
+		if err = rows.Scan(entry.fields()...); err != nil {
+			log.Println(err)
+			return nil, errors.New("Error working with the account of the user")
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if rows.Err() != nil {
+		log.Println(rows.Err())
+		return nil, errors.New("Error working with the account of the user")
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,39 @@
+package ledger
+
+import "testing"
+
+func TestValidAmount(t *testing.T) {
+	tests := []struct {
+		amount float64
+		want   bool
+	}{
+		{12.5, true},
+		{0.01, true},
+		{19.99, true},
+		{0, false},
+		{-3, false},
+		{1.005, false},
+	}
+
+	for _, test := range tests {
+		if got := ValidAmount(test.amount); got != test.want {
+			t.Fatalf("ValidAmount(%v) = %v, want %v", test.amount, got, test.want)
+		}
+	}
+}
+
+func TestChargeWithoutUser(t *testing.T) {
+	if _, err := Charge(nil, 0, KindDamage, 5, "", 1); err != ErrNoUser {
+		t.Fatalf("expected ErrNoUser, got %v", err)
+	}
+}
+
+func TestCreditKinds(t *testing.T) {
+	if _, err := Credit(nil, 1, 0, KindFine, 5, "", 1); err != ErrInvalidCredit {
+		t.Fatalf("expected ErrInvalidCredit, got %v", err)
+	}
+
+	if _, err := Credit(nil, 1, 0, KindPayment, -5, "", 1); err != ErrInvalidAmount {
+		t.Fatalf("expected ErrInvalidAmount, got %v", err)
+	}
+}
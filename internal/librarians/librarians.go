@@ -11,6 +11,7 @@ import (
 	"time"
 
 	. "github.com/Phantomvv1/Library_management/internal/authentication"
+	"github.com/Phantomvv1/Library_management/internal/books"
 	. "github.com/Phantomvv1/Library_management/internal/users"
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5"
@@ -359,25 +360,13 @@ func GetEvents(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"events": events})
 }
 
+// GetUserHistory returns a page of the loans of the patron with "userID" or, without it, of everybody, the latest first.
 func GetUserHistory(c *gin.Context) {
-	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
-	if err != nil {
-		log.Println(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to connect to the database"})
-		return
-	}
-	defer conn.Close(context.Background())
-
-	err = CreateAuthTable(conn)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
-		return
-	}
-
-	var information map[string]string
-	json.NewDecoder(c.Request.Body).Decode(&information) //token
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && userID (optional) && page (optional) && limit (optional)
 
-	_, accoutnType, err := ValidateJWT(information["token"])
+	token, _ := information["token"].(string)
+	_, accoutnType, err := ValidateJWT(token)
 	if err != nil {
 		log.Println(err)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
@@ -389,33 +378,33 @@ func GetUserHistory(c *gin.Context) {
 		return
 	}
 
-	rows, err := conn.Query(context.Background(), "select name, email, history from authentication a where a.type = 'user';")
+	userID, _ := information["userID"].(float64)
+	page, err := books.PageFrom(information)
 	if err != nil {
-		log.Println(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the users' history"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	var profiles []Profile
-	for rows.Next() {
-		var profile Profile
-		err = rows.Scan(&profile.Name, &profile.Email, &profile.History)
-		if err != nil {
-			log.Println(err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the users' history"})
-			return
-		}
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
 
-		profiles = append(profiles, profile)
+	if err = books.CreateCirculationTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	if rows.Err() != nil {
-		log.Println(rows.Err())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the users' history"})
+	history, total, err := books.LoanHistory(conn, int(userID), page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"user history": profiles})
+	c.JSON(http.StatusOK, gin.H{"history": history, "page": page.Number, "limit": page.Size, "total": total})
 }
 
 func GetUpcomingEvents(c *gin.Context) {
@@ -0,0 +1,351 @@
+package loans
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	. "github.com/Phantomvv1/Library_management/internal/authentication"
+	"github.com/Phantomvv1/Library_management/internal/blocks"
+	. "github.com/Phantomvv1/Library_management/internal/books"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+type Loan struct {
+	ID         int        `json:"id"`
+	BookID     int        `json:"bookID"`
+	UserID     int        `json:"userID"`
+	CopyID     int        `json:"copyID"`
+	DueDate    time.Time  `json:"dueDate"`
+	BorrowedAt *time.Time `json:"borrowedAt"`
+	ReturnedAt *time.Time `json:"returnedAt"`
+	Renewals   int        `json:"renewals"`
+	Missing    string     `json:"missing"`
+	RecalledAt *time.Time `json:"recalledAt"`
+}
+
+type Renewal struct {
+	ID         int       `json:"id"`
+	LoanID     int       `json:"loanID"`
+	OldDueDate time.Time `json:"oldDueDate"`
+	NewDueDate time.Time `json:"newDueDate"`
+	RenewedBy  int       `json:"renewedBy"`
+	RenewedAt  time.Time `json:"renewedAt"`
+}
+
+const loanColumns = "l.id, l.book_id, l.user_id, coalesce(l.copy_id, 0), l.return_date, l.borrowed_at, l.returned_at, l.renewals, l.missing, l.recalled_at"
+
+func (l *Loan) fields() []interface{} {
+	return []interface{}{&l.ID, &l.BookID, &l.UserID, &l.CopyID, &l.DueDate, &l.BorrowedAt, &l.ReturnedAt, &l.Renewals, &l.Missing, &l.RecalledAt}
+}
+
+func createTables(conn *pgx.Conn) error {
+	if err := CreateCirculationTables(conn); err != nil {
+		return err
+	}
+
+	_, err := conn.Exec(context.Background(), "create table if not exists loan_renewals (id serial primary key, loan_id int not null references borrowed_books(id) on delete cascade, "+
+		"old_due_date date not null, new_due_date date not null, renewed_by int not null, renewed_at timestamp not null default current_timestamp);")
+	if err != nil {
+		log.Println(err)
+		return errors.New("Couldn't create a table for the renewals of the loans")
+	}
+
+	return nil
+}
+
+// RenewLoan extends the due date of a loan (/loans/:id/renew) by the renewal days of its policy. A patron renews their own loans,
+// librarians renew anybody's. The number of renewals is capped by the policy and a book other patrons reserved can't be renewed.
+func RenewLoan(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token
+
+	token, _ := information["token"].(string)
+	userID, accountType, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error unable to parse the id of the loan"})
+		return
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error couldn't connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = createTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error renewing the loan"})
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	var loan Loan
+	err = tx.QueryRow(context.Background(), "select "+loanColumns+" from borrowed_books l where l.id = $1 and not l.migrated for update", id).Scan(loan.fields()...)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Error there is no such loan"})
+			return
+		}
+
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the loan"})
+		return
+	}
+
+	if loan.UserID != userID && accountType != "librarian" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error you can only renew your own loans"})
+		return
+	}
+
+	if loan.ReturnedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Error this book has already been returned"})
+		return
+	}
+
+	if loan.Missing != "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Error this book is " + loan.Missing + " and can't be renewed"})
+		return
+	}
+
+	if loan.RecalledAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Error this book has been recalled, please return it by " + loan.DueDate.Format(time.DateOnly)})
+		return
+	}
+
+	if reason, err := blocks.Check(tx, loan.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	} else if reason != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error the loan can't be renewed, " + reason, "reason": reason})
+		return
+	}
+
+	book := Book{ID: loan.BookID}
+	err = tx.QueryRow(context.Background(), "select item_category from books where id = $1", loan.BookID).Scan(&book.Category)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the book of the loan"})
+		return
+	}
+
+	policy, err := LoanPolicy(tx, loan.UserID, book)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !policy.CanRenew(loan.Renewals) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error this loan has already been renewed " + strconv.Itoa(loan.Renewals) + " times, which is the most allowed"})
+		return
+	}
+
+	reserved := false
+	err = tx.QueryRow(context.Background(), "select exists (select 1 from book_reservations where book_id = $1 and user_id <> $2 and status = 'waiting')", loan.BookID, loan.UserID).Scan(&reserved)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking the reservations of the book"})
+		return
+	}
+
+	if reserved {
+		c.JSON(http.StatusConflict, gin.H{"error": "Error other patrons are waiting for this book, please return it by " + loan.DueDate.Format(time.DateOnly)})
+		return
+	}
+
+	renewal := Renewal{LoanID: loan.ID, OldDueDate: loan.DueDate, NewDueDate: policy.RenewedDueDate(loan.DueDate, time.Now()), RenewedBy: userID}
+	_, err = tx.Exec(context.Background(), "update borrowed_books set return_date = $1, renewals = renewals + 1 where id = $2", renewal.NewDueDate, loan.ID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error renewing the loan"})
+		return
+	}
+
+	err = tx.QueryRow(context.Background(), "insert into loan_renewals (loan_id, old_due_date, new_due_date, renewed_by) values ($1, $2, $3, $4) returning id, renewed_at",
+		renewal.LoanID, renewal.OldDueDate, renewal.NewDueDate, renewal.RenewedBy).Scan(&renewal.ID, &renewal.RenewedAt)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error recording the renewal"})
+		return
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error renewing the loan"})
+		return
+	}
+
+	loan.DueDate = renewal.NewDueDate
+	loan.Renewals++
+
+	c.JSON(http.StatusOK, gin.H{"loan": loan, "renewal": renewal, "renewalsLeft": policy.MaxRenewals - loan.Renewals})
+}
+
+// GetRenewals lists the renewals of a loan (/loans/:id/renewals) to its borrower or a librarian.
+func GetRenewals(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token
+
+	token, _ := information["token"].(string)
+	userID, accountType, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error unable to parse the id of the loan"})
+		return
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error couldn't connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = createTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var loan Loan
+	err = conn.QueryRow(context.Background(), "select "+loanColumns+" from borrowed_books l where l.id = $1 and not l.migrated", id).Scan(loan.fields()...)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Error there is no such loan"})
+			return
+		}
+
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the loan"})
+		return
+	}
+
+	if loan.UserID != userID && accountType != "librarian" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error you can only see your own loans"})
+		return
+	}
+
+	rows, err := conn.Query(context.Background(), "select id, loan_id, old_due_date, new_due_date, renewed_by, renewed_at from loan_renewals where loan_id = $1 order by renewed_at", id)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the renewals of the loan"})
+		return
+	}
+	defer rows.Close()
+
+	renewals := []Renewal{}
+	for rows.Next() {
+		var renewal Renewal
+		if err = rows.Scan(&renewal.ID, &renewal.LoanID, &renewal.OldDueDate, &renewal.NewDueDate, &renewal.RenewedBy, &renewal.RenewedAt); err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error working with the renewals of the loan"})
+			return
+		}
+
+		renewals = append(renewals, renewal)
+	}
+
+	if rows.Err() != nil {
+		log.Println(rows.Err())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error working with the renewals of the loan"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"loan": loan, "renewals": renewals})
+}
+
+// GetLoans lists the books a patron has borrowed and not returned yet with their due dates, librarians can ask for any patron with "userID".
+func GetLoans(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && userID (optional)
+
+	token, _ := information["token"].(string)
+	userID, accountType, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return
+	}
+
+	if patronID, ok := information["userID"].(float64); ok && int(patronID) != userID {
+		if accountType != "librarian" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Error you can only see your own loans"})
+			return
+		}
+		userID = int(patronID)
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error couldn't connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = createTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := conn.Query(context.Background(), "select "+loanColumns+", b.title from borrowed_books l join books b on l.book_id = b.id "+
+		"where l.user_id = $1 and l.returned_at is null order by l.return_date, l.id", userID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the loans"})
+		return
+	}
+	defer rows.Close()
+
+	type loanWithTitle struct {
+		Loan
+		Title string `json:"title"`
+	}
+
+	loans := []loanWithTitle{}
+	for rows.Next() {
+		var loan loanWithTitle
+		if err = rows.Scan(append(loan.fields(), &loan.Title)...); err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error working with the loans"})
+			return
+		}
+
+		loans = append(loans, loan)
+	}
+
+	if rows.Err() != nil {
+		log.Println(rows.Err())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error working with the loans"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"loans": loans})
+}
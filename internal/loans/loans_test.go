@@ -0,0 +1,161 @@
+package loans
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Phantomvv1/Library_management/internal/authentication"
+	"github.com/gin-gonic/gin"
+)
+
+var Token = ""
+
+func TestGetLoans(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/loans", GetLoans)
+	router.POST("/login", authentication.LogIn)
+
+	rrLogin := httptest.NewRecorder()
+
+	jsonBody := []byte(`{"email": "kris@kris.com", "password": "passowrd"}`)
+	reqL, err := http.NewRequest(http.MethodPost, "http://localhost:42069/login", bytes.NewReader(jsonBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rrLogin.Result().Body.Close()
+
+	router.ServeHTTP(rrLogin, reqL)
+
+	if rrLogin.Code != http.StatusOK {
+		t.Fatal(rrLogin.Body)
+	}
+
+	var token map[string]string
+	json.NewDecoder(rrLogin.Body).Decode(&token)
+	Token = token["token"]
+
+	rr := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"token": "%s"}`, Token))
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/loans", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+}
+
+func TestRenewLoan(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/loans/:id/renew", RenewLoan)
+
+	rr := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"token": "%s"}`, Token))
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/loans/1/renew", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK && rr.Code != http.StatusConflict && rr.Code != http.StatusForbidden {
+		t.Fatal(rr.Body)
+	}
+}
+
+func TestGetRenewals(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/loans/:id/renewals", GetRenewals)
+
+	rr := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"token": "%s"}`, Token))
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/loans/1/renewals", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK && rr.Code != http.StatusNotFound {
+		t.Fatal(rr.Body)
+	}
+}
+
+func TestMarkLoanLostWithInvalidAmount(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/loans/:id/lost", MarkLoanLost)
+
+	rr := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"token": "%s", "amount": -3}`, Token))
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/loans/1/lost", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest && rr.Code != http.StatusForbidden {
+		t.Fatal(rr.Body)
+	}
+}
+
+func TestMarkLoanFound(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/loans/:id/found", MarkLoanFound)
+
+	rr := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"token": "%s"}`, Token))
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/loans/1/found", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK && rr.Code != http.StatusConflict && rr.Code != http.StatusNotFound && rr.Code != http.StatusForbidden {
+		t.Fatal(rr.Body)
+	}
+}
+
+func TestRecallLoan(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/loans/:id/recall", RecallLoan)
+
+	rr := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"token": "%s"}`, Token))
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/loans/1/recall", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK && rr.Code != http.StatusConflict && rr.Code != http.StatusNotFound && rr.Code != http.StatusForbidden {
+		t.Fatal(rr.Body)
+	}
+}
@@ -0,0 +1,185 @@
+package loans
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	. "github.com/Phantomvv1/Library_management/internal/authentication"
+	. "github.com/Phantomvv1/Library_management/internal/books"
+	"github.com/Phantomvv1/Library_management/internal/ledger"
+	"github.com/Phantomvv1/Library_management/internal/missing"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// MarkLoanLost marks a loan lost (/loans/:id/lost), the borrower is charged "amount" for replacing the book or,
+// without it, the replacement cost of the policy of the loan.
+func MarkLoanLost(c *gin.Context) {
+	markMissing(c, missing.StatusLost)
+}
+
+// MarkLoanClaimed marks a loan claimed returned (/loans/:id/claimed) when the borrower says they returned a book nobody can find,
+// its fine stops growing while the copy is searched for.
+func MarkLoanClaimed(c *gin.Context) {
+	markMissing(c, missing.StatusClaimed)
+}
+
+func markMissing(c *gin.Context, status string) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && amount (optional, only for lost books)
+
+	token, _ := information["token"].(string)
+	librarianID, accountType, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return
+	}
+
+	if accountType != "librarian" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error only librarians can mark books as " + status})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error unable to parse the id of the loan"})
+		return
+	}
+
+	amount := 0.0
+	if value, ok := information["amount"]; ok && status == missing.StatusLost {
+		amount, ok = value.(float64)
+		if !ok || !ledger.ValidAmount(amount) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": ledger.ErrInvalidAmount.Error()})
+			return
+		}
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error couldn't connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = createTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error marking the loan as " + status})
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	loan, err := MarkMissing(tx, id, librarianID, status, amount)
+	if err != nil {
+		respondMissingError(c, err)
+		return
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error marking the loan as " + status})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"loan": loan})
+}
+
+// MarkLoanFound checks in a lost book or one claimed returned once it turns up (/loans/:id/found). A book claimed returned counts as
+// returned on the day of the claim and the replacement charged for a lost one is taken back, the fine up to the day it went missing stays.
+func MarkLoanFound(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && condition (optional) && notes (optional)
+
+	token, _ := information["token"].(string)
+	librarianID, accountType, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return
+	}
+
+	if accountType != "librarian" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error only librarians can mark books as found"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error unable to parse the id of the loan"})
+		return
+	}
+
+	condition, _ := information["condition"].(string)
+	notes, _ := information["notes"].(string)
+	if condition != "" && !slices.Contains(Conditions, condition) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error the condition must be one of " + strings.Join(Conditions, ", ")})
+		return
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error couldn't connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = createTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if condition != "" {
+		if err = CreateDamageReportsTable(conn); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error marking the loan as found"})
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	slip, err := MarkFound(tx, id, librarianID, condition, strings.TrimSpace(notes))
+	if err != nil {
+		respondMissingError(c, err)
+		return
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error marking the loan as found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"return": slip})
+}
+
+func respondMissingError(c *gin.Context, err error) {
+	switch err {
+	case ErrNoLoan:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case missing.ErrNotOutstanding, missing.ErrNotMissing:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
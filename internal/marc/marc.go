@@ -0,0 +1,455 @@
+package marc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	subfieldDelimiter = 0x1F
+	fieldTerminator   = 0x1E
+	recordTerminator  = 0x1D
+
+	leaderLength         = 24
+	directoryEntryLength = 12
+
+	Namespace = "http://www.loc.gov/MARC21/slim"
+)
+
+type Subfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+// Field is either a control field (tags 001-009, only Value is set) or a data field with indicators and subfields.
+type Field struct {
+	Tag       string
+	Ind1      string
+	Ind2      string
+	Value     string
+	Subfields []Subfield
+}
+
+type Record struct {
+	Leader string
+	Fields []Field
+}
+
+func (f Field) IsControl() bool {
+	return f.Tag < "010"
+}
+
+// Subfield returns the first subfield with the given code.
+func (f Field) Subfield(code string) string {
+	for _, sf := range f.Subfields {
+		if sf.Code == code {
+			return sf.Value
+		}
+	}
+
+	return ""
+}
+
+// FieldsByTag returns all the fields with the given tag in the order they appear in the record.
+func (r Record) FieldsByTag(tag string) []Field {
+	var fields []Field
+	for _, f := range r.Fields {
+		if f.Tag == tag {
+			fields = append(fields, f)
+		}
+	}
+
+	return fields
+}
+
+func (r Record) Field(tag string) (Field, bool) {
+	for _, f := range r.Fields {
+		if f.Tag == tag {
+			return f, true
+		}
+	}
+
+	return Field{}, false
+}
+
+// ReadBinary parses a stream of ISO 2709 (binary MARC21) records.
+func ReadBinary(r io.Reader) ([]Record, error) {
+	reader := bufio.NewReader(r)
+	var records []Record
+	for {
+		raw, err := reader.ReadBytes(recordTerminator)
+		if len(bytes.TrimSpace(raw)) == 0 && err == io.EOF {
+			return records, nil
+		}
+
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		record, parseErr := parseBinaryRecord(raw)
+		if parseErr != nil {
+			return nil, fmt.Errorf("Error parsing record %d: %w", len(records)+1, parseErr)
+		}
+		records = append(records, record)
+
+		if err == io.EOF {
+			return records, nil
+		}
+	}
+}
+
+func parseBinaryRecord(raw []byte) (Record, error) {
+	raw = bytes.TrimLeft(raw, "\r\n ")
+	if len(raw) < leaderLength+1 {
+		return Record{}, errors.New("record is shorter than its leader")
+	}
+
+	leader := string(raw[:leaderLength])
+	baseAddress, err := strconv.Atoi(leader[12:17])
+	if err != nil || baseAddress > len(raw) || baseAddress <= leaderLength {
+		return Record{}, errors.New("invalid base address of data")
+	}
+
+	directory := raw[leaderLength : baseAddress-1]
+	if len(directory)%directoryEntryLength != 0 {
+		return Record{}, errors.New("invalid directory length")
+	}
+
+	record := Record{Leader: leader}
+	data := raw[baseAddress:]
+	for i := 0; i < len(directory); i += directoryEntryLength {
+		entry := string(directory[i : i+directoryEntryLength])
+		length, err := strconv.Atoi(entry[3:7])
+		if err != nil {
+			return Record{}, fmt.Errorf("invalid field length in directory entry %q", entry)
+		}
+
+		start, err := strconv.Atoi(entry[7:12])
+		if err != nil {
+			return Record{}, fmt.Errorf("invalid field start in directory entry %q", entry)
+		}
+
+		if start < 0 || length < 0 || start+length > len(data) {
+			return Record{}, fmt.Errorf("field %s points outside of the record", entry[:3])
+		}
+
+		content := bytes.TrimRight(data[start:start+length], string([]byte{fieldTerminator, recordTerminator}))
+		record.Fields = append(record.Fields, parseBinaryField(entry[:3], content))
+	}
+
+	return record, nil
+}
+
+func parseBinaryField(tag string, content []byte) Field {
+	field := Field{Tag: tag}
+	if field.IsControl() {
+		field.Value = string(content)
+		return field
+	}
+
+	if len(content) >= 2 {
+		field.Ind1, field.Ind2 = string(content[0]), string(content[1])
+		content = content[2:]
+	}
+
+	for _, part := range bytes.Split(content, []byte{subfieldDelimiter}) {
+		if len(part) == 0 {
+			continue
+		}
+
+		field.Subfields = append(field.Subfields, Subfield{Code: string(part[0]), Value: string(part[1:])})
+	}
+
+	return field
+}
+
+// WriteBinary encodes the records as ISO 2709, recomputing the record length and base address in the leader.
+func WriteBinary(w io.Writer, records []Record) error {
+	for _, record := range records {
+		var directory, data bytes.Buffer
+		for _, f := range record.Fields {
+			start := data.Len()
+			if f.IsControl() {
+				data.WriteString(f.Value)
+			} else {
+				data.WriteString(indicator(f.Ind1) + indicator(f.Ind2))
+				for _, sf := range f.Subfields {
+					data.WriteByte(subfieldDelimiter)
+					data.WriteString(sf.Code + sf.Value)
+				}
+			}
+			data.WriteByte(fieldTerminator)
+			fmt.Fprintf(&directory, "%3s%04d%05d", f.Tag, data.Len()-start, start)
+		}
+		directory.WriteByte(fieldTerminator)
+		data.WriteByte(recordTerminator)
+
+		leader := []byte(normalizeLeader(record.Leader))
+		baseAddress := leaderLength + directory.Len()
+		copy(leader[0:5], fmt.Sprintf("%05d", baseAddress+data.Len()))
+		copy(leader[12:17], fmt.Sprintf("%05d", baseAddress))
+
+		if _, err := w.Write(leader); err != nil {
+			return err
+		}
+		if _, err := w.Write(directory.Bytes()); err != nil {
+			return err
+		}
+		if _, err := w.Write(data.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func indicator(s string) string {
+	if s == "" {
+		return " "
+	}
+
+	return s[:1]
+}
+
+func normalizeLeader(leader string) string {
+	if len(leader) != leaderLength {
+		return "00000nam a2200000 a 4500"
+	}
+
+	return leader
+}
+
+type xmlControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlDataField struct {
+	Tag       string     `xml:"tag,attr"`
+	Ind1      string     `xml:"ind1,attr"`
+	Ind2      string     `xml:"ind2,attr"`
+	Subfields []Subfield `xml:"subfield"`
+}
+
+type xmlRecord struct {
+	XMLName       xml.Name          `xml:"record"`
+	Leader        string            `xml:"leader"`
+	ControlFields []xmlControlField `xml:"controlfield"`
+	DataFields    []xmlDataField    `xml:"datafield"`
+}
+
+type xmlCollection struct {
+	XMLName xml.Name    `xml:"collection"`
+	Xmlns   string      `xml:"xmlns,attr,omitempty"`
+	Records []xmlRecord `xml:"record"`
+}
+
+// ReadXML parses a MARCXML document whose root is either a collection or a single record.
+func ReadXML(r io.Reader) ([]Record, error) {
+	decoder := xml.NewDecoder(r)
+	var records []Record
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return records, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "record" {
+			continue
+		}
+
+		var raw xmlRecord
+		if err = decoder.DecodeElement(&raw, &start); err != nil {
+			return nil, err
+		}
+
+		records = append(records, fromXMLRecord(raw))
+	}
+}
+
+func fromXMLRecord(raw xmlRecord) Record {
+	record := Record{Leader: raw.Leader}
+	for _, cf := range raw.ControlFields {
+		record.Fields = append(record.Fields, Field{Tag: cf.Tag, Value: cf.Value})
+	}
+
+	for _, df := range raw.DataFields {
+		record.Fields = append(record.Fields, Field{Tag: df.Tag, Ind1: df.Ind1, Ind2: df.Ind2, Subfields: df.Subfields})
+	}
+
+	return record
+}
+
+// WriteXML encodes the records as a MARCXML collection.
+func WriteXML(w io.Writer, records []Record) error {
+	collection := xmlCollection{Xmlns: Namespace}
+	for _, record := range records {
+		raw := xmlRecord{Leader: normalizeLeader(record.Leader)}
+		for _, f := range record.Fields {
+			if f.IsControl() {
+				raw.ControlFields = append(raw.ControlFields, xmlControlField{Tag: f.Tag, Value: f.Value})
+				continue
+			}
+
+			raw.DataFields = append(raw.DataFields, xmlDataField{Tag: f.Tag, Ind1: indicator(f.Ind1), Ind2: indicator(f.Ind2), Subfields: f.Subfields})
+		}
+
+		collection.Records = append(collection.Records, raw)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return encoder.Encode(collection)
+}
+
+// Read detects whether the data is MARCXML or binary MARC21 and parses it accordingly.
+func Read(r io.Reader) ([]Record, error) {
+	reader := bufio.NewReader(r)
+	for {
+		b, err := reader.Peek(1)
+		if err != nil {
+			if err == io.EOF {
+				return nil, nil
+			}
+
+			return nil, err
+		}
+
+		switch b[0] {
+		case ' ', '\t', '\r', '\n', 0xEF, 0xBB, 0xBF:
+			reader.ReadByte()
+			continue
+		case '<':
+			return ReadXML(reader)
+		default:
+			return ReadBinary(reader)
+		}
+	}
+}
+
+// BookData is the part of a bibliographic record the catalog keeps.
+type BookData struct {
+	ISBN     string   `json:"isbn"`
+	Title    string   `json:"title"`
+	Author   string   `json:"author"`
+	Year     int      `json:"year"`
+	Subjects []string `json:"subjects"`
+}
+
+func trimPunctuation(s string) string {
+	return strings.TrimSpace(strings.TrimRight(strings.TrimSpace(s), " /:;,.="))
+}
+
+// ToBook maps a bibliographic record to the catalog fields.
+func ToBook(r Record) BookData {
+	var book BookData
+	if f, ok := r.Field("245"); ok {
+		book.Title = trimPunctuation(f.Subfield("a"))
+		if subtitle := trimPunctuation(f.Subfield("b")); subtitle != "" {
+			book.Title += ": " + subtitle
+		}
+	}
+
+	for _, tag := range []string{"100", "110", "111"} {
+		if f, ok := r.Field(tag); ok {
+			book.Author = trimPunctuation(f.Subfield("a"))
+			break
+		}
+	}
+
+	if f, ok := r.Field("020"); ok {
+		if parts := strings.Fields(f.Subfield("a")); len(parts) > 0 {
+			book.ISBN = parts[0]
+		}
+	}
+
+	if f, ok := r.Field("008"); ok && len(f.Value) >= 11 {
+		book.Year, _ = strconv.Atoi(f.Value[7:11])
+	}
+
+	if book.Year == 0 {
+		for _, tag := range []string{"264", "260"} {
+			if f, ok := r.Field(tag); ok {
+				book.Year = firstYear(f.Subfield("c"))
+				if book.Year != 0 {
+					break
+				}
+			}
+		}
+	}
+
+	for _, tag := range []string{"600", "610", "650", "651"} {
+		for _, f := range r.FieldsByTag(tag) {
+			if subject := trimPunctuation(f.Subfield("a")); subject != "" {
+				book.Subjects = append(book.Subjects, subject)
+			}
+		}
+	}
+
+	return book
+}
+
+func firstYear(s string) int {
+	digits := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] >= '0' && s[i] <= '9' {
+			digits++
+			if digits == 4 {
+				year, _ := strconv.Atoi(s[i-3 : i+1])
+				return year
+			}
+		} else {
+			digits = 0
+		}
+	}
+
+	return 0
+}
+
+// FromBook builds a minimal bibliographic record for a catalog book.
+func FromBook(id int, book BookData) Record {
+	record := Record{Leader: "00000nam a2200000 a 4500"}
+	record.Fields = append(record.Fields, Field{Tag: "001", Value: strconv.Itoa(id)})
+	if book.Year != 0 {
+		record.Fields = append(record.Fields, Field{Tag: "008", Value: fmt.Sprintf("      s%04d    xx            000 0 eng d", book.Year)})
+	}
+
+	if book.ISBN != "" {
+		record.Fields = append(record.Fields, Field{Tag: "020", Ind1: " ", Ind2: " ", Subfields: []Subfield{{Code: "a", Value: book.ISBN}}})
+	}
+
+	if book.Author != "" {
+		record.Fields = append(record.Fields, Field{Tag: "100", Ind1: "1", Ind2: " ", Subfields: []Subfield{{Code: "a", Value: book.Author}}})
+	}
+
+	titleIndicator := "0"
+	if book.Author != "" {
+		titleIndicator = "1"
+	}
+	record.Fields = append(record.Fields, Field{Tag: "245", Ind1: titleIndicator, Ind2: "0", Subfields: []Subfield{{Code: "a", Value: book.Title}}})
+
+	if book.Year != 0 {
+		record.Fields = append(record.Fields, Field{Tag: "264", Ind1: " ", Ind2: "1", Subfields: []Subfield{{Code: "c", Value: strconv.Itoa(book.Year)}}})
+	}
+
+	for _, subject := range book.Subjects {
+		record.Fields = append(record.Fields, Field{Tag: "650", Ind1: " ", Ind2: "0", Subfields: []Subfield{{Code: "a", Value: subject}}})
+	}
+
+	return record
+}
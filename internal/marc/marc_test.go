@@ -0,0 +1,98 @@
+package marc
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var sample = BookData{
+	ISBN:     "9780306406157",
+	Title:    "Some title",
+	Author:   "Some author",
+	Year:     1990,
+	Subjects: []string{"Libraries", "Cataloging"},
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteBinary(&buf, []Record{FromBook(1, sample), FromBook(2, sample)}); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+
+	if book := ToBook(records[1]); !reflect.DeepEqual(book, sample) {
+		t.Fatalf("%+v", book)
+	}
+}
+
+func TestBinaryNegativeDirectoryEntry(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteBinary(&buf, []Record{FromBook(1, sample)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first directory entry follows the 24 byte leader: a tag, a 4 digit length and a 5 digit start.
+	raw := buf.Bytes()
+	copy(raw[27:36], "0002-0001")
+
+	if _, err := Read(bytes.NewReader(raw)); err == nil {
+		t.Fatal("expected an error for a field with a negative start")
+	}
+
+	copy(raw[27:36], "-00100000")
+	if _, err := Read(bytes.NewReader(raw)); err == nil {
+		t.Fatal("expected an error for a field with a negative length")
+	}
+}
+
+func TestXMLRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteXML(&buf, []Record{FromBook(1, sample)}); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(records))
+	}
+
+	if book := ToBook(records[0]); !reflect.DeepEqual(book, sample) {
+		t.Fatalf("%+v", book)
+	}
+}
+
+func TestReadXMLFromOtherSystems(t *testing.T) {
+	document := `<?xml version="1.0" encoding="UTF-8"?>
+<record xmlns="http://www.loc.gov/MARC21/slim">
+  <leader>01142cam  2200301 a 4500</leader>
+  <datafield tag="020" ind1=" " ind2=" "><subfield code="a">0306406152 (pbk.)</subfield></datafield>
+  <datafield tag="100" ind1="1" ind2=" "><subfield code="a">Sagan, Carl,</subfield></datafield>
+  <datafield tag="245" ind1="1" ind2="0"><subfield code="a">Cosmos /</subfield><subfield code="c">Carl Sagan.</subfield></datafield>
+  <datafield tag="260" ind1=" " ind2=" "><subfield code="c">c1980.</subfield></datafield>
+  <datafield tag="650" ind1=" " ind2="0"><subfield code="a">Astronomy.</subfield></datafield>
+</record>`
+
+	records, err := Read(strings.NewReader(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := BookData{ISBN: "0306406152", Title: "Cosmos", Author: "Sagan, Carl", Year: 1980, Subjects: []string{"Astronomy"}}
+	if book := ToBook(records[0]); !reflect.DeepEqual(book, want) {
+		t.Fatalf("%+v", book)
+	}
+}
@@ -0,0 +1,196 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Phantomvv1/Library_management/internal/isbn"
+)
+
+var ErrNotFound = errors.New("Error no bibliographic record was found for this ISBN")
+
+type Metadata struct {
+	ISBN      string   `json:"isbn"`
+	Title     string   `json:"title"`
+	Authors   []string `json:"authors"`
+	Year      int      `json:"year"`
+	Pages     int      `json:"pages"`
+	Publisher string   `json:"publisher"`
+	CoverURL  string   `json:"coverURL"`
+}
+
+// MetadataProvider looks up the bibliographic details of a book by its ISBN.
+type MetadataProvider interface {
+	Lookup(ctx context.Context, isbn string) (Metadata, error)
+}
+
+// FromEnv picks the provider from METADATA_PROVIDER ("openlibrary" by default or "local"),
+// the local provider reads its fixtures from METADATA_FIXTURES.
+func FromEnv() (MetadataProvider, error) {
+	switch os.Getenv("METADATA_PROVIDER") {
+	case "", "openlibrary":
+		return NewOpenLibrary(os.Getenv("OPENLIBRARY_URL")), nil
+	case "local":
+		return NewLocal(os.Getenv("METADATA_FIXTURES"))
+	default:
+		return nil, fmt.Errorf("Error unknown metadata provider %q", os.Getenv("METADATA_PROVIDER"))
+	}
+}
+
+type OpenLibrary struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+func NewOpenLibrary(baseURL string) *OpenLibrary {
+	if baseURL == "" {
+		baseURL = "https://openlibrary.org"
+	}
+
+	return &OpenLibrary{BaseURL: baseURL, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+type openLibraryNamed struct {
+	Name string `json:"name"`
+}
+
+type openLibraryBook struct {
+	Title         string             `json:"title"`
+	Subtitle      string             `json:"subtitle"`
+	Authors       []openLibraryNamed `json:"authors"`
+	Publishers    []openLibraryNamed `json:"publishers"`
+	PublishDate   string             `json:"publish_date"`
+	NumberOfPages int                `json:"number_of_pages"`
+	Cover         map[string]string  `json:"cover"`
+}
+
+func (o *OpenLibrary) Lookup(ctx context.Context, isbnString string) (Metadata, error) {
+	canonical, err := isbn.Canonical(isbnString)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	key := "ISBN:" + canonical
+	query := url.Values{"bibkeys": {key}, "format": {"json"}, "jscmd": {"data"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.BaseURL+"/api/books?"+query.Encode(), nil)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	resp, err := o.Client.Do(req)
+	if err != nil {
+		return Metadata{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Metadata{}, fmt.Errorf("Error Open Library responded with %s", resp.Status)
+	}
+
+	var result map[string]openLibraryBook
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Metadata{}, err
+	}
+
+	book, ok := result[key]
+	if !ok {
+		return Metadata{}, ErrNotFound
+	}
+
+	metadata := Metadata{
+		ISBN:     canonical,
+		Title:    book.Title,
+		Year:     findYear(book.PublishDate),
+		Pages:    book.NumberOfPages,
+		CoverURL: book.Cover["large"],
+	}
+
+	if book.Subtitle != "" {
+		metadata.Title += ": " + book.Subtitle
+	}
+
+	for _, author := range book.Authors {
+		metadata.Authors = append(metadata.Authors, author.Name)
+	}
+
+	if len(book.Publishers) > 0 {
+		metadata.Publisher = book.Publishers[0].Name
+	}
+
+	return metadata, nil
+}
+
+// findYear finds the year in free form dates such as "1980", "March 1980" or "1980-03-01".
+func findYear(date string) int {
+	for i := 0; i+4 <= len(date); i++ {
+		year, err := strconv.Atoi(date[i : i+4])
+		if err == nil && year > 0 {
+			return year
+		}
+	}
+
+	return 0
+}
+
+// Local answers lookups from a JSON file containing an array of Metadata, useful for tests and offline installations.
+type Local struct {
+	books map[string]Metadata
+}
+
+func NewLocal(path string) (*Local, error) {
+	local := &Local{books: make(map[string]Metadata)}
+	if path == "" {
+		return local, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var fixtures []Metadata
+	if err = json.NewDecoder(file).Decode(&fixtures); err != nil {
+		return nil, err
+	}
+
+	for _, fixture := range fixtures {
+		if err = local.Add(fixture); err != nil {
+			return nil, err
+		}
+	}
+
+	return local, nil
+}
+
+func (l *Local) Add(metadata Metadata) error {
+	canonical, err := isbn.Canonical(metadata.ISBN)
+	if err != nil {
+		return err
+	}
+
+	metadata.ISBN = canonical
+	l.books[canonical] = metadata
+	return nil
+}
+
+func (l *Local) Lookup(ctx context.Context, isbnString string) (Metadata, error) {
+	canonical, err := isbn.Canonical(isbnString)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	metadata, ok := l.books[canonical]
+	if !ok {
+		return Metadata{}, ErrNotFound
+	}
+
+	return metadata, nil
+}
@@ -0,0 +1,74 @@
+package metadata
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestOpenLibraryLookup(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/books" || r.URL.Query().Get("bibkeys") != "ISBN:9780306406157" {
+			w.Write([]byte(`{}`))
+			return
+		}
+
+		w.Write([]byte(`{"ISBN:9780306406157": {"title": "Cosmos", "authors": [{"name": "Carl Sagan"}],
+			"publishers": [{"name": "Random House"}], "publish_date": "October 1980", "number_of_pages": 365,
+			"cover": {"small": "https://covers.example/s.jpg", "large": "https://covers.example/l.jpg"}}}`))
+	}))
+	defer server.Close()
+
+	provider := NewOpenLibrary(server.URL)
+	metadata, err := provider.Lookup(context.Background(), "0-306-40615-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Metadata{
+		ISBN:      "9780306406157",
+		Title:     "Cosmos",
+		Authors:   []string{"Carl Sagan"},
+		Year:      1980,
+		Pages:     365,
+		Publisher: "Random House",
+		CoverURL:  "https://covers.example/l.jpg",
+	}
+	if !reflect.DeepEqual(metadata, want) {
+		t.Fatalf("%+v", metadata)
+	}
+
+	if _, err = provider.Lookup(context.Background(), "978-3-16-148410-0"); err != ErrNotFound {
+		t.Fatal(err)
+	}
+}
+
+func TestLocalLookup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixtures.json")
+	err := os.WriteFile(path, []byte(`[{"isbn": "978-3-16-148410-0", "title": "Some title", "authors": ["Some author"], "year": 1990}]`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider, err := NewLocal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metadata, err := provider.Lookup(context.Background(), "9783161484100")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if metadata.Title != "Some title" || metadata.Year != 1990 {
+		t.Fatalf("%+v", metadata)
+	}
+
+	if _, err = provider.Lookup(context.Background(), "0-306-40615-2"); err != ErrNotFound {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,61 @@
+package missing
+
+import "errors"
+
+// A loan goes missing when the patron lost the book or says they returned it but nobody can find it.
+// A missing loan stops accruing fines and is found again when the book turns up.
+const (
+	StatusLost    = "lost"
+	StatusClaimed = "claimed returned"
+	StatusFound   = "found"
+)
+
+// The statuses of the copy of a missing loan. They differ from the "missing" of stocktakes, a copy
+// of a missing loan is still on loan and only comes back through the loan being found.
+const (
+	CopyLost    = "lost"
+	CopyClaimed = "claimed returned"
+)
+
+var (
+	ErrInvalidStatus  = errors.New("Error a loan can only be marked lost, claimed returned or found")
+	ErrNotOutstanding = errors.New("Error only a book that is still out can be marked lost or claimed returned")
+	ErrNotMissing     = errors.New("Error only a lost book or one claimed returned can be found")
+)
+
+// Missing reports whether a loan with the status is lost or claimed returned.
+func Missing(status string) bool {
+	return status == StatusLost || status == StatusClaimed
+}
+
+// Mark checks that a loan with the status from (empty while it is out as usual) can be marked as to.
+// A book claimed returned that can't be found can still be marked lost.
+func Mark(from, to string) error {
+	switch to {
+	case StatusLost:
+		if from != "" && from != StatusClaimed {
+			return ErrNotOutstanding
+		}
+	case StatusClaimed:
+		if from != "" {
+			return ErrNotOutstanding
+		}
+	case StatusFound:
+		if !Missing(from) {
+			return ErrNotMissing
+		}
+	default:
+		return ErrInvalidStatus
+	}
+
+	return nil
+}
+
+// CopyStatus returns the status of the copy of a loan marked as status.
+func CopyStatus(status string) string {
+	if status == StatusLost {
+		return CopyLost
+	}
+
+	return CopyClaimed
+}
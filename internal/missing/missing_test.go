@@ -0,0 +1,37 @@
+package missing
+
+import "testing"
+
+func TestMark(t *testing.T) {
+	tests := []struct {
+		from, to string
+		err      error
+	}{
+		{"", StatusLost, nil},
+		{"", StatusClaimed, nil},
+		{StatusClaimed, StatusLost, nil},
+		{StatusLost, StatusFound, nil},
+		{StatusClaimed, StatusFound, nil},
+		{StatusLost, StatusClaimed, ErrNotOutstanding},
+		{StatusFound, StatusLost, ErrNotOutstanding},
+		{"", StatusFound, ErrNotMissing},
+		{StatusFound, StatusFound, ErrNotMissing},
+		{"", "stolen", ErrInvalidStatus},
+	}
+
+	for _, test := range tests {
+		if err := Mark(test.from, test.to); err != test.err {
+			t.Fatalf("Mark(%q, %q) = %v, want %v", test.from, test.to, err, test.err)
+		}
+	}
+}
+
+func TestCopyStatus(t *testing.T) {
+	if status := CopyStatus(StatusLost); status != CopyLost {
+		t.Fatalf("unexpected status %q for a lost loan", status)
+	}
+
+	if status := CopyStatus(StatusClaimed); status != CopyClaimed {
+		t.Fatalf("unexpected status %q for a loan claimed returned", status)
+	}
+}
@@ -0,0 +1,130 @@
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	. "github.com/Phantomvv1/Library_management/internal/authentication"
+	"github.com/Phantomvv1/Library_management/internal/ledger"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// Notification is a message the library left for a patron, like a recall of a book they borrowed.
+type Notification struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"userID"`
+	Subject   string     `json:"subject"`
+	Message   string     `json:"message"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ReadAt    *time.Time `json:"readAt"`
+}
+
+const notificationColumns = "id, user_id, subject, message, created_at, read_at"
+
+func (n *Notification) fields() []interface{} {
+	return []interface{}{&n.ID, &n.UserID, &n.Subject, &n.Message, &n.CreatedAt, &n.ReadAt}
+}
+
+func CreateNotificationsTable(db ledger.DB) error {
+	_, err := db.Exec(context.Background(), "create table if not exists notifications (id serial primary key, user_id int not null references authentication(id) on delete cascade, "+
+		"subject text not null, message text not null, created_at timestamp not null default current_timestamp, read_at timestamp);")
+	if err != nil {
+		log.Println(err)
+		return errors.New("Couldn't create a table for the notifications")
+	}
+
+	_, err = db.Exec(context.Background(), "create index if not exists notifications_user_id on notifications (user_id, created_at);")
+	if err != nil {
+		log.Println(err)
+		return errors.New("Couldn't create a table for the notifications")
+	}
+
+	return nil
+}
+
+// Notify leaves the message for the user, they see it the next time they ask for their notifications.
+func Notify(db ledger.DB, userID int, subject, message string) (Notification, error) {
+	notification := Notification{UserID: userID, Subject: subject, Message: message}
+	err := db.QueryRow(context.Background(), "insert into notifications (user_id, subject, message) values ($1, $2, $3) returning id, created_at",
+		userID, subject, message).Scan(&notification.ID, &notification.CreatedAt)
+	if err != nil {
+		log.Println(err)
+		return Notification{}, errors.New("Error notifying the user")
+	}
+
+	return notification, nil
+}
+
+// GetNotifications returns the notifications of the caller, the newest first, and marks them as read.
+func GetNotifications(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token
+
+	token, _ := information["token"].(string)
+	userID, _, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = CreateAuthTable(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err = CreateNotificationsTable(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := conn.Query(context.Background(), "select "+notificationColumns+" from notifications where user_id = $1 order by created_at desc, id desc", userID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the notifications"})
+		return
+	}
+
+	notifications := []Notification{}
+	for rows.Next() {
+		var notification Notification
+		if err = rows.Scan(notification.fields()...); err != nil {
+			rows.Close()
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error working with the notifications"})
+			return
+		}
+
+		notifications = append(notifications, notification)
+	}
+	rows.Close()
+
+	if rows.Err() != nil {
+		log.Println(rows.Err())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error working with the notifications"})
+		return
+	}
+
+	_, err = conn.Exec(context.Background(), "update notifications set read_at = current_timestamp where user_id = $1 and read_at is null", userID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error marking the notifications as read"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"notifications": notifications})
+}
@@ -0,0 +1,56 @@
+package notifications
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Phantomvv1/Library_management/internal/authentication"
+	"github.com/gin-gonic/gin"
+)
+
+var Token = ""
+
+func TestGetNotifications(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/notifications", GetNotifications)
+	router.POST("/login", authentication.LogIn)
+
+	rrLogin := httptest.NewRecorder()
+
+	jsonBody := []byte(`{"email": "kris@kris.com", "password": "passowrd"}`)
+	reqL, err := http.NewRequest(http.MethodPost, "http://localhost:42069/login", bytes.NewReader(jsonBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rrLogin.Result().Body.Close()
+
+	router.ServeHTTP(rrLogin, reqL)
+
+	if rrLogin.Code != http.StatusOK {
+		t.Fatal(rrLogin.Body)
+	}
+
+	var token map[string]string
+	json.NewDecoder(rrLogin.Body).Decode(&token)
+	Token = token["token"]
+
+	rr := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"token": "%s"}`, Token))
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/notifications", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+}
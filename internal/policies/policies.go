@@ -0,0 +1,260 @@
+package policies
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	. "github.com/Phantomvv1/Library_management/internal/authentication"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// DB is what the policies need from a connection, both *pgx.Conn and pgx.Tx satisfy it.
+type DB interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+const policyColumns = "id, patron_type, item_category, loan_days, max_loans, max_renewals, renewal_days, fine_per_day, max_fine, grace_days, replacement_cost, guaranteed_days, recall_queue, updated_at"
+
+func (p *Policy) fields() []interface{} {
+	return []interface{}{&p.ID, &p.PatronType, &p.ItemCategory, &p.LoanDays, &p.MaxLoans, &p.MaxRenewals, &p.RenewalDays, &p.FinePerDay, &p.MaxFine, &p.GraceDays, &p.ReplacementCost,
+		&p.GuaranteedDays, &p.RecallQueue, &p.UpdatedAt}
+}
+
+func CreatePoliciesTable(db DB) error {
+	_, err := db.Exec(context.Background(), "create table if not exists loan_policies (id serial primary key, patron_type text not null, item_category text not null, "+
+		"loan_days int not null, max_loans int not null, max_renewals int not null, renewal_days int not null, "+
+		"updated_at timestamp not null default current_timestamp, unique (patron_type, item_category));")
+	if err != nil {
+		log.Println(err)
+		return errors.New("Couldn't create a table for the loan policies")
+	}
+
+	_, err = db.Exec(context.Background(), "alter table loan_policies add column if not exists fine_per_day numeric(10, 2) not null default 0.25, "+
+		"add column if not exists max_fine numeric(10, 2) not null default 10, add column if not exists grace_days int not null default 1, "+
+		"add column if not exists replacement_cost numeric(10, 2) not null default 25, add column if not exists guaranteed_days int not null default 14, "+
+		"add column if not exists recall_queue int not null default 0;")
+	if err != nil {
+		log.Println(err)
+		return errors.New("Couldn't create a table for the loan policies")
+	}
+
+	return nil
+}
+
+// Load returns every loan policy.
+func Load(db DB) ([]Policy, error) {
+	rows, err := db.Query(context.Background(), "select "+policyColumns+" from loan_policies order by patron_type, item_category")
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("Error getting the loan policies")
+	}
+	defer rows.Close()
+
+	policies := []Policy{}
+	for rows.Next() {
+		var policy Policy
+		if err = rows.Scan(policy.fields()...); err != nil {
+			log.Println(err)
+			return nil, errors.New("Error working with the loan policies")
+		}
+
+		policies = append(policies, policy)
+	}
+
+	if rows.Err() != nil {
+		log.Println(rows.Err())
+		return nil, errors.New("Error working with the loan policies")
+	}
+
+	return policies, nil
+}
+
+// For returns the policy for a patron type borrowing an item of the category.
+func For(db DB, patronType, itemCategory string) (Policy, error) {
+	policies, err := Load(db)
+	if err != nil {
+		return Policy{}, err
+	}
+
+	return Match(policies, patronType, itemCategory), nil
+}
+
+func GetPolicies(c *gin.Context) {
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = CreatePoliciesTable(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	policies, err := Load(conn)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"policies": policies, "default": Default})
+}
+
+// SavePolicy creates the policy for a patron type and an item category or replaces the one there is.
+func SavePolicy(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && patronType && itemCategory && loanDays && maxLoans && maxRenewals && renewalDays &&
+	// finePerDay (optional) && maxFine (optional) && graceDays (optional) && replacementCost (optional) && guaranteedDays (optional) && recallQueue (optional)
+
+	token, _ := information["token"].(string)
+	_, accountType, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return
+	}
+
+	if accountType != "librarian" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error only librarians can change the loan policies"})
+		return
+	}
+
+	policy := Policy{}
+	policy.PatronType, _ = information["patronType"].(string)
+	policy.ItemCategory, _ = information["itemCategory"].(string)
+	policy.PatronType, policy.ItemCategory = strings.TrimSpace(policy.PatronType), strings.TrimSpace(policy.ItemCategory)
+
+	limits := map[string]*int{"loanDays": &policy.LoanDays, "maxLoans": &policy.MaxLoans, "maxRenewals": &policy.MaxRenewals, "renewalDays": &policy.RenewalDays}
+	for name, limit := range limits {
+		value, ok := information[name].(float64)
+		if !ok || value != float64(int(value)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Error " + name + " has to be a whole number"})
+			return
+		}
+		*limit = int(value)
+	}
+
+	policy.FinePerDay, policy.MaxFine, policy.GraceDays, policy.ReplacementCost = Default.FinePerDay, Default.MaxFine, Default.GraceDays, Default.ReplacementCost
+	if value, ok := information["finePerDay"].(float64); ok {
+		policy.FinePerDay = value
+	}
+
+	if value, ok := information["maxFine"].(float64); ok {
+		policy.MaxFine = value
+	}
+
+	if value, ok := information["replacementCost"].(float64); ok {
+		policy.ReplacementCost = value
+	}
+
+	policy.GuaranteedDays, policy.RecallQueue = Default.GuaranteedDays, Default.RecallQueue
+	optional := map[string]*int{"graceDays": &policy.GraceDays, "guaranteedDays": &policy.GuaranteedDays, "recallQueue": &policy.RecallQueue}
+	for name, limit := range optional {
+		value, ok := information[name]
+		if !ok {
+			continue
+		}
+
+		number, ok := value.(float64)
+		if !ok || number != float64(int(number)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Error " + name + " has to be a whole number"})
+			return
+		}
+		*limit = int(number)
+	}
+
+	if err = policy.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = CreatePoliciesTable(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = conn.QueryRow(context.Background(), "insert into loan_policies (patron_type, item_category, loan_days, max_loans, max_renewals, renewal_days, fine_per_day, max_fine, grace_days, "+
+		"replacement_cost, guaranteed_days, recall_queue) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) on conflict (patron_type, item_category) do update set loan_days = excluded.loan_days, max_loans = excluded.max_loans, "+
+		"max_renewals = excluded.max_renewals, renewal_days = excluded.renewal_days, fine_per_day = excluded.fine_per_day, max_fine = excluded.max_fine, "+
+		"grace_days = excluded.grace_days, replacement_cost = excluded.replacement_cost, "+
+		"guaranteed_days = excluded.guaranteed_days, recall_queue = excluded.recall_queue, updated_at = current_timestamp returning "+policyColumns,
+		policy.PatronType, policy.ItemCategory, policy.LoanDays, policy.MaxLoans, policy.MaxRenewals, policy.RenewalDays,
+		policy.FinePerDay, policy.MaxFine, policy.GraceDays, policy.ReplacementCost, policy.GuaranteedDays, policy.RecallQueue).Scan(policy.fields()...)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving the loan policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"policy": policy})
+}
+
+func DeletePolicy(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && id
+
+	token, _ := information["token"].(string)
+	_, accountType, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return
+	}
+
+	if accountType != "librarian" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error only librarians can change the loan policies"})
+		return
+	}
+
+	id, ok := information["id"].(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided id of the policy"})
+		return
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = CreatePoliciesTable(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := conn.Exec(context.Background(), "delete from loan_policies where id = $1", int(id))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting the loan policy"})
+		return
+	}
+
+	if result.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Error there is no such loan policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
@@ -0,0 +1,198 @@
+package policies
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Phantomvv1/Library_management/internal/authentication"
+	"github.com/gin-gonic/gin"
+)
+
+func TestMatch(t *testing.T) {
+	policies := []Policy{
+		{ID: 1, PatronType: Any, ItemCategory: "dvd", LoanDays: 7, MaxLoans: 3, RenewalDays: 7},
+		{ID: 2, PatronType: "child", ItemCategory: Any, LoanDays: 14, MaxLoans: 4, RenewalDays: 7},
+		{ID: 3, PatronType: "child", ItemCategory: "dvd", LoanDays: 3, MaxLoans: 1, RenewalDays: 3},
+	}
+
+	tests := []struct {
+		patronType, itemCategory string
+		want                     int
+	}{
+		{"child", "dvd", 3},
+		{"child", "standard", 2},
+		{"adult", "dvd", 1},
+		{"adult", "standard", 0},
+	}
+
+	for _, test := range tests {
+		if got := Match(policies, test.patronType, test.itemCategory); got.ID != test.want {
+			t.Fatalf("Match(%q, %q) chose the policy %d, want %d", test.patronType, test.itemCategory, got.ID, test.want)
+		}
+	}
+
+	if got := Match(nil, "adult", "standard"); got != Default {
+		t.Fatalf("expected the default policy, got %+v", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := Policy{PatronType: "teen", ItemCategory: "reference", LoanDays: 1, MaxLoans: 1, RenewalDays: 1}
+	if err := valid.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := []Policy{
+		{PatronType: "pirate", ItemCategory: Any, LoanDays: 1, MaxLoans: 1, RenewalDays: 1},
+		{PatronType: Any, ItemCategory: "Big Books", LoanDays: 1, MaxLoans: 1, RenewalDays: 1},
+		{PatronType: Any, ItemCategory: Any, LoanDays: 0, MaxLoans: 1, RenewalDays: 1},
+		{PatronType: Any, ItemCategory: Any, LoanDays: 1, MaxLoans: 1, RenewalDays: 1, MaxRenewals: -1},
+		{PatronType: Any, ItemCategory: Any, LoanDays: 1, MaxLoans: 1, RenewalDays: 1, FinePerDay: -0.1},
+		{PatronType: Any, ItemCategory: Any, LoanDays: 1, MaxLoans: 1, RenewalDays: 1, ReplacementCost: -5},
+		{PatronType: Any, ItemCategory: Any, LoanDays: 1, MaxLoans: 1, RenewalDays: 1, RecallQueue: -1},
+	}
+
+	for _, policy := range invalid {
+		if err := policy.Validate(); err == nil {
+			t.Fatalf("expected %+v to be invalid", policy)
+		}
+	}
+}
+
+func TestDueDate(t *testing.T) {
+	policy := Policy{LoanDays: 21}
+	from := time.Date(2025, time.December, 20, 15, 30, 0, 0, time.UTC)
+	if due := policy.DueDate(from); !due.Equal(time.Date(2026, time.January, 10, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected due date %v", due)
+	}
+}
+
+func TestRenewal(t *testing.T) {
+	policy := Policy{MaxRenewals: 2, RenewalDays: 14}
+	if !policy.CanRenew(1) || policy.CanRenew(2) {
+		t.Fatal("expected a loan to be renewable twice")
+	}
+
+	now := time.Date(2025, time.March, 10, 12, 0, 0, 0, time.UTC)
+	due := time.Date(2025, time.March, 15, 0, 0, 0, 0, time.UTC)
+	if renewed := policy.RenewedDueDate(due, now); !renewed.Equal(time.Date(2025, time.March, 29, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the loan to be extended from its due date, got %v", renewed)
+	}
+
+	overdue := time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC)
+	if renewed := policy.RenewedDueDate(overdue, now); !renewed.Equal(time.Date(2025, time.March, 24, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected an overdue loan to be extended from today, got %v", renewed)
+	}
+}
+
+func TestFine(t *testing.T) {
+	policy := Policy{FinePerDay: 0.5, MaxFine: 3, GraceDays: 2}
+	due := time.Date(2025, time.March, 10, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		on   time.Time
+		want float64
+	}{
+		{time.Date(2025, time.March, 9, 18, 0, 0, 0, time.UTC), 0},
+		{time.Date(2025, time.March, 12, 23, 0, 0, 0, time.UTC), 0},
+		{time.Date(2025, time.March, 13, 8, 0, 0, 0, time.UTC), 0.5},
+		{time.Date(2025, time.March, 16, 8, 0, 0, 0, time.UTC), 2},
+		{time.Date(2025, time.April, 30, 8, 0, 0, 0, time.UTC), 3},
+	}
+
+	for _, test := range tests {
+		if got := policy.Fine(due, test.on); got != test.want {
+			t.Fatalf("Fine on %v = %v, want %v", test.on, got, test.want)
+		}
+	}
+}
+
+func TestRecalledDueDate(t *testing.T) {
+	policy := Policy{GuaranteedDays: 14}
+	borrowed := time.Date(2025, time.March, 1, 15, 0, 0, 0, time.UTC)
+	due := time.Date(2025, time.April, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		now      time.Time
+		want     time.Time
+		recalled bool
+	}{
+		{time.Date(2025, time.March, 3, 9, 0, 0, 0, time.UTC), time.Date(2025, time.March, 15, 0, 0, 0, 0, time.UTC), true},
+		{time.Date(2025, time.March, 20, 9, 0, 0, 0, time.UTC), time.Date(2025, time.March, 23, 0, 0, 0, 0, time.UTC), true},
+		{time.Date(2025, time.March, 29, 9, 0, 0, 0, time.UTC), due, false},
+	}
+
+	for _, test := range tests {
+		got, recalled := policy.RecalledDueDate(borrowed, due, test.now)
+		if !got.Equal(test.want) || recalled != test.recalled {
+			t.Fatalf("RecalledDueDate on %v = %v %v, want %v %v", test.now, got, recalled, test.want, test.recalled)
+		}
+	}
+}
+
+var Token = ""
+
+func TestSavePolicy(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/policy", SavePolicy)
+	router.POST("/login", authentication.LogIn)
+
+	rrLogin := httptest.NewRecorder()
+
+	jsonBody := []byte(`{"email": "kris@kris.com", "password": "passowrd"}`)
+	reqL, err := http.NewRequest(http.MethodPost, "http://localhost:42069/login", bytes.NewReader(jsonBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rrLogin.Result().Body.Close()
+
+	router.ServeHTTP(rrLogin, reqL)
+
+	if rrLogin.Code != http.StatusOK {
+		t.Fatal(rrLogin.Body)
+	}
+
+	var token map[string]string
+	json.NewDecoder(rrLogin.Body).Decode(&token)
+	Token = token["token"]
+
+	rr := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"patronType": "child", "itemCategory": "*", "loanDays": 14, "maxLoans": 4, "maxRenewals": 1, "renewalDays": 7, "token": "%s"}`, Token))
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/policy", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+}
+
+func TestGetPolicies(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.GET("/policies", GetPolicies)
+
+	rr := httptest.NewRecorder()
+
+	req, err := http.NewRequest(http.MethodGet, "http://localhost:42069/policies", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+}
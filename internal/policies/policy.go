@@ -0,0 +1,183 @@
+package policies
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"time"
+)
+
+// Any matches every patron type or item category.
+const Any = "*"
+
+const (
+	PatronStaff = "staff"
+	ItemDefault = "standard"
+)
+
+// RecallNoticeDays is the least time a borrower gets to bring back a recalled book.
+const RecallNoticeDays = 3
+
+var (
+	ErrInvalidPatronType   = errors.New("Error the patron type has to be staff, child, teen, adult or *")
+	ErrInvalidItemCategory = errors.New("Error the item category has to be a lowercase word like standard, reference or dvd, or *")
+	ErrInvalidLimits       = errors.New("Error the loan days, renewal days and the maximum number of loans have to be positive and the number of renewals can't be negative")
+	ErrInvalidFines        = errors.New("Error the fine per day, the maximum fine, the grace days and the replacement cost can't be negative")
+	ErrInvalidRecalls      = errors.New("Error the guaranteed days and the length of the queue that recalls the loans can't be negative")
+)
+
+var PatronTypes = []string{PatronStaff, "child", "teen", "adult"}
+
+var itemCategoryPattern = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// Policy holds the lending rules for a type of patron borrowing a category of items. A recalled loan is kept for
+// at least GuaranteedDays and loans are recalled on their own once RecallQueue patrons wait for the book, with 0 never.
+type Policy struct {
+	ID              int       `json:"id"`
+	PatronType      string    `json:"patronType"`
+	ItemCategory    string    `json:"itemCategory"`
+	LoanDays        int       `json:"loanDays"`
+	MaxLoans        int       `json:"maxLoans"`
+	MaxRenewals     int       `json:"maxRenewals"`
+	RenewalDays     int       `json:"renewalDays"`
+	FinePerDay      float64   `json:"finePerDay"`
+	MaxFine         float64   `json:"maxFine"`
+	GraceDays       int       `json:"graceDays"`
+	ReplacementCost float64   `json:"replacementCost"`
+	GuaranteedDays  int       `json:"guaranteedDays"`
+	RecallQueue     int       `json:"recallQueue"`
+	UpdatedAt       time.Time `json:"updatedAt"`
+}
+
+// Default is used when no policy matches the patron and the item.
+var Default = Policy{PatronType: Any, ItemCategory: Any, LoanDays: 21, MaxLoans: 5, MaxRenewals: 2, RenewalDays: 14, FinePerDay: 0.25, MaxFine: 10, GraceDays: 1,
+	ReplacementCost: 25, GuaranteedDays: 14}
+
+// PatronType returns the type of patron the policies are chosen by, librarians borrow as staff and everybody else by their category.
+func PatronType(accountType, category string) string {
+	if accountType == "librarian" {
+		return PatronStaff
+	}
+
+	return category
+}
+
+func ValidItemCategory(category string) bool {
+	return itemCategoryPattern.MatchString(category)
+}
+
+// Validate checks the keys and the limits of the policy.
+func (p Policy) Validate() error {
+	validPatron := p.PatronType == Any
+	for _, patronType := range PatronTypes {
+		validPatron = validPatron || p.PatronType == patronType
+	}
+
+	if !validPatron {
+		return ErrInvalidPatronType
+	}
+
+	if p.ItemCategory != Any && !ValidItemCategory(p.ItemCategory) {
+		return ErrInvalidItemCategory
+	}
+
+	if p.LoanDays < 1 || p.MaxLoans < 1 || p.RenewalDays < 1 || p.MaxRenewals < 0 {
+		return ErrInvalidLimits
+	}
+
+	if p.FinePerDay < 0 || p.MaxFine < 0 || p.GraceDays < 0 || p.ReplacementCost < 0 {
+		return ErrInvalidFines
+	}
+
+	if p.GuaranteedDays < 0 || p.RecallQueue < 0 {
+		return ErrInvalidRecalls
+	}
+
+	return nil
+}
+
+// specificity ranks how closely a policy matches, an exact patron type counts more than an exact item category.
+func (p Policy) specificity() int {
+	rank := 0
+	if p.PatronType != Any {
+		rank += 2
+	}
+
+	if p.ItemCategory != Any {
+		rank++
+	}
+
+	return rank
+}
+
+// Match returns the most specific policy for the patron type and the item category, or Default when none of them applies.
+func Match(policies []Policy, patronType, itemCategory string) Policy {
+	best, found := Default, false
+	for _, policy := range policies {
+		if (policy.PatronType != Any && policy.PatronType != patronType) || (policy.ItemCategory != Any && policy.ItemCategory != itemCategory) {
+			continue
+		}
+
+		if !found || policy.specificity() > best.specificity() {
+			best, found = policy, true
+		}
+	}
+
+	return best
+}
+
+// DueDate returns the day a loan starting on from has to be returned.
+func (p Policy) DueDate(from time.Time) time.Time {
+	year, month, day := from.Date()
+	return time.Date(year, month, day+p.LoanDays, 0, 0, 0, 0, time.UTC)
+}
+
+// CanRenew reports whether a loan renewed renewals times can be renewed once more.
+func (p Policy) CanRenew(renewals int) bool {
+	return renewals < p.MaxRenewals
+}
+
+// RenewedDueDate returns the due date of a loan after a renewal on now, an overdue loan is renewed from now.
+func (p Policy) RenewedDueDate(due, now time.Time) time.Time {
+	year, month, day := now.Date()
+	today := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	if due.Before(today) {
+		due = today
+	}
+
+	return due.AddDate(0, 0, p.RenewalDays)
+}
+
+// Fine returns how much a loan due on due owes on the day on, nothing is charged for the grace days and the fine never goes over MaxFine.
+func (p Policy) Fine(due, on time.Time) float64 {
+	year, month, day := due.Date()
+	due = time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	year, month, day = on.Date()
+	on = time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+
+	days := int(on.Sub(due).Hours()/24) - p.GraceDays
+	if days <= 0 {
+		return 0
+	}
+
+	return math.Min(math.Round(float64(days)*p.FinePerDay*100)/100, p.MaxFine)
+}
+
+// RecalledDueDate returns the due date of a loan borrowed on borrowed and due on due after a recall on now, the borrower keeps the book
+// for the guaranteed days and gets RecallNoticeDays to bring it back. It reports false when the recall wouldn't bring the due date forward.
+func (p Policy) RecalledDueDate(borrowed, due, now time.Time) (time.Time, bool) {
+	year, month, day := borrowed.Date()
+	recalled := time.Date(year, month, day+p.GuaranteedDays, 0, 0, 0, 0, time.UTC)
+
+	year, month, day = now.Date()
+	if notice := time.Date(year, month, day+RecallNoticeDays, 0, 0, 0, 0, time.UTC); notice.After(recalled) {
+		recalled = notice
+	}
+
+	year, month, day = due.Date()
+	if !recalled.Before(time.Date(year, month, day, 0, 0, 0, 0, time.UTC)) {
+		return due, false
+	}
+
+	return recalled, true
+}
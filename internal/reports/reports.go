@@ -0,0 +1,330 @@
+package reports
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	. "github.com/Phantomvv1/Library_management/internal/authentication"
+	. "github.com/Phantomvv1/Library_management/internal/books"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// UnborrowedTitle is a book nobody borrowed since a given date, a candidate for weeding.
+type UnborrowedTitle struct {
+	BookID       int        `json:"bookID"`
+	ISBN         string     `json:"isbn"`
+	Title        string     `json:"title"`
+	Author       string     `json:"author"`
+	Quantity     int        `json:"quantity"`
+	LastBorrowed *time.Time `json:"lastBorrowed"`
+}
+
+// DemandTitle is a book with more reservations waiting than copies owned, a candidate for buying more copies.
+type DemandTitle struct {
+	BookID       int    `json:"bookID"`
+	ISBN         string `json:"isbn"`
+	Title        string `json:"title"`
+	Author       string `json:"author"`
+	Copies       int    `json:"copies"`
+	Reservations int    `json:"reservations"`
+}
+
+type LoanDuration struct {
+	BookID      int     `json:"bookID"`
+	ISBN        string  `json:"isbn"`
+	Title       string  `json:"title"`
+	Loans       int     `json:"loans"`
+	AverageDays float64 `json:"averageDays"`
+}
+
+type CopyCondition struct {
+	CopyID    int    `json:"copyID"`
+	BookID    int    `json:"bookID"`
+	Title     string `json:"title"`
+	Barcode   string `json:"barcode"`
+	Shelf     string `json:"shelf"`
+	Condition string `json:"condition"`
+}
+
+// UnborrowedTitles returns the books that weren't borrowed since the date, the ones never borrowed come first. A book whose
+// only loans are from before the dates were kept isn't listed, nobody knows when it was last borrowed.
+func UnborrowedTitles(db Querier, since time.Time) ([]UnborrowedTitle, error) {
+	rows, err := db.Query(context.Background(), "select b.id, b.isbn, b.title, b.author, b.quantity, max(bb.borrowed_at) from books b "+
+		"left join borrowed_books bb on bb.book_id = b.id and not bb.migrated group by b.id having count(bb.id) = 0 or max(bb.borrowed_at) < $1 "+
+		"order by max(bb.borrowed_at) asc nulls first, b.title", since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	titles := []UnborrowedTitle{}
+	for rows.Next() {
+		var title UnborrowedTitle
+		if err = rows.Scan(&title.BookID, &title.ISBN, &title.Title, &title.Author, &title.Quantity, &title.LastBorrowed); err != nil {
+			return nil, err
+		}
+
+		titles = append(titles, title)
+	}
+
+	return titles, rows.Err()
+}
+
+// DemandTitles returns the books with more reservations than copies. The copies are the ones the library still has, withdrawn, lost
+// and missing ones left out, books catalogued without copies count the ones on the shelf, on loan and on hold.
+func DemandTitles(db Querier) ([]DemandTitle, error) {
+	rows, err := db.Query(context.Background(), "select id, isbn, title, author, copies, reservations from (select b.id, b.isbn, b.title, b.author, "+
+		"case when exists (select 1 from copies c where c.book_id = b.id) "+
+		"then (select count(*) from copies c where c.book_id = b.id and c.status not in ('withdrawn', 'lost', 'missing', 'claimed returned')) "+
+		"else b.quantity + (select count(*) from borrowed_books bb where bb.book_id = b.id and bb.returned_at is null and bb.missing = '') + "+
+		"(select count(*) from book_reservations br where br.book_id = b.id and br.status = 'ready') end as copies, "+
+		"(select count(*) from book_reservations br where br.book_id = b.id and br.status = 'waiting') as reservations from books b) demand "+
+		"where reservations > copies order by reservations desc, title")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	titles := []DemandTitle{}
+	for rows.Next() {
+		var title DemandTitle
+		if err = rows.Scan(&title.BookID, &title.ISBN, &title.Title, &title.Author, &title.Copies, &title.Reservations); err != nil {
+			return nil, err
+		}
+
+		titles = append(titles, title)
+	}
+
+	return titles, rows.Err()
+}
+
+// LoanDurations returns how long the books were kept on average, counting only the loans that were returned. The loans made before
+// the dates were kept and the ones migrated from the old history have no borrow date, so they are left out.
+func LoanDurations(db Querier) ([]LoanDuration, error) {
+	rows, err := db.Query(context.Background(), "select b.id, b.isbn, b.title, count(bb.id), "+
+		"extract(epoch from avg(bb.returned_at - bb.borrowed_at))::float8 / 86400 from books b "+
+		"join borrowed_books bb on bb.book_id = b.id where bb.returned_at is not null and bb.borrowed_at is not null and not bb.migrated group by b.id order by 5 desc, b.title")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	durations := []LoanDuration{}
+	for rows.Next() {
+		var duration LoanDuration
+		if err = rows.Scan(&duration.BookID, &duration.ISBN, &duration.Title, &duration.Loans, &duration.AverageDays); err != nil {
+			return nil, err
+		}
+
+		durations = append(durations, duration)
+	}
+
+	return durations, rows.Err()
+}
+
+// PoorCopies returns the copies in a poor or damaged condition that are still part of the collection.
+func PoorCopies(db Querier) ([]CopyCondition, error) {
+	rows, err := db.Query(context.Background(), "select c.id, c.book_id, b.title, c.barcode, c.shelf, c.condition from copies c join books b on c.book_id = b.id "+
+		"where c.condition in ('poor', 'damaged') and c.status not in ('missing', 'withdrawn') order by c.condition = 'damaged' desc, b.title, c.barcode")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	copies := []CopyCondition{}
+	for rows.Next() {
+		var copy CopyCondition
+		if err = rows.Scan(&copy.CopyID, &copy.BookID, &copy.Title, &copy.Barcode, &copy.Shelf, &copy.Condition); err != nil {
+			return nil, err
+		}
+
+		copies = append(copies, copy)
+	}
+
+	return copies, rows.Err()
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.Format(time.DateOnly)
+}
+
+// respond writes the report as JSON or, when the format is "csv", as a CSV file with the header and the records.
+func respond(c *gin.Context, format, name string, data interface{}, header []string, records [][]string) {
+	if format != "csv" {
+		c.JSON(http.StatusOK, gin.H{name: data})
+		return
+	}
+
+	c.Header("Content-Disposition", "attachment; filename="+name+".csv")
+	c.Header("Content-Type", "text/csv")
+	c.Status(http.StatusOK)
+
+	writer := csv.NewWriter(c.Writer)
+	writer.Write(header)
+	writer.WriteAll(records)
+	if err := writer.Error(); err != nil {
+		log.Println(err)
+	}
+}
+
+// open validates the token of the librarian and connects to the database, it writes the error response itself.
+func open(c *gin.Context, information map[string]interface{}) (*pgx.Conn, bool) {
+	token, _ := information["token"].(string)
+	_, accountType, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return nil, false
+	}
+
+	if accountType != "librarian" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error only librarians can view reports"})
+		return nil, false
+	}
+
+	if format, ok := information["format"].(string); ok && format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error the format has to be json or csv"})
+		return nil, false
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return nil, false
+	}
+
+	if err = CreateCirculationTables(conn); err != nil {
+		conn.Close(context.Background())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	return conn, true
+}
+
+func GetUnborrowedReport(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && months (optional, 12 by default) && format (optional)
+
+	months := 12
+	if value, ok := information["months"]; ok {
+		number, ok := value.(float64)
+		if !ok || number < 1 || number != float64(int(number)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Error the number of months must be a positive whole number"})
+			return
+		}
+		months = int(number)
+	}
+
+	conn, ok := open(c, information)
+	if !ok {
+		return
+	}
+	defer conn.Close(context.Background())
+
+	titles, err := UnborrowedTitles(conn, time.Now().AddDate(0, -months, 0))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the books that weren't borrowed"})
+		return
+	}
+
+	records := [][]string{}
+	for _, title := range titles {
+		records = append(records, []string{strconv.Itoa(title.BookID), title.ISBN, title.Title, title.Author, strconv.Itoa(title.Quantity), formatTime(title.LastBorrowed)})
+	}
+
+	format, _ := information["format"].(string)
+	respond(c, format, "unborrowed", titles, []string{"id", "isbn", "title", "author", "quantity", "last_borrowed"}, records)
+}
+
+func GetDemandReport(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && format (optional)
+
+	conn, ok := open(c, information)
+	if !ok {
+		return
+	}
+	defer conn.Close(context.Background())
+
+	titles, err := DemandTitles(conn)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the books in demand"})
+		return
+	}
+
+	records := [][]string{}
+	for _, title := range titles {
+		records = append(records, []string{strconv.Itoa(title.BookID), title.ISBN, title.Title, title.Author, strconv.Itoa(title.Copies), strconv.Itoa(title.Reservations)})
+	}
+
+	format, _ := information["format"].(string)
+	respond(c, format, "demand", titles, []string{"id", "isbn", "title", "author", "copies", "reservations"}, records)
+}
+
+func GetLoanDurationReport(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && format (optional)
+
+	conn, ok := open(c, information)
+	if !ok {
+		return
+	}
+	defer conn.Close(context.Background())
+
+	durations, err := LoanDurations(conn)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the durations of the loans"})
+		return
+	}
+
+	records := [][]string{}
+	for _, duration := range durations {
+		records = append(records, []string{strconv.Itoa(duration.BookID), duration.ISBN, duration.Title, strconv.Itoa(duration.Loans),
+			strconv.FormatFloat(duration.AverageDays, 'f', 1, 64)})
+	}
+
+	format, _ := information["format"].(string)
+	respond(c, format, "loanDurations", durations, []string{"id", "isbn", "title", "loans", "average_days"}, records)
+}
+
+func GetConditionReport(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && format (optional)
+
+	conn, ok := open(c, information)
+	if !ok {
+		return
+	}
+	defer conn.Close(context.Background())
+
+	copies, err := PoorCopies(conn)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the copies in a poor condition"})
+		return
+	}
+
+	records := [][]string{}
+	for _, copy := range copies {
+		records = append(records, []string{strconv.Itoa(copy.CopyID), strconv.Itoa(copy.BookID), copy.Title, copy.Barcode, copy.Shelf, copy.Condition})
+	}
+
+	format, _ := information["format"].(string)
+	respond(c, format, "copies", copies, []string{"copy_id", "book_id", "title", "barcode", "shelf", "condition"}, records)
+}
@@ -0,0 +1,134 @@
+package reports
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Phantomvv1/Library_management/internal/authentication"
+	"github.com/gin-gonic/gin"
+)
+
+var Token = ""
+
+func TestGetUnborrowedReport(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/report/unborrowed", GetUnborrowedReport)
+	router.POST("/login", authentication.LogIn)
+
+	rr := httptest.NewRecorder()
+
+	jsonBody := []byte(`{"email": "kris@kris.com", "password": "passowrd"}`)
+	reader := bytes.NewReader(jsonBody)
+
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/login", reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+
+	var token map[string]string
+	json.NewDecoder(rr.Body).Decode(&token)
+	Token = token["token"]
+
+	reportRR := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"months": 6, "token": "%s"}`, Token))
+	reader = bytes.NewReader(body)
+
+	req, err = http.NewRequest(http.MethodPost, "http://localhost:42069/report/unborrowed", reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reportRR.Result().Body.Close()
+
+	router.ServeHTTP(reportRR, req)
+
+	if reportRR.Code != http.StatusOK {
+		t.Fatal(reportRR.Body)
+	}
+}
+
+func TestGetDemandReport(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/report/demand", GetDemandReport)
+
+	rr := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"format": "csv", "token": "%s"}`, Token))
+	reader := bytes.NewReader(body)
+
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/report/demand", reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+
+	if !strings.HasPrefix(rr.Body.String(), "id,isbn,title,author,copies,reservations\n") {
+		t.Fatal(rr.Body)
+	}
+}
+
+func TestGetLoanDurationReport(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/report/loans", GetLoanDurationReport)
+
+	rr := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"token": "%s"}`, Token))
+	reader := bytes.NewReader(body)
+
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/report/loans", reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+}
+
+func TestGetConditionReport(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/report/condition", GetConditionReport)
+
+	rr := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"token": "%s"}`, Token))
+	reader := bytes.NewReader(body)
+
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/report/condition", reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"sync"
 
 	. "github.com/Phantomvv1/Library_management/internal/authentication"
+	"github.com/Phantomvv1/Library_management/internal/books"
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5"
 )
@@ -75,6 +76,12 @@ func (v Vote) validVote() bool {
 	}
 }
 
+// editionsOf selects the ids of every edition of the same work as the book in the given query parameter,
+// so that ratings and reviews are shared between the editions.
+func editionsOf(param string) string {
+	return "(select e.id from books b join books e on e.work_id = b.work_id where b.id = " + param + " union select " + param + "::int)"
+}
+
 func CreateReviewsTable(conn *pgx.Conn) error {
 	_, err := conn.Exec(context.Background(), "create table if not exists reviews (id serial primary key, user_id int references authentication(id) on delete cascade, book_id int references books(id)"+
 		" , stars numeric, comment text)")
@@ -155,27 +162,14 @@ func LeaveReview(c *gin.Context) {
 		return
 	}
 
-	title := ""
-	err = conn.QueryRow(context.Background(), "select title from books where id = $1", review.BookID).Scan(&title)
-	if err != nil {
-		log.Println(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to get the title of the book from the database"})
+	if err = books.CreateCirculationTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	hasBorrowedThatBook := false
-	err = conn.QueryRow(context.Background(), fmt.Sprintf(`select hasborrowed from
-				(
-				select a.id, a.history, ($1 = ANY (a.history)) as hasBorrowed
-				from books b join authentication a on b.id = a.id
-				)
-				where id = $2`), title, id).Scan(&hasBorrowedThatBook)
+	err = conn.QueryRow(context.Background(), "select exists (select 1 from borrowed_books where user_id = $1 and book_id = $2)", id, review.BookID).Scan(&hasBorrowedThatBook)
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			c.JSON(http.StatusForbidden, gin.H{"error": "You haven't borrowed this book, so you can't leave a review"})
-			return
-		}
-
 		log.Println(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to check if the user has borrowed this book"})
 		return
@@ -387,7 +381,7 @@ func GetReviewsForBook(c *gin.Context) {
 
 	var rows pgx.Rows
 	if !problem {
-		rows, err = conn.Query(context.Background(), "select id, stars, comment from reviews r where r.book_id = $1", bookID)
+		rows, err = conn.Query(context.Background(), "select id, stars, comment, book_id from reviews r where r.book_id in "+editionsOf("$1"), bookID)
 		if err != nil {
 			log.Println(err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to get the reviews from the database"})
@@ -401,7 +395,7 @@ func GetReviewsForBook(c *gin.Context) {
 			return
 		}
 
-		rows, err = conn.Query(context.Background(), "select id, stars, comment from reviews r where r.book_id = $1", bookID)
+		rows, err = conn.Query(context.Background(), "select id, stars, comment, book_id from reviews r where r.book_id in "+editionsOf("$1"), bookID)
 		if err != nil {
 			log.Println(err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to get the reviews from the database"})
@@ -412,14 +406,13 @@ func GetReviewsForBook(c *gin.Context) {
 	var reviews []Review
 	for rows.Next() {
 		review := Review{}
-		err = rows.Scan(&review.ID, &review.Stars, &review.Comment)
+		err = rows.Scan(&review.ID, &review.Stars, &review.Comment, &review.BookID)
 		if err != nil {
 			log.Println(err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error working with the data"})
 			return
 		}
 
-		review.BookID = bookID
 		reviews = append(reviews, review)
 	}
 
@@ -525,7 +518,7 @@ func GetBookRating(c *gin.Context) {
 		return
 	}
 
-	rows, err := conn.Query(context.Background(), "select stars from reviews where book_id = $1", bookID)
+	rows, err := conn.Query(context.Background(), "select stars from reviews r where r.book_id in "+editionsOf("$1"), bookID)
 	if err != nil {
 		log.Println(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to get information about the reviews on this book"})
@@ -576,7 +569,7 @@ func GetHighestRatedReviews(c *gin.Context) {
 	}
 	defer conn.Close(context.Background())
 
-	rows, err := conn.Query(context.Background(), "select id, stars, comment from reviews r where r.stars >= 4 and r.book_id = $1", bookID)
+	rows, err := conn.Query(context.Background(), "select id, stars, comment, book_id from reviews r where r.stars >= 4 and r.book_id in "+editionsOf("$1"), bookID)
 	if err != nil {
 		log.Println(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to get information from the database"})
@@ -586,14 +579,13 @@ func GetHighestRatedReviews(c *gin.Context) {
 	var reviews []Review
 	for rows.Next() {
 		review := Review{}
-		err = rows.Scan(&review.ID, &review.Stars, &review.Comment)
+		err = rows.Scan(&review.ID, &review.Stars, &review.Comment, &review.BookID)
 		if err != nil {
 			log.Println(err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error working with the information"})
 			return
 		}
 
-		review.BookID = bookID
 		reviews = append(reviews, review)
 	}
 
@@ -625,7 +617,7 @@ func GetLowestRatedReviews(c *gin.Context) {
 	}
 	defer conn.Close(context.Background())
 
-	rows, err := conn.Query(context.Background(), "select id, stars, comment from reviews r where r.stars <= 2 and r.book_id = $1", bookID)
+	rows, err := conn.Query(context.Background(), "select id, stars, comment, book_id from reviews r where r.stars <= 2 and r.book_id in "+editionsOf("$1"), bookID)
 	if err != nil {
 		log.Println(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to get information from the database"})
@@ -635,14 +627,13 @@ func GetLowestRatedReviews(c *gin.Context) {
 	var reviews []Review
 	for rows.Next() {
 		review := Review{}
-		err = rows.Scan(&review.ID, &review.Stars, &review.Comment)
+		err = rows.Scan(&review.ID, &review.Stars, &review.Comment, &review.BookID)
 		if err != nil {
 			log.Println(err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error working with the information"})
 			return
 		}
 
-		review.BookID = bookID
 		reviews = append(reviews, review)
 	}
 
@@ -810,7 +801,7 @@ func getReviews(conn *pgx.Conn, result chan<- thReview, stars float32, mu *sync.
 	res.toStars = stars
 
 	mu.Lock()
-	err := conn.QueryRow(context.Background(), "select count(*) from reviews r where r.stars = $1 and r.book_id = $2", stars, bookID).Scan(&res.count)
+	err := conn.QueryRow(context.Background(), "select count(*) from reviews r where r.stars = $1 and r.book_id in "+editionsOf("$2"), stars, bookID).Scan(&res.count)
 	mu.Unlock()
 
 	if err != nil {
@@ -887,28 +878,28 @@ func RatingDetailsSQL(c *gin.Context) {
 
 	rows, err := conn.Query(context.Background(), fmt.Sprintf(`select * from 
 (
-		select count(*) from reviews r where r.stars = 0.0 and r.book_id = $1
+		select count(*) from reviews r where r.stars = 0.0 and r.book_id in %[1]s
 		union all
-		select count(*) from reviews r where r.stars = 0.5 and r.book_id = $1
+		select count(*) from reviews r where r.stars = 0.5 and r.book_id in %[1]s
 		union all
-		select count(*) from reviews r where r.stars = 1 and r.book_id = $1
+		select count(*) from reviews r where r.stars = 1 and r.book_id in %[1]s
 		union all
-		select count(*) from reviews r where r.stars = 1.5 and r.book_id = $1
+		select count(*) from reviews r where r.stars = 1.5 and r.book_id in %[1]s
 		union all
-		select count(*) from reviews r where r.stars = 2 and r.book_id = $1
+		select count(*) from reviews r where r.stars = 2 and r.book_id in %[1]s
 		union all
-		select count(*) from reviews r where r.stars = 2.5 and r.book_id = $1
+		select count(*) from reviews r where r.stars = 2.5 and r.book_id in %[1]s
 		union all
-		select count(*) from reviews r where r.stars = 3 and r.book_id = $1
+		select count(*) from reviews r where r.stars = 3 and r.book_id in %[1]s
 		union all
-		select count(*) from reviews r where r.stars = 3.5 and r.book_id = $1
+		select count(*) from reviews r where r.stars = 3.5 and r.book_id in %[1]s
 		union all
-		select count(*) from reviews r where r.stars = 4 and r.book_id = $1
+		select count(*) from reviews r where r.stars = 4 and r.book_id in %[1]s
 		union all
-		select count(*) from reviews r where r.stars = 4.5 and r.book_id = $1
+		select count(*) from reviews r where r.stars = 4.5 and r.book_id in %[1]s
 		union all
-		select count(*) from reviews r where r.stars = 5 and r.book_id = $1
-)`), bookID)
+		select count(*) from reviews r where r.stars = 5 and r.book_id in %[1]s
+)`, editionsOf("$1")), bookID)
 
 	if err != nil {
 		log.Println(err)
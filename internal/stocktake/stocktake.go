@@ -0,0 +1,684 @@
+package stocktake
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/Phantomvv1/Library_management/internal/authentication"
+	. "github.com/Phantomvv1/Library_management/internal/books"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+type Session struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	Shelves   []string   `json:"shelves"`
+	StartedBy int        `json:"startedBy"`
+	StartedAt time.Time  `json:"startedAt"`
+	ClosedAt  *time.Time `json:"closedAt"`
+}
+
+type Scan struct {
+	Barcode string `json:"barcode"`
+	Shelf   string `json:"shelf"`
+}
+
+// CopyRecord is what the catalog knows about a copy of a book.
+type CopyRecord struct {
+	ID      int    `json:"copyID"`
+	BookID  int    `json:"bookID"`
+	Title   string `json:"title"`
+	Barcode string `json:"barcode"`
+	Shelf   string `json:"shelf"`
+	Status  string `json:"status"`
+}
+
+type Item struct {
+	CopyRecord
+	ScannedShelf string `json:"scannedShelf,omitempty"`
+}
+
+type Report struct {
+	Scanned    int    `json:"scanned"`
+	Matched    int    `json:"matched"`
+	Missing    []Item `json:"missing"`
+	Unexpected []Item `json:"unexpected"`
+	Misplaced  []Item `json:"misplaced"`
+}
+
+// Reconcile compares the scans of a session with the catalog. Copies on the shelves in scope that are on loan or
+// already missing are not expected on the shelf. A scanned barcode that is unknown, or belongs to a copy that isn't
+// recorded as available, is unexpected and an available copy scanned on another shelf than its own is misplaced.
+func Reconcile(copies []CopyRecord, scans []Scan, shelves []string) Report {
+	report := Report{Scanned: len(scans), Missing: []Item{}, Unexpected: []Item{}, Misplaced: []Item{}}
+
+	byBarcode := make(map[string]CopyRecord, len(copies))
+	for _, copy := range copies {
+		byBarcode[copy.Barcode] = copy
+	}
+
+	scanned := make(map[string]bool, len(scans))
+	for _, scan := range scans {
+		scanned[scan.Barcode] = true
+
+		copy, ok := byBarcode[scan.Barcode]
+		switch {
+		case !ok:
+			report.Unexpected = append(report.Unexpected, Item{CopyRecord: CopyRecord{Barcode: scan.Barcode}, ScannedShelf: scan.Shelf})
+		case copy.Status != "available":
+			report.Unexpected = append(report.Unexpected, Item{CopyRecord: copy, ScannedShelf: scan.Shelf})
+		case copy.Shelf != "" && copy.Shelf != scan.Shelf:
+			report.Misplaced = append(report.Misplaced, Item{CopyRecord: copy, ScannedShelf: scan.Shelf})
+		default:
+			report.Matched++
+		}
+	}
+
+	inScope := make(map[string]bool, len(shelves))
+	for _, shelf := range shelves {
+		inScope[shelf] = true
+	}
+
+	for _, copy := range copies {
+		if copy.Status == "available" && inScope[copy.Shelf] && !scanned[copy.Barcode] {
+			report.Missing = append(report.Missing, Item{CopyRecord: copy})
+		}
+	}
+
+	sort.Slice(report.Missing, func(i, j int) bool {
+		if report.Missing[i].Shelf != report.Missing[j].Shelf {
+			return report.Missing[i].Shelf < report.Missing[j].Shelf
+		}
+		return report.Missing[i].Barcode < report.Missing[j].Barcode
+	})
+
+	return report
+}
+
+func createTables(conn *pgx.Conn) error {
+	if err := CreateCirculationTables(conn); err != nil {
+		return err
+	}
+
+	if err := CreateBookChangesTable(conn); err != nil {
+		return err
+	}
+
+	_, err := conn.Exec(context.Background(), "create table if not exists stocktakes (id serial primary key, name text not null default '', shelves text[] not null default '{}', "+
+		"started_by int references authentication(id) on delete set null, started_at timestamp not null default current_timestamp, closed_at timestamp);")
+	if err != nil {
+		log.Println(err)
+		return errors.New("Couldn't create a table for the stocktakes")
+	}
+
+	_, err = conn.Exec(context.Background(), "create table if not exists stocktake_scans (id serial primary key, stocktake_id int not null references stocktakes(id) on delete cascade, "+
+		"barcode text not null, shelf text not null default '', scanned_at timestamp not null default current_timestamp, unique (stocktake_id, barcode));")
+	if err != nil {
+		log.Println(err)
+		return errors.New("Couldn't create a table for the scans of the stocktakes")
+	}
+
+	return nil
+}
+
+// librarian validates the token and returns the id of the librarian using it.
+func librarian(c *gin.Context, information map[string]interface{}) (int, bool) {
+	token, _ := information["token"].(string)
+	id, accountType, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return 0, false
+	}
+
+	if accountType != "librarian" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error only librarians can take stock"})
+		return 0, false
+	}
+
+	return id, true
+}
+
+func getSession(db Querier, id int) (Session, error) {
+	session := Session{ID: id}
+	err := db.QueryRow(context.Background(), "select name, shelves, coalesce(started_by, 0), started_at, closed_at from stocktakes where id = $1", id).Scan(
+		&session.Name, &session.Shelves, &session.StartedBy, &session.StartedAt, &session.ClosedAt)
+	return session, err
+}
+
+func getScans(db Querier, stocktakeID int) ([]Scan, error) {
+	rows, err := db.Query(context.Background(), "select barcode, shelf from stocktake_scans where stocktake_id = $1 order by scanned_at, id", stocktakeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var scans []Scan
+	for rows.Next() {
+		var scan Scan
+		if err = rows.Scan(&scan.Barcode, &scan.Shelf); err != nil {
+			return nil, err
+		}
+
+		scans = append(scans, scan)
+	}
+
+	return scans, rows.Err()
+}
+
+// getCopies returns the scanned copies and every copy that belongs on one of the shelves.
+func getCopies(db Querier, barcodes, shelves []string) ([]CopyRecord, error) {
+	rows, err := db.Query(context.Background(), "select c.id, c.book_id, b.title, c.barcode, c.shelf, c.status from copies c join books b on c.book_id = b.id "+
+		"where c.barcode = any($1) or c.shelf = any($2) order by c.shelf, c.barcode", barcodes, shelves)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var copies []CopyRecord
+	for rows.Next() {
+		var copy CopyRecord
+		if err = rows.Scan(&copy.ID, &copy.BookID, &copy.Title, &copy.Barcode, &copy.Shelf, &copy.Status); err != nil {
+			return nil, err
+		}
+
+		copies = append(copies, copy)
+	}
+
+	return copies, rows.Err()
+}
+
+// reconcileSession builds the report of a session, when the session wasn't limited to some shelves
+// every shelf scanned during it is expected to be complete.
+func reconcileSession(db Querier, session Session) (Report, error) {
+	scans, err := getScans(db, session.ID)
+	if err != nil {
+		return Report{}, err
+	}
+
+	shelves := session.Shelves
+	if len(shelves) == 0 {
+		seen := make(map[string]bool)
+		for _, scan := range scans {
+			if !seen[scan.Shelf] {
+				seen[scan.Shelf] = true
+				shelves = append(shelves, scan.Shelf)
+			}
+		}
+	}
+
+	barcodes := make([]string, 0, len(scans))
+	for _, scan := range scans {
+		barcodes = append(barcodes, scan.Barcode)
+	}
+
+	copies, err := getCopies(db, barcodes, shelves)
+	if err != nil {
+		return Report{}, err
+	}
+
+	return Reconcile(copies, scans, shelves), nil
+}
+
+func stringList(value interface{}) ([]string, bool) {
+	if value == nil {
+		return []string{}, true
+	}
+
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	result := []string{}
+	for _, element := range list {
+		text, ok := element.(string)
+		if !ok || strings.TrimSpace(text) == "" {
+			return nil, false
+		}
+
+		result = append(result, strings.TrimSpace(text))
+	}
+
+	return result, true
+}
+
+// StartStocktake opens a stocktake session, optionally limited to some shelves.
+func StartStocktake(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && name (optional) && shelves (optional)
+
+	userID, ok := librarian(c, information)
+	if !ok {
+		return
+	}
+
+	session := Session{StartedBy: userID}
+	session.Name, _ = information["name"].(string)
+	session.Shelves, ok = stringList(information["shelves"])
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error the shelves must be a list of names"})
+		return
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = createTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = conn.QueryRow(context.Background(), "insert into stocktakes (name, shelves, started_by) values ($1, $2, $3) returning id, started_at",
+		session.Name, session.Shelves, userID).Scan(&session.ID, &session.StartedAt)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to start the stocktake"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"stocktake": session})
+}
+
+// ScanCopies records the barcodes scanned on a shelf. Scanning a barcode again moves it to the latest shelf.
+func ScanCopies(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && stocktakeID && shelf && barcodes
+
+	if _, ok := librarian(c, information); !ok {
+		return
+	}
+
+	stocktakeID, ok := information["stocktakeID"].(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided id of the stocktake"})
+		return
+	}
+
+	shelf, ok := information["shelf"].(string)
+	if !ok || strings.TrimSpace(shelf) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided shelf"})
+		return
+	}
+	shelf = strings.TrimSpace(shelf)
+
+	barcodes, ok := stringList(information["barcodes"])
+	if !ok || len(barcodes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided barcodes"})
+		return
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = createTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, err := getSession(conn, int(stocktakeID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Error there is no such stocktake"})
+			return
+		}
+
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the stocktake"})
+		return
+	}
+
+	if session.ClosedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Error this stocktake is already closed"})
+		return
+	}
+
+	_, err = conn.Exec(context.Background(), "insert into stocktake_scans (stocktake_id, barcode, shelf) select $1, barcode, $2 from unnest($3::text[]) barcode "+
+		"on conflict (stocktake_id, barcode) do update set shelf = excluded.shelf, scanned_at = current_timestamp", session.ID, shelf, barcodes)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving the scanned barcodes"})
+		return
+	}
+
+	copies, err := getCopies(conn, barcodes, nil)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the scanned copies"})
+		return
+	}
+
+	scans := make([]Scan, 0, len(barcodes))
+	for _, barcode := range barcodes {
+		scans = append(scans, Scan{Barcode: barcode, Shelf: shelf})
+	}
+
+	report := Reconcile(copies, scans, nil)
+	c.JSON(http.StatusOK, gin.H{"scanned": report.Scanned, "matched": report.Matched, "unexpected": report.Unexpected, "misplaced": report.Misplaced})
+}
+
+// GetStocktakeReport reconciles the scans of a stocktake with the catalog.
+func GetStocktakeReport(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && stocktakeID
+
+	if _, ok := librarian(c, information); !ok {
+		return
+	}
+
+	stocktakeID, ok := information["stocktakeID"].(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided id of the stocktake"})
+		return
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = createTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, err := getSession(conn, int(stocktakeID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Error there is no such stocktake"})
+			return
+		}
+
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the stocktake"})
+		return
+	}
+
+	report, err := reconcileSession(conn, session)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reconciling the stocktake"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"stocktake": session, "report": report})
+}
+
+// adjust applies one adjustment from the report to the copy with the barcode:
+// "missing" takes an unscanned copy on a shelf the stocktake counted out of the stock, "found" puts a scanned missing copy back on the shelf it was
+// scanned on and "relocate" moves a misplaced copy to the shelf it was scanned on.
+func adjust(tx pgx.Tx, session Session, userID int, action, barcode string) (int, error) {
+	var copy CopyRecord
+	err := tx.QueryRow(context.Background(), "select c.id, c.book_id, c.barcode, c.shelf, c.status from copies c where c.barcode = $1 for update", barcode).Scan(
+		&copy.ID, &copy.BookID, &copy.Barcode, &copy.Shelf, &copy.Status)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return http.StatusNotFound, errors.New("Error there is no copy with the barcode " + barcode)
+		}
+
+		log.Println(err)
+		return http.StatusInternalServerError, errors.New("Error getting the copy")
+	}
+
+	scannedShelf := ""
+	err = tx.QueryRow(context.Background(), "select shelf from stocktake_scans where stocktake_id = $1 and barcode = $2", session.ID, barcode).Scan(&scannedShelf)
+	scanned := err == nil
+	if err != nil && err != pgx.ErrNoRows {
+		log.Println(err)
+		return http.StatusInternalServerError, errors.New("Error getting the scans of the stocktake")
+	}
+
+	changeQuantity := func(delta int) error {
+		quantity := 0
+		err := tx.QueryRow(context.Background(), "update books set quantity = greatest(quantity + $1, 0) where id = $2 returning quantity", delta, copy.BookID).Scan(&quantity)
+		if err != nil {
+			log.Println(err)
+			return errors.New("Error updating the quantity of the book")
+		}
+
+		return RecordBookChange(tx, copy.BookID, userID, "quantity", strconv.Itoa(quantity-delta), strconv.Itoa(quantity))
+	}
+
+	switch action {
+	case "missing":
+		if scanned || copy.Status != "available" {
+			return http.StatusConflict, errors.New("Error only available copies that weren't scanned can be marked as missing")
+		}
+
+		// Only the shelves the stocktake covers were counted, a copy shelved anywhere else wasn't looked for.
+		counted := slices.Contains(session.Shelves, copy.Shelf)
+		if len(session.Shelves) == 0 {
+			err = tx.QueryRow(context.Background(), "select exists (select 1 from stocktake_scans where stocktake_id = $1 and shelf = $2)", session.ID, copy.Shelf).Scan(&counted)
+			if err != nil {
+				log.Println(err)
+				return http.StatusInternalServerError, errors.New("Error getting the scans of the stocktake")
+			}
+		}
+
+		if !counted {
+			return http.StatusConflict, errors.New("Error the copy is shelved on " + copy.Shelf + ", which this stocktake didn't count")
+		}
+
+		if err = changeQuantity(-1); err != nil {
+			return http.StatusInternalServerError, err
+		}
+
+		_, err = tx.Exec(context.Background(), "update copies set status = 'missing' where id = $1", copy.ID)
+		if err != nil {
+			log.Println(err)
+			return http.StatusInternalServerError, errors.New("Error marking the copy as missing")
+		}
+
+		err = RecordBookChange(tx, copy.BookID, userID, "copy "+barcode+" status", copy.Status, "missing")
+	case "found":
+		if !scanned || copy.Status != "missing" {
+			return http.StatusConflict, errors.New("Error only missing copies that were scanned can be found")
+		}
+
+		// A copy still on loan goes back on the shelf when the loan is found, doing it here would count it twice.
+		onLoan := false
+		err = tx.QueryRow(context.Background(), "select exists (select 1 from borrowed_books where copy_id = $1 and returned_at is null)", copy.ID).Scan(&onLoan)
+		if err != nil {
+			log.Println(err)
+			return http.StatusInternalServerError, errors.New("Error getting the loans of the copy")
+		}
+
+		if onLoan {
+			return http.StatusConflict, errors.New("Error the copy " + barcode + " is still on loan, mark its loan as found instead")
+		}
+
+		if err = changeQuantity(1); err != nil {
+			return http.StatusInternalServerError, err
+		}
+
+		_, err = tx.Exec(context.Background(), "update copies set status = 'available', shelf = $1 where id = $2", scannedShelf, copy.ID)
+		if err != nil {
+			log.Println(err)
+			return http.StatusInternalServerError, errors.New("Error marking the copy as found")
+		}
+
+		err = RecordBookChange(tx, copy.BookID, userID, "copy "+barcode+" status", copy.Status, "available")
+		if err == nil && copy.Shelf != scannedShelf {
+			err = RecordBookChange(tx, copy.BookID, userID, "copy "+barcode+" shelf", copy.Shelf, scannedShelf)
+		}
+	case "relocate":
+		if !scanned || copy.Shelf == scannedShelf {
+			return http.StatusConflict, errors.New("Error only copies scanned on another shelf can be relocated")
+		}
+
+		_, err = tx.Exec(context.Background(), "update copies set shelf = $1 where id = $2", scannedShelf, copy.ID)
+		if err != nil {
+			log.Println(err)
+			return http.StatusInternalServerError, errors.New("Error moving the copy")
+		}
+
+		err = RecordBookChange(tx, copy.BookID, userID, "copy "+barcode+" shelf", copy.Shelf, scannedShelf)
+	default:
+		return http.StatusBadRequest, errors.New("Error unknown adjustment, use missing, found or relocate")
+	}
+
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return http.StatusOK, nil
+}
+
+// AdjustStocktake applies an adjustment from the report to one or more copies at once,
+// every change to the quantity, status or shelf ends up in the change history of the book.
+func AdjustStocktake(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && stocktakeID && action && barcodes
+
+	userID, ok := librarian(c, information)
+	if !ok {
+		return
+	}
+
+	stocktakeID, ok := information["stocktakeID"].(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided id of the stocktake"})
+		return
+	}
+
+	action, _ := information["action"].(string)
+	barcodes, ok := stringList(information["barcodes"])
+	if !ok || len(barcodes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided barcodes"})
+		return
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = createTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, err := getSession(conn, int(stocktakeID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Error there is no such stocktake"})
+			return
+		}
+
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the stocktake"})
+		return
+	}
+
+	if session.ClosedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Error this stocktake is already closed"})
+		return
+	}
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adjusting the stock"})
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	for _, barcode := range barcodes {
+		status, err := adjust(tx, session, userID, action, barcode)
+		if err != nil {
+			c.JSON(status, gin.H{"error": err.Error(), "barcode": barcode})
+			return
+		}
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adjusting the stock"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"adjusted": len(barcodes)})
+}
+
+// CloseStocktake stops a session from accepting scans and returns its final report.
+func CloseStocktake(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && stocktakeID
+
+	if _, ok := librarian(c, information); !ok {
+		return
+	}
+
+	stocktakeID, ok := information["stocktakeID"].(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided id of the stocktake"})
+		return
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = createTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err = conn.Exec(context.Background(), "update stocktakes set closed_at = coalesce(closed_at, current_timestamp) where id = $1", int(stocktakeID))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error closing the stocktake"})
+		return
+	}
+
+	session, err := getSession(conn, int(stocktakeID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Error there is no such stocktake"})
+			return
+		}
+
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting the stocktake"})
+		return
+	}
+
+	report, err := reconcileSession(conn, session)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reconciling the stocktake"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"stocktake": session, "report": report})
+}
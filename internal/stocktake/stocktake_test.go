@@ -0,0 +1,278 @@
+package stocktake
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/Phantomvv1/Library_management/internal/authentication"
+	"github.com/Phantomvv1/Library_management/internal/books"
+	"github.com/Phantomvv1/Library_management/internal/missing"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+var Token = ""
+var StocktakeID = 0
+
+func TestReconcile(t *testing.T) {
+	copies := []CopyRecord{
+		{ID: 1, BookID: 1, Barcode: "A1", Shelf: "A", Status: "available"},
+		{ID: 2, BookID: 1, Barcode: "A2", Shelf: "A", Status: "available"},
+		{ID: 3, BookID: 2, Barcode: "A3", Shelf: "A", Status: "borrowed"},
+		{ID: 4, BookID: 2, Barcode: "B1", Shelf: "B", Status: "available"},
+		{ID: 5, BookID: 3, Barcode: "C1", Shelf: "C", Status: "missing"},
+	}
+	scans := []Scan{
+		{Barcode: "A1", Shelf: "A"},
+		{Barcode: "B1", Shelf: "A"},
+		{Barcode: "C1", Shelf: "A"},
+		{Barcode: "X9", Shelf: "A"},
+	}
+
+	report := Reconcile(copies, scans, []string{"A"})
+
+	if report.Scanned != 4 || report.Matched != 1 {
+		t.Fatalf("expected 4 scanned and 1 matched, got %d and %d", report.Scanned, report.Matched)
+	}
+
+	if len(report.Missing) != 1 || report.Missing[0].Barcode != "A2" {
+		t.Fatalf("expected A2 to be missing, got %+v", report.Missing)
+	}
+
+	if len(report.Misplaced) != 1 || report.Misplaced[0].Barcode != "B1" || report.Misplaced[0].ScannedShelf != "A" {
+		t.Fatalf("expected B1 to be misplaced on A, got %+v", report.Misplaced)
+	}
+
+	if len(report.Unexpected) != 2 || report.Unexpected[0].Barcode != "C1" || report.Unexpected[1].Barcode != "X9" {
+		t.Fatalf("expected C1 and X9 to be unexpected, got %+v", report.Unexpected)
+	}
+}
+
+func TestStartStocktake(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/stocktake", StartStocktake)
+	router.POST("/login", authentication.LogIn)
+
+	rr := httptest.NewRecorder()
+
+	jsonBody := []byte(`{"email": "kris@kris.com", "password": "passowrd"}`)
+	reader := bytes.NewReader(jsonBody)
+
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/login", reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+
+	var token map[string]string
+	json.NewDecoder(rr.Body).Decode(&token)
+	Token = token["token"]
+
+	stocktakeRR := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"name": "Shelf A", "shelves": ["A"], "token": "%s"}`, Token))
+	reader = bytes.NewReader(body)
+
+	req, err = http.NewRequest(http.MethodPost, "http://localhost:42069/stocktake", reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stocktakeRR.Result().Body.Close()
+
+	router.ServeHTTP(stocktakeRR, req)
+
+	if stocktakeRR.Code != http.StatusOK {
+		t.Fatal(stocktakeRR.Body)
+	}
+
+	var response map[string]Session
+	json.NewDecoder(stocktakeRR.Body).Decode(&response)
+	StocktakeID = response["stocktake"].ID
+}
+
+func TestScanCopies(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/stocktake/scan", ScanCopies)
+
+	rr := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"stocktakeID": %d, "shelf": "A", "barcodes": ["LIB-000001"], "token": "%s"}`, StocktakeID, Token))
+	reader := bytes.NewReader(body)
+
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/stocktake/scan", reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+}
+
+func TestGetStocktakeReport(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/stocktake/report", GetStocktakeReport)
+
+	rr := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"stocktakeID": %d, "token": "%s"}`, StocktakeID, Token))
+	reader := bytes.NewReader(body)
+
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/stocktake/report", reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+}
+
+func TestCloseStocktake(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/stocktake/close", CloseStocktake)
+
+	rr := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"stocktakeID": %d, "token": "%s"}`, StocktakeID, Token))
+	reader := bytes.NewReader(body)
+
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/stocktake/close", reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+}
+
+// TestFoundClaimedCopy scans a copy whose loan was claimed returned and checks the stocktake can't put it back on the shelf,
+// only finding the loan does, so the quantity of the book goes up once.
+func TestFoundClaimedCopy(t *testing.T) {
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	if err = books.CreateCirculationTables(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	userID, _, err := authentication.ValidateJWT(Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var bookID, copyID, loanID int
+	err = conn.QueryRow(context.Background(), "insert into books (title, author, year, quantity) values ('Claimed test', 'Tester', 2000, 0) returning id").Scan(&bookID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		conn.Exec(context.Background(), "delete from ledger where loan_id in (select id from borrowed_books where book_id = $1)", bookID)
+		conn.Exec(context.Background(), "delete from borrowed_books where book_id = $1", bookID)
+		conn.Exec(context.Background(), "delete from books where id = $1", bookID)
+	}()
+
+	barcode := fmt.Sprintf("CLAIMED-%d", bookID)
+	err = conn.QueryRow(context.Background(), "insert into copies (book_id, barcode, shelf, status) values ($1, $2, 'Claims', 'borrowed') returning id", bookID, barcode).Scan(&copyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = conn.QueryRow(context.Background(), "insert into borrowed_books (book_id, user_id, copy_id, return_date) values ($1, $2, $3, current_date + 7) returning id",
+		bookID, userID, copyID).Scan(&loanID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = books.MarkMissing(conn, loanID, userID, missing.StatusClaimed, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/stocktake", StartStocktake)
+	router.POST("/stocktake/scan", ScanCopies)
+	router.POST("/stocktake/adjust", AdjustStocktake)
+
+	send := func(path, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+
+		req, err := http.NewRequest(http.MethodPost, "http://localhost:42069"+path, bytes.NewReader([]byte(body)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := send("/stocktake", fmt.Sprintf(`{"name": "Claims", "shelves": ["Claims"], "token": "%s"}`, Token))
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+
+	var response map[string]Session
+	json.NewDecoder(rr.Body).Decode(&response)
+	stocktakeID := response["stocktake"].ID
+
+	if rr = send("/stocktake/scan", fmt.Sprintf(`{"stocktakeID": %d, "shelf": "Claims", "barcodes": ["%s"], "token": "%s"}`, stocktakeID, barcode, Token)); rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+
+	found := fmt.Sprintf(`{"stocktakeID": %d, "action": "found", "barcodes": ["%s"], "token": "%s"}`, stocktakeID, barcode, Token)
+	if rr = send("/stocktake/adjust", found); rr.Code != http.StatusConflict {
+		t.Fatalf("expected a copy claimed returned not to be found by the stocktake, got %d %s", rr.Code, rr.Body)
+	}
+
+	// Copies claimed returned before they had their own status were marked missing like the ones stocktakes lose.
+	if _, err = conn.Exec(context.Background(), "update copies set status = 'missing' where id = $1", copyID); err != nil {
+		t.Fatal(err)
+	}
+
+	if rr = send("/stocktake/adjust", found); rr.Code != http.StatusConflict {
+		t.Fatalf("expected a missing copy still on loan not to be found by the stocktake, got %d %s", rr.Code, rr.Body)
+	}
+
+	if _, err = books.MarkFound(conn, loanID, userID, "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	quantity, status := 0, ""
+	err = conn.QueryRow(context.Background(), "select b.quantity, c.status from books b join copies c on c.book_id = b.id where c.id = $1", copyID).Scan(&quantity, &status)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if quantity != 1 || status != "available" {
+		t.Fatalf("expected the found copy back on the shelf once, got a quantity of %d and the status %q", quantity, status)
+	}
+}
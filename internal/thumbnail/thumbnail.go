@@ -0,0 +1,96 @@
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+
+	_ "image/gif"
+	_ "image/png"
+)
+
+// Sizes maps the name of every generated thumbnail to its maximum width and height in pixels.
+var Sizes = map[string]int{
+	"small":  96,
+	"medium": 240,
+	"large":  480,
+}
+
+// MaxPixels is the largest width x height Decode accepts, a small file can declare a huge image that would take all the memory to decode.
+const MaxPixels = 25_000_000
+
+var ErrTooLarge = errors.New("Error the image can't have more than 25 million pixels")
+
+// Decode reads a JPEG, PNG or GIF image and returns it with its format name. The size in the header is checked
+// before the image is decoded and images over MaxPixels are rejected with ErrTooLarge.
+func Decode(r io.Reader) (image.Image, string, error) {
+	var header bytes.Buffer
+	config, _, err := image.DecodeConfig(io.TeeReader(r, &header))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if config.Width <= 0 || config.Height <= 0 || config.Width > MaxPixels/config.Height {
+		return nil, "", ErrTooLarge
+	}
+
+	return image.Decode(io.MultiReader(&header, r))
+}
+
+// Resize scales the image down with a box filter so that it fits in a maxSize x maxSize square,
+// smaller images are returned unchanged.
+func Resize(src image.Image, maxSize int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxSize && height <= maxSize {
+		return src
+	}
+
+	newWidth, newHeight := maxSize, maxSize
+	if width > height {
+		newHeight = max(1, height*maxSize/width)
+	} else {
+		newWidth = max(1, width*maxSize/height)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, newWidth, newHeight))
+	for y := 0; y < newHeight; y++ {
+		y0 := bounds.Min.Y + y*height/newHeight
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*height/newHeight)
+		for x := 0; x < newWidth; x++ {
+			x0 := bounds.Min.X + x*width/newWidth
+			x1 := max(x0+1, bounds.Min.X+(x+1)*width/newWidth)
+
+			var r, g, b, a, count uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					count++
+				}
+			}
+
+			dst.Set(x, y, color.RGBA64{R: uint16(r / count), G: uint16(g / count), B: uint16(b / count), A: uint16(a / count)})
+		}
+	}
+
+	return dst
+}
+
+// Generate encodes a JPEG thumbnail of the image for every entry in Sizes.
+func Generate(src image.Image) (map[string][]byte, error) {
+	thumbnails := make(map[string][]byte)
+	for name, size := range Sizes {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, Resize(src, size), &jpeg.Options{Quality: 85}); err != nil {
+			return nil, err
+		}
+
+		thumbnails[name] = buf.Bytes()
+	}
+
+	return thumbnails, nil
+}
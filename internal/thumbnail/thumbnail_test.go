@@ -0,0 +1,82 @@
+package thumbnail
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func TestResize(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 1000, 500))
+	for y := 0; y < 500; y++ {
+		for x := 0; x < 1000; x++ {
+			src.Set(x, y, color.RGBA{R: 200, G: 100, B: 50, A: 255})
+		}
+	}
+
+	resized := Resize(src, 100)
+	if resized.Bounds().Dx() != 100 || resized.Bounds().Dy() != 50 {
+		t.Fatal(resized.Bounds())
+	}
+
+	if r, g, b, _ := resized.At(10, 10).RGBA(); r>>8 != 200 || g>>8 != 100 || b>>8 != 50 {
+		t.Fatal(r>>8, g>>8, b>>8)
+	}
+
+	if small := Resize(src, 2000); small != image.Image(src) {
+		t.Fatal("images smaller than the thumbnail should not be scaled up")
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 600, 900))); err != nil {
+		t.Fatal(err)
+	}
+
+	src, format, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if format != "png" {
+		t.Fatal(format)
+	}
+
+	thumbnails, err := Generate(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, size := range Sizes {
+		img, _, err := Decode(bytes.NewReader(thumbnails[name]))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if img.Bounds().Dy() != size {
+			t.Fatalf("%s: %v", name, img.Bounds())
+		}
+	}
+}
+
+func TestDecodeTooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+
+	// The IHDR chunk follows the 8 byte signature, its width and height are rewritten to 50000x50000 and its checksum recomputed.
+	data := buf.Bytes()
+	binary.BigEndian.PutUint32(data[16:20], 50000)
+	binary.BigEndian.PutUint32(data[20:24], 50000)
+	binary.BigEndian.PutUint32(data[29:33], crc32.ChecksumIEEE(data[12:29]))
+
+	if _, _, err := Decode(bytes.NewReader(data)); err != ErrTooLarge {
+		t.Fatalf("expected ErrTooLarge, got %v", err)
+	}
+}
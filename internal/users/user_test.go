@@ -106,3 +106,26 @@ func TestGetUserByID(t *testing.T) {
 
 	log.Println(rr.Body)
 }
+
+func TestSetPatronAge(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/user/age", SetPatronAge)
+
+	rr := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"id": 1, "birthDate": "2014-05-01", "category": "child", "token": "%s"}`, Token))
+	reader := bytes.NewReader(body)
+
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/user/age", reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK && rr.Code != http.StatusForbidden {
+		t.Fatal(rr.Body)
+	}
+}
@@ -7,7 +7,9 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"time"
 
+	"github.com/Phantomvv1/Library_management/internal/agerating"
 	. "github.com/Phantomvv1/Library_management/internal/authentication"
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5"
@@ -28,7 +30,7 @@ func GetUsers(c *gin.Context) {
 	}
 	defer conn.Close(context.Background())
 
-	_, err = conn.Exec(context.Background(), "create table if not exists authentication (id serial primary key not null, name text, email text, password text, type text, history text);")
+	_, err = conn.Exec(context.Background(), "create table if not exists authentication (id serial primary key not null, name text, email text, password text, type text);")
 	if err != nil {
 		log.Println(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating a table for authentication"})
@@ -174,7 +176,7 @@ func GetUserByID(c *gin.Context) {
 
 	var user Profile
 	user.ID = id
-	err = conn.QueryRow(context.Background(), "select name, email, history, type from authentication a where a.id = $1", id).Scan(&user.Name, &user.Email, &user.History, &user.Type)
+	err = conn.QueryRow(context.Background(), "select name, email, type from authentication a where a.id = $1", id).Scan(&user.Name, &user.Email, &user.Type)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Error there is user with this id"})
@@ -186,5 +188,100 @@ func GetUserByID(c *gin.Context) {
 		return
 	}
 
+	if user.History, err = LoanTitles(conn, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+// SetPatronAge lets a librarian set the date of birth or the category (child, teen or adult) of a patron,
+// the age ratings of the books are checked against them. An empty birthDate removes the date of birth.
+func SetPatronAge(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && id && (birthDate | category)
+
+	token, _ := information["token"].(string)
+	_, accountType, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return
+	}
+
+	if accountType != "librarian" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error only librarians can change the age of a patron"})
+		return
+	}
+
+	id, ok := information["id"].(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided id of the user"})
+		return
+	}
+
+	birthDateValue, hasBirthDate := information["birthDate"]
+	categoryValue, hasCategory := information["category"]
+	if !hasBirthDate && !hasCategory {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error no date of birth or category provided"})
+		return
+	}
+
+	var birthDate *time.Time
+	if hasBirthDate {
+		value, ok := birthDateValue.(string)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": agerating.ErrInvalidBirthDate.Error()})
+			return
+		}
+
+		if value != "" {
+			date, err := agerating.ParseBirthDate(value, time.Now())
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			birthDate = &date
+		}
+	}
+
+	category := ""
+	if hasCategory {
+		category, ok = categoryValue.(string)
+		if !ok || !agerating.ValidCategory(category) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": agerating.ErrInvalidCategory.Error()})
+			return
+		}
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = CreateAuthTable(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user Profile
+	err = conn.QueryRow(context.Background(), "update authentication set birth_date = case when $1 then $2 else birth_date end, "+
+		"category = case when $3 then $4 else category end where id = $5 returning id, name, email, type, birth_date, category",
+		hasBirthDate, birthDate, hasCategory, category, int(id)).Scan(&user.ID, &user.Name, &user.Email, &user.Type, &user.BirthDate, &user.Category)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Error there is no user with this id"})
+			return
+		}
+
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to change the age of the user"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"user": user})
 }
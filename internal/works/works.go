@@ -0,0 +1,427 @@
+package works
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	. "github.com/Phantomvv1/Library_management/internal/authentication"
+	. "github.com/Phantomvv1/Library_management/internal/books"
+	. "github.com/Phantomvv1/Library_management/internal/reviews"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+type Work struct {
+	ID           int      `json:"id"`
+	Title        string   `json:"title"`
+	Author       string   `json:"author"`
+	SeriesID     int      `json:"seriesID"`
+	SeriesNumber *float64 `json:"seriesNumber"`
+	Rating       float64  `json:"rating"`
+	ReviewCount  int      `json:"reviewCount"`
+	Editions     []Book   `json:"editions,omitempty"`
+}
+
+type Series struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Works       []Work `json:"works,omitempty"`
+}
+
+func createTables(conn *pgx.Conn) error {
+	if err := CreateAuthTable(conn); err != nil {
+		return err
+	}
+
+	if err := CreateBookTable(conn); err != nil {
+		return err
+	}
+
+	if err := CreateReviewsTable(conn); err != nil {
+		log.Println(err)
+		return errors.New("Error unable to create a table for reviews")
+	}
+
+	return nil
+}
+
+func getWork(conn *pgx.Conn, id int) (Work, error) {
+	work := Work{ID: id}
+	err := conn.QueryRow(context.Background(), "select title, author, coalesce(series_id, 0), series_number from works where id = $1", id).Scan(
+		&work.Title, &work.Author, &work.SeriesID, &work.SeriesNumber)
+	if err != nil {
+		return work, err
+	}
+
+	err = conn.QueryRow(context.Background(), "select coalesce(avg(r.stars), 0), count(r.id) from reviews r join books b on r.book_id = b.id where b.work_id = $1", id).Scan(
+		&work.Rating, &work.ReviewCount)
+	return work, err
+}
+
+func librarianOnly(c *gin.Context, token string) bool {
+	_, accountType, err := ValidateJWT(token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Error invalid token"})
+		return false
+	}
+
+	if accountType != "librarian" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Error only librarians can manage works and series"})
+		return false
+	}
+
+	return true
+}
+
+func CreateWork(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && title && author && (seriesID && seriesNumber) && bookIDs (optional)
+
+	token, _ := information["token"].(string)
+	if !librarianOnly(c, token) {
+		return
+	}
+
+	var work Work
+	var ok bool
+	work.Title, ok = information["title"].(string)
+	if !ok || work.Title == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided title of the work"})
+		return
+	}
+	work.Author, _ = information["author"].(string)
+
+	var seriesID *int
+	if id, ok := information["seriesID"].(float64); ok {
+		work.SeriesID = int(id)
+		seriesID = &work.SeriesID
+	}
+
+	if number, ok := information["seriesNumber"].(float64); ok {
+		work.SeriesNumber = &number
+	}
+
+	var bookIDs []int
+	if ids, ok := information["bookIDs"].([]interface{}); ok {
+		for _, id := range ids {
+			bookID, ok := id.(float64)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided ids of the editions"})
+				return
+			}
+
+			bookIDs = append(bookIDs, int(bookID))
+		}
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = createTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = conn.QueryRow(context.Background(), "insert into works (title, author, series_id, series_number) values ($1, $2, $3, $4) returning id",
+		work.Title, work.Author, seriesID, work.SeriesNumber).Scan(&work.ID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to create the work"})
+		return
+	}
+
+	if len(bookIDs) > 0 {
+		_, err = conn.Exec(context.Background(), "update books set work_id = $1 where id = any($2)", work.ID, bookIDs)
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to add the editions to the work"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": work.ID})
+}
+
+// SetEdition makes a book an edition of a work, a workID of 0 detaches the book from its work.
+func SetEdition(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && workID && bookID
+
+	token, _ := information["token"].(string)
+	if !librarianOnly(c, token) {
+		return
+	}
+
+	workIDFl, ok := information["workID"].(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided id of the work"})
+		return
+	}
+
+	bookIDFl, ok := information["bookID"].(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided id of the book"})
+		return
+	}
+
+	var workID *int
+	if workIDFl != 0 {
+		id := int(workIDFl)
+		workID = &id
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = createTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	check := 0
+	err = conn.QueryRow(context.Background(), "update books set work_id = $1 where id = $2 returning id", workID, int(bookIDFl)).Scan(&check)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Error there is no such book in this library"})
+			return
+		}
+
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error unable to add the edition to this work"})
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
+
+// SetWorkSeries places a work in a series at the given position, a seriesID of 0 removes it from its series.
+func SetWorkSeries(c *gin.Context) {
+	var information map[string]interface{}
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && workID && seriesID && seriesNumber
+
+	token, _ := information["token"].(string)
+	if !librarianOnly(c, token) {
+		return
+	}
+
+	workID, ok := information["workID"].(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided id of the work"})
+		return
+	}
+
+	var seriesID *int
+	var seriesNumber *float64
+	if id, ok := information["seriesID"].(float64); ok && id != 0 {
+		series := int(id)
+		seriesID = &series
+		number, ok := information["seriesNumber"].(float64)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Error the number of the work in the series is missing"})
+			return
+		}
+		seriesNumber = &number
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = createTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	check := 0
+	err = conn.QueryRow(context.Background(), "update works set series_id = $1, series_number = $2 where id = $3 returning id", seriesID, seriesNumber, int(workID)).Scan(&check)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Error there is no such work"})
+			return
+		}
+
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error unable to add the work to this series"})
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
+
+func GetWork(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided id of the work"})
+		return
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = createTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	work, err := getWork(conn, id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Error there is no such work"})
+			return
+		}
+
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to get information about the work"})
+		return
+	}
+
+	age, userID, err := OptionalReader(conn, c.Query("token"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	work.Editions, err = GetEditions(conn, id, age, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"work": work})
+}
+
+func CreateSeries(c *gin.Context) {
+	var information map[string]string
+	json.NewDecoder(c.Request.Body).Decode(&information) // token && name && description
+
+	if !librarianOnly(c, information["token"]) {
+		return
+	}
+
+	if information["name"] == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error the name of the series is missing"})
+		return
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = createTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	id := 0
+	err = conn.QueryRow(context.Background(), "insert into series (name, description) values ($1, $2) returning id", information["name"], information["description"]).Scan(&id)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to create the series"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": id})
+}
+
+// GetSeries returns a series with its works in reading order.
+func GetSeries(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error incorrectly provided id of the series"})
+		return
+	}
+
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to connect to the database"})
+		return
+	}
+	defer conn.Close(context.Background())
+
+	if err = createTables(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	series := Series{ID: id}
+	err = conn.QueryRow(context.Background(), "select name, description from series where id = $1", id).Scan(&series.Name, &series.Description)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Error there is no such series"})
+			return
+		}
+
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to get information about the series"})
+		return
+	}
+
+	rows, err := conn.Query(context.Background(), "select id from works where series_id = $1 order by series_number nulls last, id", id)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to get the works in the series"})
+		return
+	}
+
+	var workIDs []int
+	for rows.Next() {
+		workID := 0
+		if err = rows.Scan(&workID); err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error working with the works in the series"})
+			return
+		}
+
+		workIDs = append(workIDs, workID)
+	}
+
+	if rows.Err() != nil {
+		log.Println(rows.Err())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error working with the works in the series"})
+		return
+	}
+
+	for _, workID := range workIDs {
+		work, err := getWork(conn, workID)
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unable to get information about the works in the series"})
+			return
+		}
+
+		series.Works = append(series.Works, work)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"series": series})
+}
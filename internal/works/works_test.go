@@ -0,0 +1,138 @@
+package works
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Phantomvv1/Library_management/internal/authentication"
+	"github.com/gin-gonic/gin"
+)
+
+var Token = ""
+var WorkID = 0
+
+func TestCreateWork(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/work", CreateWork)
+	router.POST("/login", authentication.LogIn)
+
+	rr := httptest.NewRecorder()
+
+	jsonBody := []byte(`{"email": "kris@kris.com", "password": "passowrd"}`)
+	reader := bytes.NewReader(jsonBody)
+
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/login", reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+
+	var token map[string]string
+	json.NewDecoder(rr.Body).Decode(&token)
+	Token = token["token"]
+
+	workRR := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"title": "Some title", "author": "Some author", "bookIDs": [1], "token": "%s"}`, Token))
+	workReq, err := http.NewRequest(http.MethodPost, "http://localhost:42069/work", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer workRR.Result().Body.Close()
+
+	router.ServeHTTP(workRR, workReq)
+
+	if workRR.Code != http.StatusOK {
+		t.Fatal(workRR.Body)
+	}
+
+	var work map[string]int
+	json.NewDecoder(workRR.Body).Decode(&work)
+	WorkID = work["id"]
+}
+
+func TestGetWork(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.GET("/work", GetWork)
+
+	rr := httptest.NewRecorder()
+
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:42069/work?id=%d", WorkID), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+}
+
+func TestSeries(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.POST("/series", CreateSeries)
+	router.POST("/work/series", SetWorkSeries)
+	router.GET("/series", GetSeries)
+
+	rr := httptest.NewRecorder()
+
+	body := []byte(fmt.Sprintf(`{"name": "Some series", "token": "%s"}`, Token))
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:42069/series", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Result().Body.Close()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatal(rr.Body)
+	}
+
+	var series map[string]int
+	json.NewDecoder(rr.Body).Decode(&series)
+
+	seriesRR := httptest.NewRecorder()
+
+	body = []byte(fmt.Sprintf(`{"workID": %d, "seriesID": %d, "seriesNumber": 1, "token": "%s"}`, WorkID, series["id"], Token))
+	req, err = http.NewRequest(http.MethodPost, "http://localhost:42069/work/series", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer seriesRR.Result().Body.Close()
+
+	router.ServeHTTP(seriesRR, req)
+
+	if seriesRR.Code != http.StatusOK {
+		t.Fatal(seriesRR.Body)
+	}
+
+	getRR := httptest.NewRecorder()
+
+	req, err = http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:42069/series?id=%d", series["id"]), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer getRR.Result().Body.Close()
+
+	router.ServeHTTP(getRR, req)
+
+	if getRR.Code != http.StatusOK {
+		t.Fatal(getRR.Body)
+	}
+}